@@ -0,0 +1,210 @@
+package habit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	//ReadScope allows a token to list habits
+	ReadScope Scope = iota + 1
+	//CheckInScope allows a token to list, create and check in habits
+	CheckInScope
+	//HookScope only allows a token to check in habits through /hooks/checkin, giving every automation its own secret
+	HookScope
+	//StoreScope allows a token everything, including writing whole habits with their history and streak as a remote
+	//store does
+	StoreScope
+)
+
+//Scope represents the permissions granted to an API token
+type Scope int
+
+//String returns the name of the scope as used by the CLI
+func (s Scope) String() string {
+	switch s {
+	case ReadScope:
+		return "read"
+	case CheckInScope:
+		return "checkin"
+	case HookScope:
+		return "hook"
+	case StoreScope:
+		return "store"
+	}
+	return "unknown"
+}
+
+//Allows returns true if the scope grants the permissions of the required scope. Hook tokens are only allowed on hooks,
+//which checkin tokens may use as well, and only store tokens write whole habits.
+func (s Scope) Allows(required Scope) bool {
+	switch {
+	case s == StoreScope:
+		return true
+	case required == HookScope:
+		return s == HookScope || s == CheckInScope
+	case s == HookScope || required == StoreScope:
+		return false
+	}
+	return s >= required
+}
+
+func parseScope(scope string) (Scope, error) {
+	switch scope {
+	case "read":
+		return ReadScope, nil
+	case "checkin":
+		return CheckInScope, nil
+	case "hook":
+		return HookScope, nil
+	case "store":
+		return StoreScope, nil
+	}
+	return 0, fmt.Errorf("unknown scope: %s", scope)
+}
+
+//Token is an API token used to authenticate against the habit server. Only the hash of the secret is stored.
+type Token struct {
+	ID      string
+	User    string
+	Name    string
+	Hash    string
+	Scope   Scope
+	Created time.Time
+}
+
+//TokenStore is implemented by stores that can persist API tokens
+type TokenStore interface {
+	CreateToken(token *Token) error
+	GetToken(hash string) (*Token, error)
+	ListTokens() []*Token
+	RevokeToken(id string) error
+}
+
+//NewToken generates a random token for user with the given name and scope. It returns the token to be stored and the
+//plain text secret to be handed to the client, which is not kept anywhere else.
+func NewToken(user, name string, scope Scope) (*Token, string, error) {
+	if scope != ReadScope && scope != CheckInScope && scope != HookScope && scope != StoreScope {
+		return nil, "", errors.New("invalid scope")
+	}
+	id, err := randomHex(4)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+	token := Token{
+		ID:      id,
+		User:    user,
+		Name:    name,
+		Hash:    HashToken(secret),
+		Scope:   scope,
+		Created: time.Now(),
+	}
+	return &token, secret, nil
+}
+
+//HashToken returns the hex encoded SHA-256 hash of the given secret
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+//requireMethodScope requires ReadScope for requests that only read, StoreScope for requests that write or delete
+//whole habits at /api/habits or /api/habits/{name} and CheckInScope for the requests that check in or pause habits
+func (server *server) requireMethodScope(next http.Handler) http.Handler {
+	read := server.requireScope(ReadScope, next)
+	checkIn := server.requireScope(CheckInScope, next)
+	store := server.requireScope(StoreScope, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+			read.ServeHTTP(w, r)
+		case r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodDelete:
+			if _, action, _ := parseHabitPath(r.URL); action == "" {
+				store.ServeHTTP(w, r)
+				return
+			}
+			checkIn.ServeHTTP(w, r)
+		default:
+			checkIn.ServeHTTP(w, r)
+		}
+	})
+}
+
+type contextKey int
+
+const userContextKey contextKey = iota
+
+//requestUser returns the user authenticated by requireScope, or the server's default user when auth is disabled
+func (server *server) requestUser(r *http.Request) string {
+	if user, ok := r.Context().Value(userContextKey).(string); ok {
+		return user
+	}
+	return server.DefaultUser
+}
+
+//ErrTokenNotFound is returned when revoking a token that does not exist
+var ErrTokenNotFound = errors.New("token not found")
+
+//EnableAuth makes the server require a bearer token stored in tokens on every request
+func (server *server) EnableAuth(tokens TokenStore) error {
+	if tokens == nil {
+		return errors.New("token store cannot be nil")
+	}
+	server.tokens = tokens
+	return nil
+}
+
+//requireScope wraps next with bearer token authentication and passes the token's user on in the request context.
+//Errors are kept generic so that nothing about the requested habit is revealed to unauthenticated clients.
+func (server *server) requireScope(scope Scope, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if server.tokens == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		secret := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if secret == "" || secret == r.Header.Get("Authorization") {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		token, err := server.tokens.GetToken(HashToken(secret))
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if token == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if !token.Scope.Allows(scope) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		ctx := context.WithValue(r.Context(), userContextKey, token.User)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
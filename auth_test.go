@@ -0,0 +1,384 @@
+package habit_test
+
+import (
+	"github.com/crmejia/habit"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewTokenHashesSecret(t *testing.T) {
+	t.Parallel()
+	token, secret, err := habit.NewToken("alice", "laptop", habit.ReadScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == "" || token.ID == "" {
+		t.Fatal("want NewToken to generate an id and a secret")
+	}
+	if token.Hash == secret {
+		t.Error("want token to store the hash of the secret, not the secret")
+	}
+	if token.Hash != habit.HashToken(secret) {
+		t.Error("want token hash to match HashToken(secret)")
+	}
+}
+
+func TestNewTokenErrorsOnInvalidScope(t *testing.T) {
+	t.Parallel()
+	_, _, err := habit.NewToken("alice", "laptop", habit.Scope(42))
+	if err == nil {
+		t.Error("want NewToken to fail on invalid scope")
+	}
+}
+
+func TestScope_Allows(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		scope    habit.Scope
+		required habit.Scope
+		want     bool
+	}{
+		{habit.ReadScope, habit.ReadScope, true},
+		{habit.ReadScope, habit.CheckInScope, false},
+		{habit.CheckInScope, habit.ReadScope, true},
+		{habit.CheckInScope, habit.CheckInScope, true},
+		{habit.HookScope, habit.HookScope, true},
+		{habit.HookScope, habit.ReadScope, false},
+		{habit.HookScope, habit.CheckInScope, false},
+		{habit.CheckInScope, habit.HookScope, true},
+		{habit.ReadScope, habit.HookScope, false},
+		{habit.CheckInScope, habit.StoreScope, false},
+		{habit.StoreScope, habit.CheckInScope, true},
+		{habit.StoreScope, habit.HookScope, true},
+		{habit.StoreScope, habit.StoreScope, true},
+	}
+	for _, tc := range testCases {
+		got := tc.scope.Allows(tc.required)
+		if tc.want != got {
+			t.Errorf("want %s.Allows(%s) to be %t, got %t", tc.scope, tc.required, tc.want, got)
+		}
+	}
+}
+
+func TestTokenStores_CreateGetListRevoke(t *testing.T) {
+	t.Parallel()
+	memoryStore := habit.OpenMemoryStore()
+	dbStore, err := habit.OpenDBStore(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileStore, err := habit.OpenFileStore(t.TempDir() + "/.habitTracker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name  string
+		store habit.TokenStore
+	}{
+		{"MemoryStore", memoryStore},
+		{"DBStore", dbStore.(habit.TokenStore)},
+		{"FileStore", fileStore.(habit.TokenStore)},
+	}
+
+	for _, tc := range testCases {
+		token, secret, err := habit.NewToken("alice", "laptop", habit.CheckInScope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tc.store.CreateToken(token)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		got, err := tc.store.GetToken(habit.HashToken(secret))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got == nil || got.ID != token.ID || got.Scope != habit.CheckInScope || got.Name != "laptop" ||
+			got.User != "alice" {
+			t.Errorf("%s: want GetToken to return the stored token, got %+v", tc.name, got)
+		}
+		if len(tc.store.ListTokens()) != 1 {
+			t.Errorf("%s: want ListTokens to return 1 token, got %d", tc.name, len(tc.store.ListTokens()))
+		}
+
+		err = tc.store.RevokeToken(token.ID)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		got, err = tc.store.GetToken(habit.HashToken(secret))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got != nil {
+			t.Errorf("%s: want revoked token to be gone", tc.name)
+		}
+		err = tc.store.RevokeToken(token.ID)
+		if err != habit.ErrTokenNotFound {
+			t.Errorf("%s: want revoking unknown token to return ErrTokenNotFound, got %v", tc.name, err)
+		}
+	}
+}
+
+func TestFileStoreTokensPersistAcrossOpens(t *testing.T) {
+	t.Parallel()
+	filename := t.TempDir() + "/.habitTracker"
+	store, err := habit.OpenFileStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, secret, err := habit.NewToken("alice", "", habit.ReadScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.(habit.TokenStore).CreateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Create(&habit.Habit{Name: "piano"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = habit.OpenFileStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.(habit.TokenStore).GetToken(habit.HashToken(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil {
+		t.Error("want token to be persisted")
+	}
+	h, err := store.Get("", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h == nil {
+		t.Error("want habit to be persisted alongside tokens")
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	t.Parallel()
+	store := habit.OpenMemoryStore()
+	store.Habits["alice"] = map[string]*habit.Habit{"secret-habit": {Name: "secret-habit", User: "alice"}}
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := habit.NewServer(&controller, localHostAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.EnableAuth(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readToken, readSecret, err := habit.NewToken("alice", "read", habit.ReadScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInToken, checkInSecret, err := habit.NewToken("alice", "checkin", habit.CheckInScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []*habit.Token{readToken, checkInToken} {
+		err = store.CreateToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testServer := httptest.NewServer(server.Routes())
+	defer testServer.Close()
+	testCases := []struct {
+		name       string
+		path       string
+		auth       string
+		wantStatus int
+	}{
+		{"no token on check in", "/?habit=secret-habit", "", http.StatusUnauthorized},
+		{"no token on all", "/all", "", http.StatusUnauthorized},
+		{"unknown token", "/all", "Bearer nope", http.StatusUnauthorized},
+		{"not a bearer token", "/all", readSecret, http.StatusUnauthorized},
+		{"read token on all", "/all", "Bearer " + readSecret, http.StatusOK},
+		{"read token on check in", "/?habit=secret-habit", "Bearer " + readSecret, http.StatusForbidden},
+		{"check in token on check in", "/?habit=secret-habit", "Bearer " + checkInSecret, http.StatusOK},
+		{"check in token on all", "/all", "Bearer " + checkInSecret, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		req, err := http.NewRequest(http.MethodGet, testServer.URL+tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != tc.wantStatus {
+			t.Errorf("%s: want status %d, got %d", tc.name, tc.wantStatus, res.StatusCode)
+		}
+		if res.StatusCode != http.StatusOK && strings.Contains(string(body), "secret-habit") {
+			t.Errorf("%s: want error response not to leak habit names, got:\n%s", tc.name, body)
+		}
+	}
+}
+
+func TestServerAuthRequiresStoreScopeToWriteHabits(t *testing.T) {
+	t.Parallel()
+	store := habit.OpenMemoryStore()
+	store.Habits["alice"] = map[string]*habit.Habit{
+		"piano": {Name: "piano", User: "alice", Frequency: habit.DailyInterval}}
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := habit.NewServer(&controller, localHostAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.EnableAuth(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInToken, checkInSecret, err := habit.NewToken("alice", "checkin", habit.CheckInScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeToken, storeSecret, err := habit.NewToken("alice", "store", habit.StoreScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []*habit.Token{checkInToken, storeToken} {
+		err = store.CreateToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := server.Routes()
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		secret     string
+		body       string
+		wantStatus int
+	}{
+		{"checkin token creates", http.MethodPost, "/api/habits", checkInSecret, `{"Name":"chess","Streak":500}`,
+			http.StatusForbidden},
+		{"checkin token replaces", http.MethodPut, "/api/habits/piano", checkInSecret, `{"Name":"piano","Streak":500}`,
+			http.StatusForbidden},
+		{"checkin token checks in", http.MethodPost, "/api/habits/piano/checkins", checkInSecret, `{}`,
+			http.StatusOK},
+		{"checkin token reads", http.MethodGet, "/api/habits/piano", checkInSecret, "", http.StatusOK},
+		{"checkin token deletes", http.MethodDelete, "/api/habits/piano", checkInSecret, "", http.StatusForbidden},
+		{"store token creates", http.MethodPost, "/api/habits", storeSecret, `{"Name":"chess","Frequency":86400000000000}`,
+			http.StatusCreated},
+		{"store token checks in", http.MethodPost, "/api/habits/chess/checkins", storeSecret, `{}`, http.StatusOK},
+		{"no name", http.MethodPost, "/api/habits", storeSecret, `{"Frequency":86400000000000}`, http.StatusBadRequest},
+		{"no frequency", http.MethodPost, "/api/habits", storeSecret, `{"Name":"go"}`, http.StatusBadRequest},
+		{"negative target", http.MethodPut, "/api/habits/chess", storeSecret,
+			`{"Frequency":86400000000000,"Target":-1}`, http.StatusBadRequest},
+		{"unknown kind", http.MethodPut, "/api/habits/chess", storeSecret, `{"Frequency":86400000000000,"Kind":7}`,
+			http.StatusBadRequest},
+		{"store token deletes", http.MethodDelete, "/api/habits/chess", storeSecret, "", http.StatusNoContent},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Authorization", "Bearer "+tc.secret)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if recorder.Code != tc.wantStatus {
+			t.Errorf("%s: want status %d, got %d: %s", tc.name, tc.wantStatus, recorder.Code, recorder.Body.String())
+		}
+	}
+	h, err := store.Get("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h == nil || h.Streak == 500 {
+		t.Errorf("want checkin token neither to set the streak nor to delete the habit, got %+v", h)
+	}
+}
+
+func TestEnableAuthErrorsOnNilTokenStore(t *testing.T) {
+	t.Parallel()
+	store := habit.OpenMemoryStore()
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := habit.NewServer(&controller, localHostAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.EnableAuth(nil)
+	if err == nil {
+		t.Error("want EnableAuth to fail on nil token store")
+	}
+}
+
+func TestServerAuthResolvesUserFromToken(t *testing.T) {
+	t.Parallel()
+	store := habit.OpenMemoryStore()
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := habit.NewServer(&controller, localHostAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.EnableAuth(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceToken, aliceSecret, err := habit.NewToken("alice", "", habit.CheckInScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobToken, bobSecret, err := habit.NewToken("bob", "", habit.CheckInScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []*habit.Token{aliceToken, bobToken} {
+		err = store.CreateToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := server.Routes()
+
+	req := httptest.NewRequest(http.MethodGet, "/?habit=piano", nil)
+	req.Header.Set("Authorization", "Bearer "+aliceSecret)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if store.Habits["alice"]["piano"] == nil {
+		t.Fatal("want check in to create the habit for the token's user")
+	}
+
+	recorder := httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/all", nil)
+	req.Header.Set("Authorization", "Bearer "+bobSecret)
+	handler.ServeHTTP(recorder, req)
+	if strings.Contains(recorder.Body.String(), "piano") {
+		t.Errorf("want bob not to see alice's habits, got:\n%s", recorder.Body.String())
+	}
+}
@@ -1,130 +1,543 @@
 package habit
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/mitchellh/go-homedir"
 	"io"
 )
 
-//RunCLI parses arguments and passes them to habit.Controller
-func RunCLI(args []string, output io.Writer) {
-	flagSet := flag.NewFlagSet("habit", flag.ContinueOnError)
-	flagSet.SetOutput(output)
-	flagSet.Usage = func() {
-		fmt.Fprintln(output,
-			`habit is an application to assist you in building habits
-Usage: habit <Option Flags> <HABIT_NAME> -- to create/update a new habit
-       habit all   --   to list all habits
-Option Flags:`)
-		flagSet.PrintDefaults()
+//Exit statuses returned by RunCLI
+const (
+	exitOK = 0
+	//exitHabitsDue is returned by habit due -exit-code when habits need doing
+	exitHabitsDue = 1
+	exitError     = 2
+)
+
+//RunCLI parses arguments and runs the command they name, see habit help. A first argument that is not a command is a
+//habit name, which is created or checked in like with habit new and habit log. It returns the exit status of the
+//command: 0 on success, 2 on errors and 1 from habit due -exit-code when habits are due today or overdue.
+func RunCLI(args []string, output io.Writer) int {
+	c, err := newCLI(output)
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return exitError
+	}
+	err = c.global.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		return exitError
+	}
+	if c.global.NArg() == 0 {
+		c.usage()
+		return exitError
 	}
+	err = c.loadConfig()
+	if err != nil {
+		fmt.Fprintln(c.output, err)
+		return exitError
+	}
+	defer c.close()
 
-	frequency := flagSet.String("f", "daily", "Set the frequency of the habit: daily, weekly.")
-	storeType := flagSet.String("s", "db", "Set the store backend for habit tracker: db, file.")
+	name, cmdArgs := c.global.Arg(0), c.global.Args()[1:]
+	command := findCommand(name)
+	if command == nil {
+		//habit <HABIT_NAME> creates the habit or checks it in
+		command, cmdArgs = shortcutCommand(), c.global.Args()
+	}
+	return c.run(command, name, cmdArgs)
+}
+
+//cli holds the global options of a habit invocation and the store opened for its command
+type cli struct {
+	output  io.Writer
+	input   io.Reader
+	homeDir string
+	//dataDir is the default store directory
+	dataDir string
+	global  *flag.FlagSet
+	options *globalOptions
+	//legacy holds the names of the command flags that are also accepted before the command
+	legacy map[string]bool
+	config *Config
+	//calendar counts days as configured
+	calendar Calendar
+	printer  printer
+
+	store Store
+	//storeDSN is the DSN store was opened with
+	storeDSN   string
+	controller Controller
+	dispatcher *WebhookDispatcher
+}
+
+//newCLI returns a cli writing to output, with the global flags defined
+func newCLI(output io.Writer) (*cli, error) {
 	homeDir, err := homedir.Dir()
 	if err != nil {
-		fmt.Fprintln(output, err)
-		return
+		return nil, err
 	}
-	storeDir := flagSet.String("d", homeDir, "Set the store directory.")
+	dataDir, err := DataDir()
+	if err != nil {
+		return nil, err
+	}
+	c := &cli{output: output, input: os.Stdin, homeDir: homeDir, dataDir: dataDir, global: flag.NewFlagSet("habit",
+		flag.ContinueOnError)}
+	c.global.SetOutput(output)
+	c.global.Usage = c.usage
+	c.options = globalFlags(c.global, dataDir)
+	c.legacyFlags()
+	return c, nil
+}
 
-	err = flagSet.Parse(args)
+//globalOptions are the flags given before the command
+type globalOptions struct {
+	storeType *string
+	storeDir  *string
+	storeDSN  *string
+	user      *string
+	token     *string
+	format    *string
+	config    *string
+	webhooks  *webhookOptions
+}
+
+func globalFlags(flagSet *flag.FlagSet, dataDir string) *globalOptions {
+	return &globalOptions{
+		storeType: flagSet.String("s", "db", "Set the store backend for habit tracker: db, file, remote."),
+		storeDir: flagSet.String("d", dataDir, "Set the store directory, or the server URL for the remote store. "+
+			"Defaults to the .habit directory of the project, or $XDG_DATA_HOME/habit."),
+		storeDSN: flagSet.String("store", "", "Set the store DSN: sqlite:///PATH, file:///PATH, memory:// or "+
+			"http://HOST:PORT. Overrides -s and -d."),
+		user:  flagSet.String("u", DefaultUser(), "Set the user owning the habits."),
+		token: flagSet.String("t", "", "Set the API token for the remote store. Defaults to $HABIT_TOKEN."),
+		format: flagSet.String("o", textOutput, "Set the output format: text, or json, yaml or tsv to print the "+
+			"results of commands as data."),
+		config: flagSet.String("config", "", "Set the config file. Defaults to $HABIT_CONFIG, or "+
+			"$XDG_CONFIG_HOME/habit/config.toml."),
+		webhooks: webhookFlags(flagSet, dataDir),
+	}
+}
+
+//legacyFlags defines the flags of habit <HABIT_NAME> and habit list on the global flag set, as they were accepted
+//before the habit name or all before commands had flags of their own. Their values are passed on to the command.
+func (c *cli) legacyFlags() {
+	c.legacy = map[string]bool{}
+	for _, command := range []*cliCommand{shortcutCommand(), findCommand("list")} {
+		flagSet := flag.NewFlagSet(command.name, flag.ContinueOnError)
+		command.setup(c, flagSet)
+		flagSet.VisitAll(func(f *flag.Flag) {
+			if !c.legacy[f.Name] {
+				c.legacy[f.Name] = true
+				c.global.Var(f.Value, f.Name, f.Usage)
+			}
+		})
+	}
+}
+
+//loadConfig reads the config file and the environment, whose settings become the values of the global flags that
+//were not set
+func (c *cli) loadConfig() error {
+	config, err := LoadConfig(*c.options.config)
 	if err != nil {
-		fmt.Fprintln(output, err)
-		return
+		return err
+	}
+	set := map[string]bool{}
+	c.global.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	if (set["s"] || set["d"]) && !set["store"] {
+		//-s and -d given on the command line win over a configured store DSN
+		config.Store, config.Sources["store"] = "", defaultSource
+	}
+	err = config.useFlags(c.global, map[string]string{"store_type": "s", "store_dir": "d", "store": "store",
+		"frequency": "f"})
+	if err != nil {
+		return err
 	}
+	c.config = config
+	c.calendar, err = config.Calendar()
+	return err
+}
 
-	if len(flagSet.Args()) == 0 {
+//run parses the command's flags, which may come before, between or after its arguments, and runs it. name is the
+//name the command was invoked with. Global flags are accepted among the command's flags too.
+func (c *cli) run(command *cliCommand, name string, args []string) int {
+	flagSet, run := c.commandFlags(command, name)
+	args, err := parseArgs(flagSet, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		return exitError
+	}
+	c.printer, err = newPrinter(*c.options.format, c.output)
+	if err != nil {
+		fmt.Fprintln(c.output, err)
 		flagSet.Usage()
-		return
+		return exitError
 	}
 
-	if len(flagSet.Args()) > 1 {
-		fmt.Fprintln(output, "too many args")
-		flagSet.Usage()
-		return
+	status, err := run(args)
+	if err != nil {
+		fmt.Fprintln(c.output, err)
+		var usageErr usageError
+		if errors.As(err, &usageErr) {
+			flagSet.Usage()
+		}
+		return exitError
 	}
+	return status
+}
 
-	store, err := storeFactory(*storeType, *storeDir)
+//commandFlags returns the flag set of the command, with the global flags added, and the function running it
+func (c *cli) commandFlags(command *cliCommand, name string) (*flag.FlagSet, func(args []string) (int, error)) {
+	flagSet := flag.NewFlagSet(name, flag.ContinueOnError)
+	flagSet.SetOutput(c.output)
+	flagSet.Usage = func() {
+		c.commandUsage(command, name)
+	}
+	run := command.setup(c, flagSet)
+	c.global.VisitAll(func(f *flag.Flag) {
+		commandFlag := flagSet.Lookup(f.Name)
+		switch {
+		case commandFlag == nil && !c.legacy[f.Name]:
+			flagSet.Var(f.Value, f.Name, f.Usage)
+		case commandFlag != nil && c.legacy[f.Name] && f.Value.String() != f.DefValue:
+			commandFlag.Value.Set(f.Value.String())
+		}
+	})
+	return flagSet, run
+}
+
+//parseArgs parses the flags given before, between or after the positional arguments and returns the arguments
+func parseArgs(flagSet *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		err := flagSet.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		rest := flagSet.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if parsed := args[:len(args)-len(rest)]; len(parsed) > 0 && parsed[len(parsed)-1] == "--" {
+			//arguments after -- are never flags
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+//usageError is an error in the arguments of a command, it is reported along with the command's usage
+type usageError struct {
+	error
+}
+
+func usageErrorf(format string, a ...interface{}) error {
+	return usageError{fmt.Errorf(format, a...)}
+}
+
+//open opens the store and the controller the first time a command needs them
+func (c *cli) open() (Controller, error) {
+	if c.store != nil {
+		return c.controller, nil
+	}
+	token := *c.options.token
+	if token == "" {
+		token = os.Getenv("HABIT_TOKEN")
+	}
+	storeDSN := *c.options.storeDSN
+	if storeDSN == "" {
+		var err error
+		if *c.options.storeDir == c.dataDir && *c.options.storeType != "remote" {
+			err = c.migrate()
+			if err != nil {
+				return Controller{}, err
+			}
+		}
+		storeDSN, err = legacyStoreDSN(*c.options.storeType, *c.options.storeDir)
+		if err != nil {
+			return Controller{}, usageError{err}
+		}
+	}
+	store, err := OpenStore(withToken(storeDSN, token))
 	if err != nil {
-		fmt.Fprintln(output, err)
-		flagSet.Usage()
-		return
+		return Controller{}, usageError{err}
 	}
 	controller, err := NewController(store)
 	if err != nil {
-		fmt.Fprintln(output, err)
-		flagSet.Usage()
+		return Controller{}, usageError{err}
+	}
+	controller.Calendar = c.calendar
+	dispatcher, err := c.options.webhooks.open()
+	if err != nil {
+		return Controller{}, err
+	}
+	if dispatcher != nil {
+		controller.EventHandlers = append(controller.EventHandlers, dispatcher)
+	}
+	c.store, c.storeDSN, c.controller, c.dispatcher = store, storeDSN, controller, dispatcher
+	return controller, nil
+}
+
+//migrate moves the stores kept in the home directory by earlier versions of habit to the data directory
+func (c *cli) migrate() error {
+	moved, err := migrateHomeFiles(c.homeDir, c.dataDir)
+	if !c.printer.structured() {
+		for _, file := range moved {
+			fmt.Fprintf(c.output, "Moved %s to %s.\n", file, c.dataDir)
+		}
+	}
+	return err
+}
+
+//close delivers the webhook events of the command. Deliveries that fail now are retried by later runs.
+func (c *cli) close() {
+	if c.dispatcher == nil {
 		return
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := c.dispatcher.Deliver(ctx)
+	if err != nil {
+		fmt.Fprintln(c.output, err)
+	}
+}
 
-	if flagSet.Args()[0] == "all" {
-		fmt.Fprintln(output, controller.GetAllHabits())
+//usage prints the commands and the global flags
+func (c *cli) usage() {
+	fmt.Fprintln(c.output, `habit is an application to assist you in building habits
+Usage: habit <Global Flags> <COMMAND> [ARGS]
+       habit <Global Flags> <HABIT_NAME> [flags]   --   to create a habit, or check it in if it exists
+Commands:`)
+	w := tabwriter.NewWriter(c.output, 0, 0, 3, ' ', 0)
+	for _, command := range commands() {
+		if command.hidden {
+			continue
+		}
+		name := strings.Join(append([]string{command.name}, command.aliases...), "|")
+		fmt.Fprintf(w, "  %s %s\t%s\n", name, command.args, command.summary)
+	}
+	w.Flush()
+	fmt.Fprintln(c.output, "Run `habit help <COMMAND>` for the flags of a command. The flags of habit <HABIT_NAME> "+
+		"and list\nare also accepted before the command.\nGlobal Flags:")
+	display := flag.NewFlagSet("habit", flag.ContinueOnError)
+	display.SetOutput(c.output)
+	globalFlags(display, c.dataDir)
+	display.PrintDefaults()
+}
+
+//commandUsage prints the usage of a command and of its own flags
+func (c *cli) commandUsage(command *cliCommand, name string) {
+	if command.name == "" {
+		c.usage()
 		return
 	}
+	flagSet := flag.NewFlagSet(name, flag.ContinueOnError)
+	flagSet.SetOutput(c.output)
+	command.setup(c, flagSet)
+	hasFlags := false
+	flagSet.VisitAll(func(*flag.Flag) {
+		hasFlags = true
+	})
+	usage := "habit <Global Flags> " + name
+	if command.args != "" {
+		usage += " " + command.args
+	}
+	if hasFlags {
+		usage += " [flags]"
+	}
+	fmt.Fprintf(c.output, "Usage: %s\n%s.\n", usage, command.summary)
+	if len(command.aliases) > 0 {
+		fmt.Fprintf(c.output, "Aliases: %s\n", strings.Join(append([]string{command.name}, command.aliases...), ", "))
+	}
+	if hasFlags {
+		fmt.Fprintln(c.output, "Flags:")
+		flagSet.PrintDefaults()
+	}
+}
+
+//webhookOptions are the flags configuring webhooks
+type webhookOptions struct {
+	urls   stringsFlag
+	secret *string
+	queue  *string
+}
 
-	h, err := parseHabit(flagSet.Args()[0], *frequency)
+func webhookFlags(flagSet *flag.FlagSet, dataDir string) *webhookOptions {
+	options := webhookOptions{}
+	flagSet.Var(&options.urls, "webhook", "Post habit events as JSON to a URL, may be repeated.")
+	options.secret = flagSet.String("webhook-secret", "", "Set the secret signing webhook payloads. Defaults to "+
+		"$HABIT_WEBHOOK_SECRET.")
+	options.queue = flagSet.String("webhook-queue", filepath.Join(dataDir, ".habitWebhooks.json"),
+		"Set the file keeping webhook deliveries until they succeed.")
+	return &options
+}
+
+//open returns a WebhookDispatcher for the configured webhooks, or nil if there are none
+func (o *webhookOptions) open() (*WebhookDispatcher, error) {
+	if len(o.urls) == 0 {
+		return nil, nil
+	}
+	secret := *o.secret
+	if secret == "" {
+		secret = os.Getenv("HABIT_WEBHOOK_SECRET")
+	}
+	webhooks := make([]Webhook, 0, len(o.urls))
+	for _, u := range o.urls {
+		webhooks = append(webhooks, Webhook{URL: u, Secret: secret})
+	}
+	//the default queue is kept in the data directory, which may not exist yet
+	err := os.MkdirAll(filepath.Dir(*o.queue), 0700)
+	if err != nil {
+		return nil, err
+	}
+	return NewWebhookDispatcher(OpenFileDeliveryQueue(*o.queue), webhooks...)
+}
+
+//stringsFlag is a flag that may be repeated
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+//RunServer parses args and starts HTTP habit server on provided address, or the configured one. Requests must carry an
+//API token created with `habit token create` unless auth is disabled.
+func RunServer(args []string, output io.Writer) {
+	flagSet := flag.NewFlagSet("server", flag.ContinueOnError)
+	flagSet.SetOutput(output)
+	homeDir, err := homedir.Dir()
 	if err != nil {
 		fmt.Fprintln(output, err)
-		flagSet.Usage()
 		return
 	}
-
-	h, err = controller.Handle(h)
+	dataDir, err := DataDir()
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return
+	}
+	storeDir := flagSet.String("d", dataDir, "Set the store directory. Defaults to the .habit directory of the "+
+		"project, or $XDG_DATA_HOME/habit.")
+	storeDSN := flagSet.String("store", "", "Set the store DSN: sqlite:///PATH, file:///PATH or memory://. "+
+		"Overrides -d.")
+	noAuth := flagSet.Bool("no-auth", false, "Disable API token authentication.")
+	user := flagSet.String("u", DefaultUser(), "Set the user owning the habits when auth is disabled.")
+	configPath := flagSet.String("config", "", "Set the config file. Defaults to $HABIT_CONFIG, or "+
+		"$XDG_CONFIG_HOME/habit/config.toml.")
+	webhooks := webhookFlags(flagSet, dataDir)
+	err = flagSet.Parse(args)
+	if err != nil {
+		fmt.Fprintln(output, err)
+		return
+	}
+	config, err := LoadConfig(*configPath)
+	if err == nil {
+		err = config.useFlags(flagSet, map[string]string{"store_dir": "d", "store": "store"})
+	}
+	var calendar Calendar
+	if err == nil {
+		calendar, err = config.Calendar()
+	}
 	if err != nil {
 		fmt.Fprintln(output, err)
 		return
 	}
-	fmt.Fprintln(output, h)
-}
 
-//RunServer parses args and starts HTTP habit server on provided address
-func RunServer(args []string, output io.Writer) {
-	if len(args) == 0 {
+	address := config.ServerAddress
+	if len(flagSet.Args()) > 0 {
+		address = flagSet.Arg(0)
+	}
+	if address == "" {
 		fmt.Fprintln(output, "no address provided")
 		return
 	}
-	if len(args) > 1 {
+	if len(flagSet.Args()) > 1 {
 		fmt.Fprintln(output, "too many args provided")
 		return
 	}
-	homeDir, err := homedir.Dir()
+	if *storeDSN == "" {
+		storeType := "db"
+		if config.StoreType == "file" {
+			storeType = "file"
+		}
+		if *storeDir == dataDir {
+			moved, err := migrateHomeFiles(homeDir, dataDir)
+			for _, file := range moved {
+				fmt.Fprintf(output, "Moved %s to %s.\n", file, dataDir)
+			}
+			if err != nil {
+				fmt.Fprintln(output, err)
+				return
+			}
+		}
+		*storeDSN, err = legacyStoreDSN(storeType, *storeDir)
+		if err != nil {
+			fmt.Fprintln(output, err)
+			return
+		}
+	}
+	store, err := OpenStore(*storeDSN)
 	if err != nil {
 		fmt.Fprintln(output, err)
 		return
 	}
-	store, err := OpenDBStore(homeDir + "/.habitTracker.db")
+	controller, err := NewController(store)
 	if err != nil {
 		fmt.Fprintln(output, err)
 		return
 	}
-	controller, err := NewController(store)
+	controller.Calendar = calendar
+	dispatcher, err := webhooks.open()
 	if err != nil {
 		fmt.Fprintln(output, err)
 		return
 	}
-	server, err := NewServer(&controller, args[0])
+	if dispatcher != nil {
+		controller.EventHandlers = append(controller.EventHandlers, dispatcher)
+		go dispatcher.Run(context.Background(), 10*time.Second)
+	}
+	server, err := NewServer(&controller, address)
 	if err != nil {
 		fmt.Fprintln(output, err)
 		return
 	}
+	server.DefaultUser = *user
+	if !*noAuth {
+		tokens, ok := store.(TokenStore)
+		if !ok {
+			fmt.Fprintln(output, "store does not support API tokens, pass -no-auth to run without authentication")
+			return
+		}
+		if len(tokens.ListTokens()) == 0 {
+			fmt.Fprintln(output, "no API tokens found, create one with `habit token create`")
+		}
+		err = server.EnableAuth(tokens)
+		if err != nil {
+			fmt.Fprintln(output, err)
+			return
+		}
+	}
 	fmt.Fprintln(output, "Starting HTTP server")
 	server.Run()
 }
 
-func storeFactory(storeType string, dir string) (store Store, err error) {
-	switch storeType {
-	case "db":
-		store, err = OpenDBStore(dir + "/.habitTracker.db")
-	case "file":
-		store, err = OpenFileStore(dir + "/.habitTracker")
-	default:
-		return nil, fmt.Errorf("unknown store type %s", storeType)
-	}
-	if err != nil {
-		return nil, err
-	}
-	return store, nil
-}
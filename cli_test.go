@@ -7,6 +7,8 @@ import (
 	"github.com/phayes/freeport"
 	"io/ioutil"
 	"net/http"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -90,6 +92,55 @@ func TestRunClIShowNewHabitMessageNewHabit(t *testing.T) {
 	}
 }
 
+func TestRunCLIUserFlagNamespacesHabits(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", tmpDir, "-u", "alice", "piano"}, &buffer)
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "-u", "bob", "all"}, &buffer)
+	if strings.Contains(buffer.String(), "piano") {
+		t.Errorf("want bob not to see alice's habits, got:\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "-u", "alice", "all"}, &buffer)
+	if !strings.Contains(buffer.String(), "piano") {
+		t.Errorf("want alice to see their own habits, got:\n%s", buffer.String())
+	}
+}
+
+func TestRunCLIShowDisplaysLastResultForEveryBackend(t *testing.T) {
+	t.Parallel()
+	var outputs []string
+	for _, storeType := range []string{"db", "file"} {
+		tmpDir := t.TempDir()
+		buffer := bytes.Buffer{}
+		habit.RunCLI([]string{"-s", storeType, "-d", tmpDir, "piano"}, &buffer)
+		habit.RunCLI([]string{"-s", storeType, "-d", tmpDir, "piano"}, &buffer)
+
+		buffer.Reset()
+		habit.RunCLI([]string{"-s", storeType, "-d", tmpDir, "show", "piano"}, &buffer)
+		got := buffer.String()
+		if !strings.Contains(got, "Last result: already logged") || !strings.Contains(got, "You already logged 'piano'") {
+			t.Errorf("%s: want show to display the last result, got:\n%s", storeType, got)
+		}
+		//the check-in time is dropped as both runs may straddle a minute
+		got = regexp.MustCompile(`Last check-in: .*\n`).ReplaceAllString(got, "")
+		outputs = append(outputs, got)
+	}
+	if outputs[0] != outputs[1] {
+		t.Errorf("want show output to be identical across backends, got:\n%s\nand:\n%s", outputs[0], outputs[1])
+	}
+
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", t.TempDir(), "show", "surfing"}, &buffer)
+	if !strings.Contains(buffer.String(), "habit 'surfing' not found") {
+		t.Errorf("want show to report unknown habits, got:\n%s", buffer.String())
+	}
+}
+
 func TestRunCLIShowsErrorUsageHelpInvalidFrequency(t *testing.T) {
 	t.Parallel()
 	args := []string{"-f", "yellow", "piano"}
@@ -166,8 +217,21 @@ func TestRunServerStartsServer(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	storeDir := t.TempDir()
+	store, err := habit.OpenDBStore(storeDir + "/.habitTracker.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, secret, err := habit.NewToken(habit.DefaultUser(), "test", habit.CheckInScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.(habit.TokenStore).CreateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
 	address := fmt.Sprintf("%s:%d", localHostAddress, freePort)
-	args := []string{address}
+	args := []string{"-d", storeDir, address}
 	output := bytes.Buffer{}
 	go habit.RunServer(args, &output)
 
@@ -176,8 +240,21 @@ func TestRunServerStartsServer(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Want Status %d without a token, got: %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, address, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+secret)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if resp.StatusCode != http.StatusOK {
-		t.Errorf("Want Status %d, got: %d", http.StatusNotFound, resp.StatusCode)
+		t.Errorf("Want Status %d, got: %d", http.StatusOK, resp.StatusCode)
 	}
 
 	want := "piano"
@@ -189,6 +266,91 @@ func TestRunServerStartsServer(t *testing.T) {
 		t.Errorf("want response body to be:\n %s \ngot:\n %s", want, got)
 	}
 }
+
+func TestRunServerNoAuthServesWithoutToken(t *testing.T) {
+	t.Parallel()
+	freePort, err := freeport.GetFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := fmt.Sprintf("%s:%d", localHostAddress, freePort)
+	args := []string{"-d", t.TempDir(), "-no-auth", address}
+	output := bytes.Buffer{}
+	go habit.RunServer(args, &output)
+
+	resp, err := retryHttpGet("http://" + address + "/all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Want Status %d, got: %d", http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestRunCLITokenCreateListRevoke(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", tmpDir, "token", "create", "-scope", "checkin", "-name", "laptop"}, &buffer)
+	got := buffer.String()
+	if !strings.Contains(got, "Created checkin token") {
+		t.Fatalf("want token create to report the new token, got:\n%s", got)
+	}
+	lines := strings.Split(strings.TrimSpace(got), "\n")
+	secret := lines[len(lines)-1]
+
+	store, err := habit.OpenDBStore(tmpDir + "/.habitTracker.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := store.(habit.TokenStore).GetToken(habit.HashToken(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == nil {
+		t.Fatal("want printed secret to authenticate the stored token")
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "token", "list"}, &buffer)
+	got = buffer.String()
+	if !strings.Contains(got, token.ID) || !strings.Contains(got, "laptop") || strings.Contains(got, secret) {
+		t.Errorf("want token list to show id and name but not the secret, got:\n%s", got)
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "token", "revoke", token.ID}, &buffer)
+	if !strings.Contains(buffer.String(), "Revoked token") {
+		t.Errorf("want token revoke to confirm, got:\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "token", "list"}, &buffer)
+	if !strings.Contains(buffer.String(), "no tokens have been created") {
+		t.Errorf("want revoked token to be removed, got:\n%s", buffer.String())
+	}
+}
+
+func TestRunCLITokenShowsErrorOnWrongArgs(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"token"}, want: "missing token command"},
+		{args: []string{"token", "rotate"}, want: "unknown token command"},
+		{args: []string{"token", "create", "-scope", "admin"}, want: "unknown scope"},
+		{args: []string{"token", "revoke", "nope"}, want: "token not found"},
+	}
+	for _, tc := range testCases {
+		buffer := bytes.Buffer{}
+		habit.RunCLI(append([]string{"-d", t.TempDir()}, tc.args...), &buffer)
+		if !strings.Contains(buffer.String(), tc.want) {
+			t.Errorf("want %v to fail with %s, got:\n%s", tc.args, tc.want, buffer.String())
+		}
+	}
+}
+
 func retryHttpGet(address string) (*http.Response, error) {
 	resp, err := http.Get(address)
 	for err != nil {
@@ -202,3 +364,457 @@ func retryHttpGet(address string) (*http.Response, error) {
 	}
 	return resp, nil
 }
+
+func TestRunCLILogsAmountsTowardTarget(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", tmpDir, "-target", "30m", "read"}, &buffer)
+	if !strings.Contains(buffer.String(), "You've logged 1 of 30 m for 'read' today") {
+		t.Fatalf("want new habit to log one unit, got:\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "read", "-amount", "20m"}, &buffer)
+	if !strings.Contains(buffer.String(), "You've logged 21 of 30 m for 'read' today, 9 m to go.") {
+		t.Errorf("want amount flag after the habit name to be logged, got:\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "show", "read"}, &buffer)
+	if !strings.Contains(buffer.String(), "Target: 30 m\nProgress: 21 of 30 m\n") {
+		t.Errorf("want show to display the target and progress, got:\n%s", buffer.String())
+	}
+
+	testCases := [][]string{
+		{"-d", tmpDir, "read", "-amount", "2km"},
+		{"-d", tmpDir, "read", "-amount", "lots"},
+		{"-d", tmpDir, "-target", "5km", "-unit", "miles", "run"},
+		{"-d", tmpDir, "read", "surfing"},
+	}
+	for _, args := range testCases {
+		buffer.Reset()
+		habit.RunCLI(args, &buffer)
+		if strings.Contains(buffer.String(), "logged") {
+			t.Errorf("want %v to fail, got:\n%s", args, buffer.String())
+		}
+	}
+}
+
+func TestRunCLICreatesQuitHabit(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", tmpDir, "-kind", "quit", "smoking"}, &buffer)
+	if !strings.Contains(buffer.String(), "Good luck quitting 'smoking'!") {
+		t.Fatalf("want quit habit to be created, got:\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "smoking"}, &buffer)
+	if !strings.Contains(buffer.String(), "You slipped on 'smoking' after 0 days") {
+		t.Errorf("want check in to record a slip, got:\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "-kind", "stop", "sugar"}, &buffer)
+	if !strings.Contains(buffer.String(), "unknown habit kind: stop") {
+		t.Errorf("want unknown kind error, got:\n%s", buffer.String())
+	}
+}
+
+func TestRunCLICreatesHabitWithGracePeriod(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", tmpDir, "-grace", "1", "piano"}, &buffer)
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "show", "piano"}, &buffer)
+	if !strings.Contains(buffer.String(), "Grace period: 1 days late once a week\n") {
+		t.Errorf("want show to display the grace period, got:\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "-grace", "-1", "surfing"}, &buffer)
+	if !strings.Contains(buffer.String(), "grace period cannot be negative") {
+		t.Errorf("want negative grace period to fail, got:\n%s", buffer.String())
+	}
+}
+
+func TestRunCLIPausesAndResumesHabits(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", tmpDir, "piano"}, &buffer)
+	habit.RunCLI([]string{"-d", tmpDir, "surfing"}, &buffer)
+
+	buffer.Reset()
+	until := time.Now().AddDate(0, 0, 7).Format("2006-01-02")
+	habit.RunCLI([]string{"-d", tmpDir, "pause", "piano", "-until", until}, &buffer)
+	if want := "Paused 'piano' until " + until + ".\n"; buffer.String() != want {
+		t.Errorf("want %q, got %q", want, buffer.String())
+	}
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "all"}, &buffer)
+	if !strings.Contains(buffer.String(), "'piano' is paused until "+until) {
+		t.Errorf("want listing to show piano as paused, got:\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "pause", "-all"}, &buffer)
+	if want := "Paused 'surfing' until you resume it.\n"; buffer.String() != want {
+		t.Errorf("want %q, got %q", want, buffer.String())
+	}
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "resume", "-all"}, &buffer)
+	if want := "Resumed 'piano'.\nResumed 'surfing'.\n"; buffer.String() != want {
+		t.Errorf("want %q, got %q", want, buffer.String())
+	}
+
+	testCases := []struct {
+		args    []string
+		wantErr string
+	}{
+		{[]string{"pause"}, "pause takes a habit name or -all"},
+		{[]string{"pause", "-all", "piano"}, "pause takes a habit name or -all"},
+		{[]string{"pause", "piano", "surfing"}, "pause takes at most one habit name"},
+		{[]string{"pause", "-until", "tomorrow", "piano"}, "invalid date tomorrow, expected YYYY-MM-DD"},
+		{[]string{"resume", "piano"}, "habit 'piano' is not paused"},
+	}
+	for _, tc := range testCases {
+		buffer.Reset()
+		habit.RunCLI(append([]string{"-d", tmpDir}, tc.args...), &buffer)
+		if !strings.Contains(buffer.String(), tc.wantErr) {
+			t.Errorf("%v: want %q, got:\n%s", tc.args, tc.wantErr, buffer.String())
+		}
+	}
+}
+
+func TestRunCLIDueListsHabitsAndSetsExitCode(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	status := habit.RunCLI([]string{"-d", tmpDir, "due"}, &buffer)
+	if status != 0 || buffer.String() != "no habits have been started\n" {
+		t.Errorf("want status 0 and no habits, got %d:\n%s", status, buffer.String())
+	}
+
+	habit.RunCLI([]string{"-d", tmpDir, "piano"}, &buffer)
+	buffer.Reset()
+	status = habit.RunCLI([]string{"-d", tmpDir, "today", "-exit-code"}, &buffer)
+	if status != 0 || !strings.HasPrefix(buffer.String(), "'piano' is done until ") {
+		t.Errorf("want status 0 with piano done, got %d:\n%s", status, buffer.String())
+	}
+
+	habit.RunCLI([]string{"-d", tmpDir, "-target", "8", "water"}, &buffer)
+	buffer.Reset()
+	status = habit.RunCLI([]string{"-d", tmpDir, "due", "-exit-code"}, &buffer)
+	if status != 1 || !strings.HasPrefix(buffer.String(), "'water' is due today") {
+		t.Errorf("want status 1 with water due first, got %d:\n%s", status, buffer.String())
+	}
+	status = habit.RunCLI([]string{"-d", tmpDir, "due"}, &buffer)
+	if status != 0 {
+		t.Errorf("want status 0 without -exit-code, got %d", status)
+	}
+
+	buffer.Reset()
+	status = habit.RunCLI([]string{"-d", tmpDir, "due", "piano"}, &buffer)
+	if status != 2 || !strings.Contains(buffer.String(), "due takes no arguments") {
+		t.Errorf("want status 2 and an error, got %d:\n%s", status, buffer.String())
+	}
+}
+
+func TestRunCLIRemindRunsCommand(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", tmpDir, "-target", "8", "water"}, &buffer)
+
+	path := filepath.Join(tmpDir, "reminder")
+	remind := []string{"-d", tmpDir, "remind", "-desktop=false", "-before", "0", "-sent",
+		filepath.Join(tmpDir, "sent.json"), "-exec", "echo $HABIT_NAME >> " + path}
+	buffer.Reset()
+	status := habit.RunCLI(remind, &buffer)
+	if status != 0 || !strings.Contains(buffer.String(), "'water' is due today") {
+		t.Errorf("want water to be reminded, got %d:\n%s", status, buffer.String())
+	}
+	//a second run, as by cron, remembers the reminder sent by the first
+	buffer.Reset()
+	status = habit.RunCLI(append([]string{"-o", "json"}, remind...), &buffer)
+	if status != 0 || strings.TrimSpace(buffer.String()) != "[]" {
+		t.Errorf("want no reminders to be sent again, got %d:\n%s", status, buffer.String())
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "water\n" {
+		t.Errorf("want command to run once, got %q", got)
+	}
+
+	buffer.Reset()
+	status = habit.RunCLI([]string{"-d", tmpDir, "remind", "-desktop=false"}, &buffer)
+	if status != 2 || !strings.Contains(buffer.String(), "no notifiers") {
+		t.Errorf("want an error without notifiers, got %d:\n%s", status, buffer.String())
+	}
+}
+
+func TestRunCLIPostsWebhooks(t *testing.T) {
+	t.Parallel()
+	receiver := newWebhookReceiver(t, "s3cret", 0)
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	status := habit.RunCLI([]string{"-d", tmpDir, "-webhook", receiver.URL, "-webhook-secret", "s3cret",
+		"-webhook-queue", filepath.Join(tmpDir, "queue.json"), "piano"}, &buffer)
+	if status != 0 {
+		t.Fatalf("want status 0, got %d:\n%s", status, buffer.String())
+	}
+	events, _ := receiver.received()
+	if len(events) != 1 || events[0].Type != habit.HabitCreatedEvent {
+		t.Errorf("want habit created event to be posted, got %+v", events)
+	}
+}
+
+func TestRunCLIRecordsNotesAndRatings(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", tmpDir, "piano"}, &buffer)
+	status := habit.RunCLI([]string{"-d", tmpDir, "piano", "-note", "scales in C", "-rating", "4"}, &buffer)
+	if status != 0 {
+		t.Fatalf("want check-in with a note to succeed, got:\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "show", "piano"}, &buffer)
+	if !regexp.MustCompile(`Notes:\n  \d{4}-\d\d-\d\d \d\d:\d\d  4/5  scales in C\n`).MatchString(buffer.String()) {
+		t.Errorf("want show to list the note, got:\n%s", buffer.String())
+	}
+
+	testCases := []struct {
+		args    []string
+		wantErr string
+	}{
+		{[]string{"piano", "-rating", "6"}, "rating must be between 1 and 5"},
+		{[]string{"surfing", "-note", "first wave"}, "habit 'surfing' does not exist yet"},
+	}
+	for _, tc := range testCases {
+		buffer.Reset()
+		status := habit.RunCLI(append([]string{"-d", tmpDir}, tc.args...), &buffer)
+		if status != 2 || !strings.Contains(buffer.String(), tc.wantErr) {
+			t.Errorf("%v: want error %q, got %d:\n%s", tc.args, tc.wantErr, status, buffer.String())
+		}
+	}
+}
+
+func TestRunCLITagsHabitsAndFiltersListing(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", tmpDir, "piano"}, &buffer)
+	habit.RunCLI([]string{"-d", tmpDir, "surfing"}, &buffer)
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "tag", "add", "surfing", "health", "outdoors"}, &buffer)
+	if want := "Tagged 'surfing' health, outdoors.\n"; buffer.String() != want {
+		t.Errorf("want %q, got %q", want, buffer.String())
+	}
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "tag", "remove", "surfing", "outdoors"}, &buffer)
+	if want := "Untagged 'surfing' outdoors.\n"; buffer.String() != want {
+		t.Errorf("want %q, got %q", want, buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "all", "-tag", "health"}, &buffer)
+	if !strings.Contains(buffer.String(), "surfing") || strings.Contains(buffer.String(), "piano") {
+		t.Errorf("want only surfing to be listed, got:\n%s", buffer.String())
+	}
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "show", "surfing"}, &buffer)
+	if !strings.Contains(buffer.String(), "Tags: health\n") {
+		t.Errorf("want show to list the tags, got:\n%s", buffer.String())
+	}
+
+	for _, args := range [][]string{{"tag"}, {"tag", "add", "piano"}, {"tag", "rename", "piano", "music"}} {
+		buffer.Reset()
+		status := habit.RunCLI(append([]string{"-d", tmpDir}, args...), &buffer)
+		if status != 2 || !strings.Contains(buffer.String(), "tag takes add or remove, a habit name and tags") {
+			t.Errorf("%v: want usage error, got %d:\n%s", args, status, buffer.String())
+		}
+	}
+}
+
+func TestRunCLIAllSortsFiltersAndPages(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	for _, name := range []string{"surfing", "piano", "reading"} {
+		habit.RunCLI([]string{"-d", tmpDir, name}, &buffer)
+	}
+	habit.RunCLI([]string{"-d", tmpDir, "-f", "weekly", "chess"}, &buffer)
+
+	testCases := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"all"}, []string{"chess", "piano", "reading", "surfing"}},
+		{[]string{"all", "-desc", "-limit", "2"}, []string{"surfing", "reading"}},
+		{[]string{"all", "-frequency", "weekly"}, []string{"chess"}},
+		{[]string{"all", "-sort", "due", "-offset", "3"}, []string{"chess"}},
+		{[]string{"all", "-status", "paused"}, nil},
+	}
+	for _, tc := range testCases {
+		buffer.Reset()
+		habit.RunCLI(append([]string{"-d", tmpDir}, tc.args...), &buffer)
+		got := regexp.MustCompile(`'(\w+)'`).FindAllStringSubmatch(buffer.String(), -1)
+		var names []string
+		for _, match := range got {
+			names = append(names, match[1])
+		}
+		if strings.Join(names, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%v: want %v, got:\n%s", tc.args, tc.want, buffer.String())
+		}
+	}
+
+	for _, args := range [][]string{{"all", "-sort", "size"}, {"all", "-status", "late"}, {"all", "-limit", "-1"},
+		{"all", "-frequency", "monthly"}} {
+		buffer.Reset()
+		status := habit.RunCLI(append([]string{"-d", tmpDir}, args...), &buffer)
+		if status != 2 {
+			t.Errorf("%v: want invalid listing options to fail, got %d:\n%s", args, status, buffer.String())
+		}
+	}
+}
+
+func TestRunCLISubcommandsCreateLogListAndDeleteHabits(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	status := habit.RunCLI([]string{"-d", tmpDir, "new", "all", "-f", "weekly"}, &buffer)
+	if status != 0 || !strings.Contains(buffer.String(), "Good luck with your new habit 'all'") {
+		t.Fatalf("want new to create a habit named all, got %d:\n%s", status, buffer.String())
+	}
+	buffer.Reset()
+	status = habit.RunCLI([]string{"-d", tmpDir, "log", "all", "-note", "chores"}, &buffer)
+	if status != 0 || !strings.Contains(buffer.String(), "You already logged 'all'") {
+		t.Errorf("want log to check in the habit, got %d:\n%s", status, buffer.String())
+	}
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "list", "-frequency", "weekly"}, &buffer)
+	if !strings.Contains(buffer.String(), "'all'") {
+		t.Errorf("want list to show the habit, got:\n%s", buffer.String())
+	}
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "show", "all"}, &buffer)
+	if got := buffer.String(); !strings.Contains(got, "Habit: all\nFrequency: weekly\n") || !strings.Contains(got, "chores") {
+		t.Errorf("want show to describe the habit, got:\n%s", buffer.String())
+	}
+
+	testCases := []struct {
+		args    []string
+		wantErr string
+	}{
+		{[]string{"new", "all"}, "habit 'all' already exists, check it in with habit log all"},
+		{[]string{"log", "pian"}, "habit 'pian' not found, create it with habit new pian"},
+		{[]string{"log"}, "log takes exactly one habit name"},
+		{[]string{"log", "all", "-f", "daily"}, "flag provided but not defined: -f"},
+		{[]string{"list", "piano"}, "list takes no arguments"},
+		{[]string{"delete", "surfing"}, "habit 'surfing' not found"},
+	}
+	for _, tc := range testCases {
+		buffer.Reset()
+		status := habit.RunCLI(append([]string{"-d", tmpDir}, tc.args...), &buffer)
+		if status != 2 || !strings.Contains(buffer.String(), tc.wantErr) {
+			t.Errorf("%v: want error %q, got %d:\n%s", tc.args, tc.wantErr, status, buffer.String())
+		}
+	}
+
+	buffer.Reset()
+	status = habit.RunCLI([]string{"-d", tmpDir, "delete", "all"}, &buffer)
+	if status != 0 || buffer.String() != "Deleted 'all' and its history.\n" {
+		t.Errorf("want delete to confirm, got %d:\n%s", status, buffer.String())
+	}
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "all"}, &buffer)
+	if buffer.String() != "no habits have been started\n" {
+		t.Errorf("want deleted habit not to be listed, got:\n%s", buffer.String())
+	}
+}
+
+func TestRunCLIHelpShowsCommandUsage(t *testing.T) {
+	t.Parallel()
+	buffer := bytes.Buffer{}
+	status := habit.RunCLI([]string{"help"}, &buffer)
+	if status != 0 || !strings.Contains(buffer.String(), "Commands:") || !strings.Contains(buffer.String(), "delete") {
+		t.Errorf("want help to list the commands, got %d:\n%s", status, buffer.String())
+	}
+
+	buffer.Reset()
+	status = habit.RunCLI([]string{"help", "log"}, &buffer)
+	got := buffer.String()
+	if status != 0 || !strings.HasPrefix(got, "Usage: habit <Global Flags> log <HABIT_NAME> [flags]\n") ||
+		!strings.Contains(got, "-amount") || strings.Contains(got, "-target") || strings.Contains(got, "-store") {
+		t.Errorf("want help log to show only the flags of log, got %d:\n%s", status, got)
+	}
+
+	buffer.Reset()
+	status = habit.RunCLI([]string{"help", "all"}, &buffer)
+	if status != 0 || !strings.Contains(buffer.String(), "Aliases: list, all") {
+		t.Errorf("want help to find commands by alias, got %d:\n%s", status, buffer.String())
+	}
+
+	buffer.Reset()
+	status = habit.RunCLI([]string{"help", "fly"}, &buffer)
+	if status != 2 || !strings.Contains(buffer.String(), "unknown command fly") {
+		t.Errorf("want unknown commands to fail, got %d:\n%s", status, buffer.String())
+	}
+}
+
+func TestRunCLINewSetsDescriptionStartAndFirstCheckIn(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	start := time.Now().AddDate(0, 0, -2).Format("2006-01-02")
+	buffer := bytes.Buffer{}
+	status := habit.RunCLI([]string{"-d", tmpDir, "new", "piano", "-checkin=false", "-start", start, "-description",
+		"scales and arpeggios"}, &buffer)
+	if status != 0 || !strings.Contains(buffer.String(), "Check it in to start your streak") {
+		t.Fatalf("want new to create a habit due on its start, got %d:\n%s", status, buffer.String())
+	}
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "show", "piano"}, &buffer)
+	if !strings.Contains(buffer.String(), "Description: scales and arpeggios\n") ||
+		!strings.Contains(buffer.String(), "Due: "+start) || strings.Contains(buffer.String(), "Last check-in") {
+		t.Errorf("want show to print the description and the start as due, got:\n%s", buffer.String())
+	}
+
+	testCases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"new", "chess", "-start", "yesterday"}, "invalid date yesterday, expected YYYY-MM-DD"},
+		{[]string{"new", "chess", "-checkin=false", "-note", "opening"}, "cannot be combined with -checkin=false"},
+	}
+	for _, tc := range testCases {
+		buffer.Reset()
+		status := habit.RunCLI(append([]string{"-d", tmpDir}, tc.args...), &buffer)
+		if status != 2 || !strings.Contains(buffer.String(), tc.want) {
+			t.Errorf("%v: want usage error %q, got %d:\n%s", tc.args, tc.want, status, buffer.String())
+		}
+	}
+}
+
+func TestRunCLIAcceptsGlobalFlagsAfterCommand(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	status := habit.RunCLI([]string{"new", "piano", "-d", tmpDir, "-u", "alice"}, &buffer)
+	if status != 0 {
+		t.Fatalf("want new to accept global flags, got %d:\n%s", status, buffer.String())
+	}
+	buffer.Reset()
+	habit.RunCLI([]string{"-u", "alice", "-sort", "streak", "list", "-d", tmpDir, "-o", "tsv"}, &buffer)
+	if !strings.HasPrefix(buffer.String(), "Name\t") || !strings.Contains(buffer.String(), "\npiano\talice\t") {
+		t.Errorf("want list to print alice's habits as tsv, got:\n%s", buffer.String())
+	}
+}
@@ -6,5 +6,5 @@ import (
 )
 
 func main() {
-	habit.RunCLI(os.Args[1:], os.Stdout)
+	os.Exit(habit.RunCLI(os.Args[1:], os.Stdout))
 }
@@ -0,0 +1,833 @@
+package habit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//cliCommand is a command of the habit CLI
+type cliCommand struct {
+	name    string
+	aliases []string
+	//args describes the arguments of the command in its usage
+	args    string
+	summary string
+	//hidden commands are left out of the usage
+	hidden bool
+	//setup defines the command's flags on flagSet and returns the function running the command with the arguments
+	//left after the flags. The function returns the exit status, errors exit with exitError.
+	setup func(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error)
+}
+
+//commands returns the commands of the habit CLI in the order of its usage
+func commands() []*cliCommand {
+	return []*cliCommand{
+		{name: "new", args: "<HABIT_NAME>", summary: "Create a habit, its first check-in starts the streak",
+			setup: setupNew},
+		{name: "log", args: "<HABIT_NAME>", summary: "Check in a habit, logging an amount, a note or a rating",
+			setup: setupLog},
+		{name: "list", aliases: []string{"all"}, summary: "List all habits, or the ones matching the flags",
+			setup: setupList},
+		{name: "show", args: "<HABIT_NAME>", summary: "Show the details and last result of a habit", setup: setupShow},
+		{name: "delete", args: "<HABIT_NAME>", summary: "Delete a habit and its history", setup: setupDelete},
+		{name: "today", aliases: []string{"due"}, summary: "List which habits are due today or overdue, the most " +
+			"urgent first", setup: setupDue},
+		{name: "remind", summary: "Remind you of habits due today or overdue", setup: setupRemind},
+		{name: "pause", args: "<HABIT_NAME>|-all", summary: "Pause a habit, or all of them", setup: setupPause},
+		{name: "resume", args: "<HABIT_NAME>|-all", summary: "Resume a paused habit, or all of them",
+			setup: setupPause},
+		{name: "tag", args: "add|remove <HABIT_NAME> <TAG>...", summary: "Tag a habit or remove its tags",
+			setup: setupTag},
+		{name: "token", args: "create|list|revoke [TOKEN_ID]", summary: "Manage the server's API tokens",
+			setup: setupToken},
+		{name: "sync", args: "<STORE_DSN>|<STORE_TYPE> <STORE_DIR>", summary: "Merge the habits of another store " +
+			"into this one and back", setup: setupSync},
+		{name: "config", args: "show", summary: "Show the settings read from the config file, the environment and " +
+			"the flags", setup: setupConfig},
+		{name: "completion", args: "bash|zsh|fish", summary: "Print the script completing commands, flags and " +
+			"habit names in your shell", setup: setupCompletion},
+		{name: "help", args: "[COMMAND]", summary: "Show the usage of habit or of a command", setup: setupHelp},
+		{name: completeCommand, hidden: true, setup: setupComplete},
+	}
+}
+
+//findCommand returns the command with the given name or alias, or nil if there is none
+func findCommand(name string) *cliCommand {
+	for _, command := range commands() {
+		if command.name == name {
+			return command
+		}
+		for _, alias := range command.aliases {
+			if alias == name {
+				return command
+			}
+		}
+	}
+	return nil
+}
+
+//shortcutCommand returns habit <HABIT_NAME>, which creates the habit like new or checks it in like log
+func shortcutCommand() *cliCommand {
+	return &cliCommand{args: "<HABIT_NAME>", setup: setupShortcut}
+}
+
+//habitOptions are the flags of a new habit and its first check-in
+type habitOptions struct {
+	frequency *string
+	kind      *string
+	grace     *int
+	target    *string
+	unit      *string
+	checkIn   *checkInOptions
+}
+
+func habitFlags(flagSet *flag.FlagSet) *habitOptions {
+	return &habitOptions{
+		frequency: flagSet.String("f", "daily", "Set the frequency of the habit: daily, weekly."),
+		kind: flagSet.String("kind", "build", "Set the kind of a new habit: build, or quit to count the periods "+
+			"since you last slipped."),
+		grace: flagSet.Int("grace", 0, "Set how many days late a new habit can be checked in, once a week, "+
+			"without losing its streak."),
+		target:  flagSet.String("target", "", "Set a target amount per period for a new habit, e.g. 8, 5km or 30m."),
+		unit:    flagSet.String("unit", "", "Set the unit of the habit's target, e.g. glasses."),
+		checkIn: checkInFlags(flagSet),
+	}
+}
+
+//habit returns the habit described by the flags and the amount of its first check-in
+func (o *habitOptions) habit(name, user string) (*Habit, CheckIn, error) {
+	h, err := parseHabit(name, *o.frequency)
+	if err != nil {
+		return nil, CheckIn{}, usageError{err}
+	}
+	h.User = user
+	h.Kind, err = parseKind(*o.kind)
+	if err != nil {
+		return nil, CheckIn{}, usageError{err}
+	}
+	h.GraceDays = *o.grace
+	amount, err := parseQuantity(h, *o.target, *o.unit, *o.checkIn.amount)
+	if err != nil {
+		return nil, CheckIn{}, usageError{err}
+	}
+	return h, CheckIn{Amount: amount, Note: *o.checkIn.note, Rating: *o.checkIn.rating}, nil
+}
+
+//checkInOptions are the flags of a check-in
+type checkInOptions struct {
+	amount *string
+	note   *string
+	rating *int
+}
+
+func checkInFlags(flagSet *flag.FlagSet) *checkInOptions {
+	return &checkInOptions{
+		amount: flagSet.String("amount", "", "Log an amount toward the habit's target, e.g. 2, 1.5km or 20m. "+
+			"Defaults to 1."),
+		note:   flagSet.String("note", "", "Add a note to the check-in, e.g. what you practiced."),
+		rating: flagSet.Int("rating", 0, "Rate how the check-in went from 1 to 5."),
+	}
+}
+
+//habitName returns the only argument of a command taking a habit name
+func habitName(command string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", usageErrorf("%s takes exactly one habit name", command)
+	}
+	return args[0], nil
+}
+
+//printHabit prints the result of creating or checking in a habit
+func (c *cli) printHabit(h *Habit) (int, error) {
+	err := c.printer.print(newHabitOutput(h, c.calendar, time.Now()), h.String())
+	if err != nil {
+		return exitError, err
+	}
+	return exitOK, nil
+}
+
+func setupShortcut(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error) {
+	options := habitFlags(flagSet)
+	yes := flagSet.Bool("y", false, "Log the closest existing habit when the name is a likely typo of it.")
+	strict := flagSet.Bool("strict", false, "Create the habit when the name is close to an existing one, without "+
+		"asking.")
+	return func(args []string) (int, error) {
+		if len(args) != 1 {
+			return exitError, usageErrorf("too many args")
+		}
+		if *yes && *strict {
+			return exitError, usageErrorf("-y and -strict cannot be combined")
+		}
+		h, checkIn, err := options.habit(args[0], *c.options.user)
+		if err != nil {
+			return exitError, err
+		}
+		controller, err := c.open()
+		if err != nil {
+			return exitError, err
+		}
+		if !*strict {
+			h.Name, err = c.confirmName(controller, h.User, h.Name, *yes)
+			if err != nil {
+				return exitError, err
+			}
+		}
+		h, err = controller.HandleCheckIn(h, checkIn)
+		if err != nil {
+			return exitError, err
+		}
+		return c.printHabit(h)
+	}
+}
+
+//confirmName returns the name of the habit to log: name if it exists or nothing is close to it, otherwise the closest
+//habit if yes is set or the user confirms it. Without a terminal to ask on, a close name is an error.
+func (c *cli) confirmName(controller Controller, user, name string, yes bool) (string, error) {
+	existing, err := controller.Store.Get(user, name)
+	if err != nil || existing != nil {
+		return name, err
+	}
+	suggestions, err := controller.SuggestHabits(user, name)
+	if err != nil || len(suggestions) == 0 {
+		return name, err
+	}
+	if yes {
+		return suggestions[0], nil
+	}
+	if !isTerminal(c.input) || !isTerminal(c.output) {
+		return "", fmt.Errorf("habit '%s' not found, %s Pass -y to log '%s' or -strict to create '%s'", name,
+			didYouMean(suggestions), suggestions[0], name)
+	}
+	fmt.Fprintf(c.output, "No habit named '%s', %s Log '%s' instead of creating '%s'? [Y/n] ", name,
+		didYouMean(suggestions), suggestions[0], name)
+	answer, err := bufio.NewReader(c.input).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "", "y", "yes":
+		return suggestions[0], nil
+	case "n", "no":
+		return name, nil
+	}
+	return "", fmt.Errorf("unexpected answer %q, nothing was logged", strings.TrimSpace(answer))
+}
+
+//isTerminal returns whether the input or output is an interactive terminal
+func isTerminal(stream interface{}) bool {
+	file, ok := stream.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func setupNew(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error) {
+	options := habitFlags(flagSet)
+	description := flagSet.String("description", "", "Describe what the habit is about.")
+	start := flagSet.String("start", "", "Start the habit on an earlier date, YYYY-MM-DD, to backfill its check-ins "+
+		"since. Defaults to today.")
+	done := flagSet.Bool("checkin", true, "Count the creation as the first check-in, starting the streak. Pass "+
+		"-checkin=false to have the habit due on the day it starts instead.")
+	return func(args []string) (int, error) {
+		name, err := habitName(flagSet.Name(), args)
+		if err != nil {
+			return exitError, err
+		}
+		h, checkIn, err := options.habit(name, *c.options.user)
+		if err != nil {
+			return exitError, err
+		}
+		startTime, err := c.calendar.parseDate(*start)
+		if err != nil {
+			return exitError, usageError{err}
+		}
+		if !*done && (*options.checkIn.amount != "" || checkIn.Note != "" || checkIn.Rating != 0) {
+			return exitError, usageErrorf("-amount, -note and -rating describe the first check-in, they cannot be " +
+				"combined with -checkin=false")
+		}
+		controller, err := c.open()
+		if err != nil {
+			return exitError, err
+		}
+		existing, err := controller.Store.Get(h.User, h.Name)
+		if err != nil {
+			return exitError, err
+		}
+		if existing != nil {
+			return exitError, fmt.Errorf("habit '%s' already exists, check it in with habit log %s", name, name)
+		}
+		createOptions := CreateOptions{Frequency: h.Frequency, Kind: h.Kind, GraceDays: h.GraceDays,
+			Target: h.Target, Unit: h.Unit, Description: *description, Start: startTime}
+		if *done && h.Kind != QuitHabit {
+			createOptions.FirstCheckIn = &checkIn
+		}
+		h, err = controller.Create(h.User, h.Name, createOptions)
+		if err != nil {
+			return exitError, err
+		}
+		return c.printHabit(h)
+	}
+}
+
+func setupLog(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error) {
+	options := checkInFlags(flagSet)
+	return func(args []string) (int, error) {
+		name, err := habitName(flagSet.Name(), args)
+		if err != nil {
+			return exitError, err
+		}
+		input := &Habit{Name: name, User: *c.options.user}
+		amount, err := parseQuantity(input, "", "", *options.amount)
+		if err != nil {
+			return exitError, usageError{err}
+		}
+		controller, err := c.open()
+		if err != nil {
+			return exitError, err
+		}
+		existing, err := controller.Store.Get(input.User, input.Name)
+		if err != nil {
+			return exitError, err
+		}
+		if existing == nil {
+			suggestions, err := controller.SuggestHabits(input.User, name)
+			if err == nil && len(suggestions) > 0 {
+				return exitError, fmt.Errorf("habit '%s' not found, %s Create it with habit new %s otherwise", name,
+					didYouMean(suggestions), name)
+			}
+			return exitError, fmt.Errorf("habit '%s' not found, create it with habit new %s", name, name)
+		}
+		if input.Unit != "" && input.Unit != existing.Unit {
+			return exitError, fmt.Errorf("habit '%s' is measured in %s, not %s", existing.Name,
+				unitName(existing.Unit), input.Unit)
+		}
+		h, err := controller.CheckIn(input.User, input.Name, CheckIn{Amount: amount, Note: *options.note,
+			Rating: *options.rating})
+		if err != nil {
+			return exitError, err
+		}
+		return c.printHabit(h)
+	}
+}
+
+func setupList(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error) {
+	tag := flagSet.String("tag", "", "List only the habits with the tag.")
+	frequency := flagSet.String("frequency", "", "List only the daily or weekly habits.")
+	status := flagSet.String("status", "", "List only the habits that are overdue, due, broken, done or paused.")
+	sortBy := flagSet.String("sort", "name", "Sort listed habits by name, streak or due date: name, streak, due.")
+	descending := flagSet.Bool("desc", false, "Sort listed habits in descending order.")
+	limit := flagSet.Int("limit", 0, "List at most this many habits.")
+	offset := flagSet.Int("offset", 0, "Skip this many habits before listing.")
+	return func(args []string) (int, error) {
+		if len(args) > 0 {
+			return exitError, usageErrorf("%s takes no arguments", flagSet.Name())
+		}
+		query, err := parseHabitQuery(*c.options.user, *tag, *frequency, *status, *sortBy, *descending, *limit,
+			*offset)
+		if err != nil {
+			return exitError, usageError{err}
+		}
+		controller, err := c.open()
+		if err != nil {
+			return exitError, err
+		}
+		var (
+			habits []*Habit
+			text   string
+		)
+		if c.printer.structured() {
+			query.Calendar = controller.Calendar
+			habits, err = controller.Store.ListHabits(query)
+		} else {
+			text, err = controller.GetHabits(query)
+		}
+		if err != nil {
+			return exitError, err
+		}
+		return exitOK, c.printer.print(newHabitsOutput(habits, c.calendar), text)
+	}
+}
+
+func setupConfig(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error) {
+	return func(args []string) (int, error) {
+		if len(args) != 1 || args[0] != "show" {
+			return exitError, usageErrorf("%s takes show as its only argument", flagSet.Name())
+		}
+		return exitOK, c.printer.print(newConfigOutput(c.config), c.config.format())
+	}
+}
+
+func setupShow(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error) {
+	return func(args []string) (int, error) {
+		name, err := habitName(flagSet.Name(), args)
+		if err != nil {
+			return exitError, err
+		}
+		controller, err := c.open()
+		if err != nil {
+			return exitError, err
+		}
+		var (
+			h       *Habit
+			details string
+			data    habitDetailsOutput
+		)
+		if c.printer.structured() {
+			h, err = controller.getHabit(*c.options.user, name)
+		} else {
+			details, err = controller.ShowHabit(*c.options.user, name)
+		}
+		if err != nil {
+			return exitError, err
+		}
+		if h != nil {
+			data = newHabitDetailsOutput(h, c.calendar, time.Now())
+		}
+		return exitOK, c.printer.print(data, strings.TrimSuffix(details, "\n"))
+	}
+}
+
+func setupDelete(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error) {
+	return func(args []string) (int, error) {
+		name, err := habitName(flagSet.Name(), args)
+		if err != nil {
+			return exitError, err
+		}
+		controller, err := c.open()
+		if err != nil {
+			return exitError, err
+		}
+		h, err := controller.getHabit(*c.options.user, name)
+		if err != nil {
+			return exitError, err
+		}
+		err = controller.DeleteHabit(h.User, h.Name)
+		if err != nil {
+			return exitError, err
+		}
+		text := fmt.Sprintf("Deleted '%s' and its history.", h.Name)
+		return exitOK, c.printer.print(newHabitOutput(h, c.calendar, time.Now()), text)
+	}
+}
+
+func setupSync(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error) {
+	stateFile := flagSet.String("state", filepath.Join(c.dataDir, ".habitSync.json"), "Set the file keeping when "+
+		"stores were last synced, so that habits deleted from one store are not copied back.")
+	return func(args []string) (int, error) {
+		var otherDSN string
+		switch len(args) {
+		case 1:
+			otherDSN = args[0]
+		case 2:
+			var err error
+			otherDSN, err = legacyStoreDSN(args[0], args[1])
+			if err != nil {
+				return exitError, usageError{err}
+			}
+		default:
+			return exitError, usageErrorf("sync takes a store DSN, or a store type and a store directory")
+		}
+		controller, err := c.open()
+		if err != nil {
+			return exitError, err
+		}
+		token := *c.options.token
+		if token == "" {
+			token = os.Getenv("HABIT_TOKEN")
+		}
+		other, err := OpenStore(withToken(otherDSN, token))
+		if err != nil {
+			return exitError, usageError{err}
+		}
+		state, err := loadSyncState(*stateFile)
+		if err != nil {
+			return exitError, err
+		}
+		key := strings.Join([]string{*c.options.user, redactToken(c.storeDSN), redactToken(otherDSN)}, " ")
+		report, err := controller.Sync(other, *c.options.user, state[key])
+		if err != nil {
+			return exitError, err
+		}
+		state[key] = report.SyncedAt
+		err = saveSyncState(*stateFile, state)
+		if err != nil {
+			return exitError, err
+		}
+		return exitOK, c.printer.print(report, report.String())
+	}
+}
+
+//loadSyncState reads when stores were last synced from filename, by user and the DSNs of both stores. It triggers
+//file io operations.
+func loadSyncState(filename string) (map[string]time.Time, error) {
+	state := make(map[string]time.Time)
+	data, err := ioutil.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read sync state from %s: %w", filename, err)
+	}
+	return state, nil
+}
+
+//saveSyncState writes the sync state to filename, creating its directory. It triggers file io operations.
+func saveSyncState(filename string, state map[string]time.Time) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	//the default file is kept in the data directory, which may not exist yet
+	err = os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0600)
+}
+
+func setupHelp(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error) {
+	return func(args []string) (int, error) {
+		switch len(args) {
+		case 0:
+			c.usage()
+			return exitOK, nil
+		case 1:
+			command := findCommand(args[0])
+			if command == nil {
+				return exitError, usageErrorf("unknown command %s", args[0])
+			}
+			return c.run(command, args[0], []string{"-h"}), nil
+		}
+		return exitError, usageErrorf("help takes at most one command")
+	}
+}
+
+func setupTag(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error) {
+	return func(args []string) (int, error) {
+		if len(args) < 3 || (args[0] != "add" && args[0] != "remove") {
+			return exitError, usageErrorf("tag takes add or remove, a habit name and tags")
+		}
+		controller, err := c.open()
+		if err != nil {
+			return exitError, err
+		}
+		user, name, tags := *c.options.user, args[1], args[2:]
+		if args[0] == "remove" {
+			h, err := controller.RemoveTags(user, name, tags...)
+			if err != nil {
+				return exitError, err
+			}
+			text := fmt.Sprintf("Untagged '%s' %s.", h.Name, strings.Join(tags, ", "))
+			return exitOK, c.printer.print(newHabitOutput(h, c.calendar, time.Now()), text)
+		}
+		h, err := controller.AddTags(user, name, tags...)
+		if err != nil {
+			return exitError, err
+		}
+		text := fmt.Sprintf("Tagged '%s' %s.", h.Name, strings.Join(h.Tags, ", "))
+		return exitOK, c.printer.print(newHabitOutput(h, c.calendar, time.Now()), text)
+	}
+}
+
+func setupToken(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error) {
+	scopeName := flagSet.String("scope", "read", "Set the scope of a created token: read, checkin, store, or hook "+
+		"to only check in through /hooks/checkin.")
+	tokenName := flagSet.String("name", "", "Set a name to identify a created token.")
+	return func(args []string) (int, error) {
+		if len(args) == 0 {
+			return exitError, usageErrorf("missing token command")
+		}
+		_, err := c.open()
+		if err != nil {
+			return exitError, err
+		}
+		tokens, ok := c.store.(TokenStore)
+		if !ok {
+			return exitError, errors.New("store does not support API tokens")
+		}
+
+		switch args[0] {
+		case "create":
+			scope, err := parseScope(*scopeName)
+			if err != nil {
+				return exitError, usageError{err}
+			}
+			token, secret, err := NewToken(*c.options.user, *tokenName, scope)
+			if err != nil {
+				return exitError, err
+			}
+			err = tokens.CreateToken(token)
+			if err != nil {
+				return exitError, err
+			}
+			created := newTokenOutput(token)
+			created.Secret = secret
+			return exitOK, c.printer.print(created, fmt.Sprintf("Created %s token %s for %s. Store it safely, it "+
+				"won't be shown again:\n%s", token.Scope, token.ID, token.User, secret))
+		case "list":
+			allTokens := tokens.ListTokens()
+			listed := make([]tokenOutput, 0, len(allTokens))
+			lines := make([]string, 0, len(allTokens))
+			for _, t := range allTokens {
+				listed = append(listed, newTokenOutput(t))
+				lines = append(lines, fmt.Sprintf("%s\t%s\t%s\t%s\t%s", t.ID, t.User, t.Scope,
+					t.Created.Format(time.RFC3339), t.Name))
+			}
+			if len(lines) == 0 {
+				lines = append(lines, "no tokens have been created")
+			}
+			return exitOK, c.printer.print(listed, strings.Join(lines, "\n"))
+		case "revoke":
+			if len(args) != 2 {
+				return exitError, usageErrorf("revoke takes exactly one token id")
+			}
+			err := tokens.RevokeToken(args[1])
+			if err != nil {
+				return exitError, err
+			}
+			return exitOK, c.printer.print(tokenOutput{ID: args[1]}, fmt.Sprintf("Revoked token %s", args[1]))
+		}
+		return exitError, usageErrorf("unknown token command %s", args[0])
+	}
+}
+
+//setupPause sets up habit pause and habit resume
+func setupPause(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error) {
+	command := flagSet.Name()
+	all := flagSet.Bool("all", false, "Apply to all habits.")
+	var from, until *string
+	if command == "pause" {
+		from = flagSet.String("from", "", "Set the day the pause starts, as YYYY-MM-DD. Defaults to now.")
+		until = flagSet.String("until", "", "Set the day the habit is resumed, as YYYY-MM-DD. Defaults to "+
+			"pausing until `habit resume`.")
+	}
+	return func(args []string) (int, error) {
+		if len(args) > 1 {
+			return exitError, usageErrorf("%s takes at most one habit name", command)
+		}
+		var name string
+		if len(args) == 1 {
+			name = args[0]
+		}
+		if (name == "") == !*all {
+			return exitError, usageErrorf("%s takes a habit name or -all", command)
+		}
+		controller, err := c.open()
+		if err != nil {
+			return exitError, err
+		}
+		user := *c.options.user
+
+		if command == "resume" {
+			var resumed []*Habit
+			if *all {
+				resumed, err = controller.ResumeAll(user)
+			} else {
+				var h *Habit
+				h, err = controller.Resume(user, name)
+				resumed = []*Habit{h}
+			}
+			if err != nil {
+				return exitError, err
+			}
+			lines := make([]string, 0, len(resumed))
+			for _, h := range resumed {
+				lines = append(lines, fmt.Sprintf("Resumed '%s'.", h.Name))
+			}
+			if len(lines) == 0 {
+				lines = append(lines, "no habits are paused")
+			}
+			return exitOK, c.printer.print(newHabitsOutput(resumed, c.calendar), strings.Join(lines, "\n"))
+		}
+
+		fromTime, err := c.calendar.parseDate(*from)
+		if err != nil {
+			return exitError, usageError{err}
+		}
+		untilTime, err := c.calendar.parseDate(*until)
+		if err != nil {
+			return exitError, usageError{err}
+		}
+		var paused []*Habit
+		if *all {
+			paused, err = controller.PauseAll(user, fromTime, untilTime)
+		} else {
+			var h *Habit
+			h, err = controller.Pause(user, name, fromTime, untilTime)
+			paused = []*Habit{h}
+		}
+		if err != nil {
+			return exitError, err
+		}
+		lines := make([]string, 0, len(paused))
+		for _, h := range paused {
+			pause := &h.Pauses[len(h.Pauses)-1]
+			message := fmt.Sprintf("Paused '%s'", h.Name)
+			if pause.From.After(time.Now()) {
+				message += " from " + c.calendar.local(pause.From).Format(pauseDateForm)
+			}
+			if pause.Until.IsZero() {
+				message += " until you resume it"
+			}
+			lines = append(lines, fmt.Sprintf("%s%s.", message, c.calendar.pauseEnd(pause)))
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "no habits to pause")
+		}
+		return exitOK, c.printer.print(newHabitsOutput(paused, c.calendar), strings.Join(lines, "\n"))
+	}
+}
+
+//setupDue sets up habit today and habit due
+func setupDue(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error) {
+	exitCode := flagSet.Bool("exit-code", false, "Exit with status 1 if any habit is due today or overdue.")
+	return func(args []string) (int, error) {
+		if len(args) > 0 {
+			return exitError, usageErrorf("%s takes no arguments", flagSet.Name())
+		}
+		controller, err := c.open()
+		if err != nil {
+			return exitError, err
+		}
+		due := controller.DueHabits(*c.options.user)
+		lines := make([]string, 0, len(due))
+		for _, d := range due {
+			lines = append(lines, d.String())
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "no habits have been started")
+		}
+		if due == nil {
+			due = []HabitDue{}
+		}
+		err = c.printer.print(due, strings.Join(lines, "\n"))
+		if err != nil {
+			return exitError, err
+		}
+		if *exitCode && needsDoing(due) {
+			return exitHabitsDue, nil
+		}
+		return exitOK, nil
+	}
+}
+
+//setupRemind sets up habit remind, which checks for reminders once or, as a daemon, until interrupted
+func setupRemind(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error) {
+	daemon := flagSet.Bool("daemon", false, "Keep running and check for reminders periodically.")
+	every := flagSet.Duration("every", time.Minute, "Set how often the daemon checks for reminders.")
+	before := flagSet.Duration("before", 4*time.Hour, "Set how long before the end of the day habits due that day "+
+		"are reminded, 0 reminds them as soon as they are due.")
+	command := flagSet.String("exec", "", "Run a shell command for every reminder, with the reminder in $HABIT_NAME, "+
+		"$HABIT_STATUS, $HABIT_STREAK, $HABIT_DUE and $HABIT_MESSAGE.")
+	webhook := flagSet.String("webhook", "", "Post every reminder as JSON to a URL.")
+	desktop := flagSet.Bool("desktop", true, "Show desktop notifications with notify-send, if installed.")
+	sentFile := flagSet.String("sent", filepath.Join(c.dataDir, ".habitReminders.json"),
+		"Set the file keeping the reminders already sent, so that each is sent once.")
+	return func(args []string) (int, error) {
+		if len(args) > 0 {
+			return exitError, errors.New("remind takes no arguments")
+		}
+		if *every <= 0 {
+			return exitError, errors.New("reminder interval must be positive")
+		}
+		controller, err := c.open()
+		if err != nil {
+			return exitError, err
+		}
+
+		reminders := Reminders{Controller: controller, Users: []string{*c.options.user}, Before: *before,
+			SentFile: *sentFile}
+		if *command != "" {
+			reminders.Notifiers = append(reminders.Notifiers, CommandNotifier{Command: *command})
+		}
+		if *webhook != "" {
+			reminders.Notifiers = append(reminders.Notifiers, WebhookNotifier{URL: *webhook})
+		}
+		if *desktop {
+			notifier, err := NewDesktopNotifier()
+			if err == nil {
+				reminders.Notifiers = append(reminders.Notifiers, notifier)
+			}
+		}
+		if len(reminders.Notifiers) == 0 {
+			return exitError, errors.New("no notifiers, pass -exec or -webhook, or install notify-send")
+		}
+		//the default file is kept in the data directory, which may not exist yet
+		err = os.MkdirAll(filepath.Dir(*sentFile), 0700)
+		if err != nil {
+			return exitError, err
+		}
+
+		if !*daemon {
+			reminded, err := reminders.Check(context.Background())
+			if len(reminded) > 0 || err == nil || c.printer.structured() {
+				printErr := c.printReminders(reminded, "no habits need reminding")
+				if printErr != nil {
+					return exitError, printErr
+				}
+			}
+			if err != nil {
+				return exitError, err
+			}
+			return exitOK, nil
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if !c.printer.structured() {
+			fmt.Fprintf(c.output, "Checking for reminders every %s\n", *every)
+		}
+		var printErr error
+		reminders.Run(ctx, *every, func(reminded []Reminder, err error) {
+			//structured output is kept to the reminders sent, errors are logged
+			if err != nil && c.printer.structured() {
+				log.Println(err)
+			} else if err != nil {
+				fmt.Fprintln(c.output, err)
+			}
+			if len(reminded) > 0 && printErr == nil {
+				printErr = c.printReminders(reminded, "")
+				if printErr != nil {
+					stop()
+				}
+			}
+		})
+		if printErr != nil {
+			return exitError, printErr
+		}
+		return exitOK, nil
+	}
+}
+
+//printReminders prints the reminders sent, or none when nothing was reminded in the text format
+func (c *cli) printReminders(reminded []Reminder, none string) error {
+	lines := make([]string, 0, len(reminded))
+	for _, reminder := range reminded {
+		lines = append(lines, fmt.Sprintf("Reminded %s: %s", reminder.User, reminder.Message))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, none)
+	}
+	if reminded == nil {
+		reminded = []Reminder{}
+	}
+	return c.printer.print(reminded, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,253 @@
+package habit
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+//completeCommand is the hidden command the completion scripts run to get the candidates of a word
+const completeCommand = "__complete"
+
+//completionScripts are the scripts printed by habit completion. They pass the words typed so far to habit
+//__complete, which prints the candidates completing the last one, one per line.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for habit, load it with: source <(habit completion bash)
+_habit_complete() {
+    local IFS=$'\n'
+    COMPREPLY=($("${COMP_WORDS[0]}" ` + completeCommand + ` -- "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _habit_complete habit`,
+	"zsh": `#compdef habit
+# zsh completion for habit, load it with: source <(habit completion zsh)
+_habit() {
+    local -a candidates
+    candidates=(${(f)"$("${words[1]}" ` + completeCommand + ` -- "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+    if (( ${#candidates} )); then
+        compadd -Q -a candidates
+    else
+        _files
+    fi
+}
+compdef _habit habit`,
+	"fish": `# fish completion for habit, load it with: habit completion fish | source
+function __habit_complete
+    set -l tokens (commandline -opc)
+    $tokens[1] ` + completeCommand + ` -- $tokens[2..-1] (commandline -ct) 2>/dev/null
+end
+complete -c habit -f -a '(__habit_complete)'`,
+}
+
+func setupCompletion(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error) {
+	return func(args []string) (int, error) {
+		if len(args) != 1 || completionScripts[args[0]] == "" {
+			return exitError, usageErrorf("%s takes one shell: bash, zsh or fish", flagSet.Name())
+		}
+		fmt.Fprintln(c.output, completionScripts[args[0]])
+		return exitOK, nil
+	}
+}
+
+func setupComplete(c *cli, flagSet *flag.FlagSet) func(args []string) (int, error) {
+	return func(args []string) (int, error) {
+		if len(args) == 0 {
+			return exitOK, nil
+		}
+		//the words are parsed by a cli of their own, so their flags select the store the habit names come from
+		completer, err := newCLI(ioutil.Discard)
+		if err != nil {
+			return exitError, err
+		}
+		for _, candidate := range completer.complete(args) {
+			fmt.Fprintln(c.output, candidate)
+		}
+		return exitOK, nil
+	}
+}
+
+//complete returns the candidates completing the last of words, the arguments of habit typed so far
+func (c *cli) complete(words []string) []string {
+	current, typed := words[len(words)-1], words[:len(words)-1]
+	c.global.SetOutput(ioutil.Discard)
+	if c.global.Parse(typed) != nil {
+		return completeFlagValue(c.global, typed, current)
+	}
+	if c.loadConfig() != nil {
+		return nil
+	}
+	if c.global.NArg() == 0 {
+		if strings.HasPrefix(current, "-") {
+			return matching(flagNames(c.global), current)
+		}
+		return matching(append(commandNames(), c.habitNames()...), current)
+	}
+
+	name, args := c.global.Arg(0), c.global.Args()[1:]
+	command := findCommand(name)
+	if command == nil {
+		command, args = shortcutCommand(), c.global.Args()
+	}
+	flagSet, _ := c.commandFlags(command, name)
+	flagSet.SetOutput(ioutil.Discard)
+	positional, err := parseArgs(flagSet, args)
+	if err != nil {
+		return completeFlagValue(flagSet, args, current)
+	}
+	if strings.HasPrefix(current, "-") {
+		return matching(flagNames(flagSet), current)
+	}
+	return matching(c.completeArg(command, positional), current)
+}
+
+//completeArg returns the candidates of the next argument of the command, after the positional arguments typed
+func (c *cli) completeArg(command *cliCommand, positional []string) []string {
+	switch command.name {
+	case "log", "show", "delete", "pause", "resume":
+		if len(positional) == 0 {
+			return c.habitNames()
+		}
+	case "tag":
+		switch {
+		case len(positional) == 0:
+			return []string{"add", "remove"}
+		case len(positional) == 1:
+			return c.habitNames()
+		case positional[0] == "remove":
+			store, err := c.completionStore()
+			if err != nil {
+				return nil
+			}
+			h, err := store.Get(*c.options.user, positional[1])
+			if err != nil || h == nil {
+				return nil
+			}
+			return h.Tags
+		}
+	case "token":
+		if len(positional) == 0 {
+			return []string{"create", "list", "revoke"}
+		}
+	case "config":
+		if len(positional) == 0 {
+			return []string{"show"}
+		}
+	case "completion":
+		if len(positional) == 0 {
+			return []string{"bash", "fish", "zsh"}
+		}
+	case "help":
+		if len(positional) == 0 {
+			return commandNames()
+		}
+	}
+	return nil
+}
+
+//completeFlagValue returns the candidates of the value of the flag that is the last word typed, if it takes one
+func completeFlagValue(flagSet *flag.FlagSet, typed []string, current string) []string {
+	if len(typed) == 0 {
+		return nil
+	}
+	f := flagSet.Lookup(strings.TrimLeft(typed[len(typed)-1], "-"))
+	if f == nil {
+		return nil
+	}
+	var values []string
+	switch f.Name {
+	case "f", "frequency":
+		for _, frequency := range frequencies {
+			values = append(values, frequency.name)
+		}
+	case "o":
+		values = []string{textOutput, jsonOutput, yamlOutput, tsvOutput}
+	case "s":
+		values = []string{"db", "file", "remote"}
+	case "kind":
+		values = []string{"build", "quit"}
+	}
+	return matching(values, current)
+}
+
+//habitNames returns the names of the user's habits in the store selected by the flags, sorted
+func (c *cli) habitNames() []string {
+	store, err := c.completionStore()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, h := range store.GetAllHabits(*c.options.user) {
+		names = append(names, h.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//commandNames returns the names and aliases of the commands that are not hidden
+func commandNames() []string {
+	var names []string
+	for _, command := range commands() {
+		if !command.hidden {
+			names = append(names, command.name)
+			names = append(names, command.aliases...)
+		}
+	}
+	return names
+}
+
+//flagNames returns the flags of the flag set as typed, e.g. -f
+func flagNames(flagSet *flag.FlagSet) []string {
+	var names []string
+	flagSet.VisitAll(func(f *flag.Flag) {
+		names = append(names, "-"+f.Name)
+	})
+	return names
+}
+
+//matching returns the candidates starting with prefix
+func matching(candidates []string, prefix string) []string {
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches
+}
+
+//completionStore opens the store selected by the flags without changing anything on disk, as completion runs on every
+//tab: the stores of earlier versions are not moved to the data directory, stores that don't exist yet are not created
+//and databases are opened read-only, so that they are not migrated either.
+func (c *cli) completionStore() (Store, error) {
+	storeDSN := *c.options.storeDSN
+	if storeDSN == "" {
+		var err error
+		storeDSN, err = legacyStoreDSN(*c.options.storeType, *c.options.storeDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	u, err := url.Parse(storeDSN)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "sqlite", "file":
+		path := dsnPath(u)
+		_, err = os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme == "sqlite" {
+			return OpenDBStore((&url.URL{Scheme: "file", Path: path, RawQuery: "mode=ro"}).String())
+		}
+	}
+	token := *c.options.token
+	if token == "" {
+		token = os.Getenv("HABIT_TOKEN")
+	}
+	return OpenStore(withToken(storeDSN, token))
+}
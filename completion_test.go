@@ -0,0 +1,59 @@
+package habit_test
+
+import (
+	"bytes"
+	"github.com/crmejia/habit"
+	"strings"
+	"testing"
+)
+
+func TestRunCLICompletionPrintsScripts(t *testing.T) {
+	t.Parallel()
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		buffer := bytes.Buffer{}
+		status := habit.RunCLI([]string{"completion", shell}, &buffer)
+		if status != 0 || !strings.Contains(buffer.String(), "__complete --") {
+			t.Errorf("want a %s script completing with habit __complete, got %d:\n%s", shell, status, buffer.String())
+		}
+	}
+
+	buffer := bytes.Buffer{}
+	status := habit.RunCLI([]string{"completion", "powershell"}, &buffer)
+	if status != 2 || !strings.Contains(buffer.String(), "completion takes one shell: bash, zsh or fish") {
+		t.Errorf("want unknown shells rejected, got %d:\n%s", status, buffer.String())
+	}
+}
+
+func TestRunCLICompletes(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", tmpDir, "piano"}, &buffer)
+	habit.RunCLI([]string{"-d", tmpDir, "pilates"}, &buffer)
+	habit.RunCLI([]string{"-d", tmpDir, "surfing"}, &buffer)
+	habit.RunCLI([]string{"-d", tmpDir, "tag", "add", "surfing", "outdoors"}, &buffer)
+
+	testCases := []struct {
+		name  string
+		words []string
+		want  []string
+	}{
+		{"commands and habits", []string{"-d", tmpDir, "p"}, []string{"pause", "piano", "pilates"}},
+		{"habit names", []string{"log", "-d", tmpDir, ""}, []string{"piano", "pilates", "surfing"}},
+		{"frequencies", []string{"-d", tmpDir, "new", "chess", "-f", ""}, []string{"daily", "weekly"}},
+		{"list frequencies", []string{"list", "-frequency", "w"}, []string{"weekly"}},
+		{"command flags", []string{"log", "piano", "-r"}, []string{"-rating"}},
+		{"subcommands", []string{"tag", ""}, []string{"add", "remove"}},
+		{"tags", []string{"-d", tmpDir, "tag", "remove", "surfing", ""}, []string{"outdoors"}},
+		{"help", []string{"help", "de"}, []string{"delete"}},
+		{"new habit name", []string{"-d", tmpDir, "new", ""}, nil},
+	}
+	for _, tc := range testCases {
+		buffer := bytes.Buffer{}
+		status := habit.RunCLI(append([]string{"__complete", "--"}, tc.words...), &buffer)
+		got := strings.Fields(buffer.String())
+		if status != 0 || strings.Join(got, " ") != strings.Join(tc.want, " ") {
+			t.Errorf("%s: want %v, got %d %v", tc.name, tc.want, status, got)
+		}
+	}
+}
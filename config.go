@@ -0,0 +1,330 @@
+package habit
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+//Config holds the settings read from the config file and the HABIT_* environment variables. Environment variables
+//take precedence over the file, and the flags of RunCLI and RunServer over both. A .habit directory found by
+//FindProjectDir from the working directory replaces the store of the config file.
+type Config struct {
+	//StoreType, StoreDir and Store select the store like the -s, -d and -store flags
+	StoreType string
+	StoreDir  string
+	Store     string
+	//Frequency is the frequency of new habits, daily or weekly
+	Frequency string
+	//Timezone is the IANA name of the time zone days are counted in, the local one if empty
+	Timezone string
+	//DayStart is the hour days start at, check-ins before it count toward the day before
+	DayStart int
+	//ServerAddress is the address RunServer listens on when none is given
+	ServerAddress string
+
+	//Path is the config file read, it may not exist
+	Path string
+	//Sources tells where each setting, by its key, was read from: default, the config file, an environment variable
+	//or a flag
+	Sources map[string]string
+}
+
+//configSettings are the keys of the config file settings, in the order they are shown, and the environment variables
+//overriding them
+var configSettings = []struct {
+	key string
+	env string
+}{
+	{"store_type", "HABIT_STORE_TYPE"},
+	{"store_dir", "HABIT_STORE_DIR"},
+	{"store", "HABIT_STORE"},
+	{"frequency", "HABIT_FREQUENCY"},
+	{"timezone", "HABIT_TIMEZONE"},
+	{"day_start", "HABIT_DAY_START"},
+	{"server_address", "HABIT_SERVER_ADDRESS"},
+}
+
+//Sources of the settings besides the config file, the environment variables and the flags
+const (
+	defaultSource = "default"
+	projectSource = "project"
+)
+
+//DefaultConfigPath returns the path of the config file: $HABIT_CONFIG if set, otherwise habit/config.toml in
+//$XDG_CONFIG_HOME, which defaults to ~/.config.
+func DefaultConfigPath() string {
+	if path := os.Getenv("HABIT_CONFIG"); path != "" {
+		return path
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		homeDir, err := homedir.Dir()
+		if err != nil {
+			return ""
+		}
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configHome, "habit", "config.toml")
+}
+
+//LoadConfig reads the config file at path, which may not exist, the store of the project in the working directory and
+//the HABIT_* environment variables. An empty path reads the file at DefaultConfigPath.
+func LoadConfig(path string) (*Config, error) {
+	if path == "" {
+		path = DefaultConfigPath()
+	}
+	config := &Config{StoreType: "db", Frequency: "daily", Path: path, Sources: map[string]string{}}
+	for _, setting := range configSettings {
+		config.Sources[setting.key] = defaultSource
+	}
+
+	file, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		defer file.Close()
+		values, err := parseConfigFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+		for key, value := range values {
+			err = config.set(key, value, path)
+			if err != nil {
+				return nil, fmt.Errorf("config file %s: %w", path, err)
+			}
+		}
+	}
+
+	//a project's store wins over the one of the config file, like the config of a git repository over the global one
+	if dir, err := os.Getwd(); err == nil {
+		if project := FindProjectDir(dir); project != "" {
+			config.StoreType, config.StoreDir, config.Store = projectStoreType(project), project, ""
+			for _, key := range []string{"store_type", "store_dir", "store"} {
+				config.Sources[key] = projectSource
+			}
+		}
+	}
+
+	for _, setting := range configSettings {
+		value, ok := os.LookupEnv(setting.env)
+		if !ok || value == "" {
+			continue
+		}
+		err = config.set(setting.key, value, setting.env)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", setting.env, err)
+		}
+	}
+	return config, nil
+}
+
+//set validates and sets the setting with the given key, recording where it came from
+func (c *Config) set(key, value, source string) error {
+	switch key {
+	case "store_type":
+		c.StoreType = value
+	case "store_dir":
+		c.StoreDir = value
+	case "store":
+		c.Store = value
+	case "frequency":
+		_, err := parseHabit("config", value)
+		if err != nil {
+			return err
+		}
+		c.Frequency = value
+	case "timezone":
+		_, err := time.LoadLocation(value)
+		if err != nil {
+			return fmt.Errorf("unknown timezone: %s", value)
+		}
+		c.Timezone = value
+	case "day_start":
+		hour, err := strconv.Atoi(value)
+		if err != nil || hour < 0 || hour > 23 {
+			return fmt.Errorf("invalid day_start: %s, expected an hour from 0 to 23", value)
+		}
+		c.DayStart = hour
+	case "server_address":
+		c.ServerAddress = value
+	default:
+		return fmt.Errorf("unknown setting: %s", key)
+	}
+	c.Sources[key] = source
+	return nil
+}
+
+//get returns the setting with the given key
+func (c *Config) get(key string) string {
+	switch key {
+	case "store_type":
+		return c.StoreType
+	case "store_dir":
+		return c.StoreDir
+	case "store":
+		return c.Store
+	case "frequency":
+		return c.Frequency
+	case "timezone":
+		return c.Timezone
+	case "day_start":
+		return strconv.Itoa(c.DayStart)
+	case "server_address":
+		return c.ServerAddress
+	}
+	return ""
+}
+
+//shown returns the setting with the given key as config show prints it, with the token of a store DSN hidden
+func (c *Config) shown(key string) string {
+	if key == "store" {
+		return redactToken(c.Store)
+	}
+	return c.get(key)
+}
+
+//format writes the settings as a config file, commented with where each one was read from
+func (c *Config) format() string {
+	builder := strings.Builder{}
+	fmt.Fprintf(&builder, "# %s\n", c.Path)
+	w := tabwriter.NewWriter(&builder, 0, 0, 2, ' ', 0)
+	for _, setting := range configSettings {
+		value := c.shown(setting.key)
+		if setting.key != "day_start" {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(w, "%s = %s\t# %s\n", setting.key, value, c.Sources[setting.key])
+	}
+	w.Flush()
+	return strings.TrimSuffix(builder.String(), "\n")
+}
+
+//useFlags lets the flags that were set override the config, and sets the other flags to the config's values when they
+//come from the file or the environment. flags maps the keys of the settings to the names of the flags.
+func (c *Config) useFlags(flagSet *flag.FlagSet, flags map[string]string) error {
+	set := map[string]bool{}
+	flagSet.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for _, setting := range configSettings {
+		name, ok := flags[setting.key]
+		if !ok {
+			continue
+		}
+		f := flagSet.Lookup(name)
+		switch {
+		case set[name]:
+			//invalid flags are reported by the commands using them
+			c.set(setting.key, f.Value.String(), "flag -"+name)
+		case c.Sources[setting.key] != defaultSource:
+			err := f.Value.Set(c.get(setting.key))
+			if err != nil {
+				return err
+			}
+		default:
+			//show the flag's default, like the home directory as store_dir
+			c.set(setting.key, f.Value.String(), defaultSource)
+		}
+	}
+	return nil
+}
+
+//Calendar returns the calendar counting days in the configured time zone and from the configured hour
+func (c *Config) Calendar() (Calendar, error) {
+	cal := Calendar{DayStart: time.Duration(c.DayStart) * time.Hour}
+	if c.Timezone != "" {
+		location, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return Calendar{}, fmt.Errorf("unknown timezone: %s", c.Timezone)
+		}
+		cal.Location = location
+	}
+	return cal, nil
+}
+
+//parseConfigFile parses the subset of TOML used by the config file: key = value lines with string or integer values,
+//and comments
+func parseConfigFile(file io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		equals := strings.Index(text, "=")
+		if equals == -1 {
+			return nil, fmt.Errorf("line %d: expected key = value", line)
+		}
+		key := strings.TrimSpace(text[:equals])
+		if key == "" || strings.IndexFunc(key, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-'
+		}) != -1 {
+			return nil, fmt.Errorf("line %d: invalid key %q", line, key)
+		}
+		value, err := parseConfigValue(strings.TrimSpace(text[equals+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %s", line, key)
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+//parseConfigValue parses a basic or literal string, or an integer, followed by an optional comment
+func parseConfigValue(text string) (string, error) {
+	var value, rest string
+	switch {
+	case strings.HasPrefix(text, `"`):
+		end := 1
+		for end < len(text) && text[end] != '"' {
+			if text[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(text) {
+			return "", errors.New("unterminated string")
+		}
+		unquoted, err := strconv.Unquote(text[:end+1])
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", text[:end+1])
+		}
+		value, rest = unquoted, text[end+1:]
+	case strings.HasPrefix(text, "'"):
+		end := strings.Index(text[1:], "'")
+		if end == -1 {
+			return "", errors.New("unterminated string")
+		}
+		value, rest = text[1:end+1], text[end+2:]
+	default:
+		value = text
+		if comment := strings.Index(text, "#"); comment != -1 {
+			value = strings.TrimSpace(text[:comment])
+		}
+		if _, err := strconv.Atoi(value); err != nil {
+			return "", fmt.Errorf("invalid value %q, strings must be quoted", value)
+		}
+	}
+	rest = strings.TrimSpace(rest)
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("unexpected %q after value", rest)
+	}
+	return value, nil
+}
@@ -0,0 +1,165 @@
+package habit_test
+
+import (
+	"bytes"
+	"github.com/crmejia/habit"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrefersEnvironmentOverFile(t *testing.T) {
+	path := writeConfig(t, `# habit settings
+store_type = "file"
+store_dir = '/tmp/habits' # literal string
+frequency = "weekly"
+day_start = 4
+`)
+	t.Setenv("HABIT_FREQUENCY", "daily")
+	t.Setenv("HABIT_SERVER_ADDRESS", "127.0.0.1:8080")
+
+	config, err := habit.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.StoreType != "file" || config.StoreDir != "/tmp/habits" || config.DayStart != 4 {
+		t.Errorf("want the settings of the file, got %+v", config)
+	}
+	if config.Frequency != "daily" || config.ServerAddress != "127.0.0.1:8080" {
+		t.Errorf("want the environment to override the file, got %+v", config)
+	}
+	if config.Sources["frequency"] != "HABIT_FREQUENCY" || config.Sources["store_type"] != path ||
+		config.Sources["timezone"] != "default" {
+		t.Errorf("want where each setting came from, got %v", config.Sources)
+	}
+}
+
+func TestLoadConfigDefaultsWithoutFile(t *testing.T) {
+	t.Parallel()
+	config, err := habit.LoadConfig(filepath.Join(t.TempDir(), "missing.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.StoreType != "db" || config.Frequency != "daily" || config.DayStart != 0 || config.Timezone != "" {
+		t.Errorf("want the defaults, got %+v", config)
+	}
+}
+
+func TestLoadConfigRejectsInvalidSettings(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"unknown key", `colour = "blue"`, "unknown setting: colour"},
+		{"unquoted string", `frequency = weekly`, "line 1: invalid value \"weekly\", strings must be quoted"},
+		{"bad frequency", `frequency = "monthly"`, "unknown frequency: monthly"},
+		{"bad timezone", `timezone = "Mars/Olympus"`, "unknown timezone: Mars/Olympus"},
+		{"bad day start", `day_start = 24`, "invalid day_start: 24"},
+		{"duplicate key", "day_start = 1\nday_start = 2", "line 2: duplicate key day_start"},
+		{"no value", "[server]", "line 1: expected key = value"},
+		{"unterminated", `store = "sqlite:///tmp`, "line 1: unterminated string"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := habit.LoadConfig(writeConfig(t, tc.content))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("want error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRunCLIConfigShowPrefersFlags(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	path := writeConfig(t, "store_type = \"file\"\nfrequency = \"weekly\"\n")
+	buffer := bytes.Buffer{}
+	status := habit.RunCLI([]string{"-config", path, "-s", "db", "-d", tmpDir, "config", "show"}, &buffer)
+	if status != 0 {
+		t.Fatalf("want config shown, got %d:\n%s", status, buffer.String())
+	}
+	got := buffer.String()
+	for _, want := range []string{
+		"# " + path + "\n",
+		`store_type = "db"`,
+		"# flag -s\n",
+		`frequency = "weekly"`,
+		"# " + path + "\n",
+		"day_start = 0",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want config show to contain %q, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestRunCLIConfigShowHidesStoreToken(t *testing.T) {
+	t.Parallel()
+	path := writeConfig(t, "store = \"https://habits.example.com?token=secret\"\n")
+	for _, format := range []string{"text", "json"} {
+		buffer := bytes.Buffer{}
+		status := habit.RunCLI([]string{"-config", path, "-o", format, "config", "show"}, &buffer)
+		if status != 0 {
+			t.Fatalf("want config shown, got %d:\n%s", status, buffer.String())
+		}
+		got := buffer.String()
+		if strings.Contains(got, "secret") || !strings.Contains(got, "habits.example.com") {
+			t.Errorf("want %s config show to print the store without its token, got:\n%s", format, got)
+		}
+	}
+}
+
+func TestRunCLIUsesConfiguredStoreAndFrequency(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	path := writeConfig(t, "store_type = \"file\"\nstore_dir = \""+tmpDir+"\"\nfrequency = \"weekly\"\n")
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-config", path, "new", "surfing"}, &buffer)
+	habit.RunCLI([]string{"-config", path, "new", "piano", "-f", "daily"}, &buffer)
+	if _, err := os.Stat(filepath.Join(tmpDir, ".habitTracker")); err != nil {
+		t.Fatalf("want the configured file store to be used, got %v:\n%s", err, buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-config", path, "-o", "tsv", "list"}, &buffer)
+	if got := buffer.String(); !strings.Contains(got, "piano\t") || !strings.Contains(got, "\tdaily\t") ||
+		!strings.Contains(got, "surfing\t") || !strings.Contains(got, "\tweekly\t") {
+		t.Errorf("want the configured frequency unless -f is given, got:\n%s", got)
+	}
+}
+
+func TestConfigCalendar(t *testing.T) {
+	t.Parallel()
+	local := time.Local
+	config := habit.Config{Timezone: "America/Mexico_City", DayStart: 4}
+	cal, err := config.Calendar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cal.Location.String() != "America/Mexico_City" || cal.DayStart != 4*time.Hour || time.Local != local {
+		t.Errorf("want the configured time zone and day start without changing the local one, got %+v", cal)
+	}
+	lateNight := time.Date(2022, 3, 1, 23, 0, 0, 0, cal.Location)
+	if !cal.SameDay(lateNight, lateNight.Add(3*time.Hour)) {
+		t.Error("want check-ins before the day start to count toward the day before")
+	}
+	if cal.SameDay(lateNight, lateNight.Add(5*time.Hour)) {
+		t.Error("want the day to end at the day start")
+	}
+}
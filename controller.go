@@ -3,6 +3,10 @@ package habit
 import (
 	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,16 +21,57 @@ const (
 	repeatedHabit = "You already logged '%s' today. Keep it up!"
 	brokeStreak   = "You last did the habit '%s' %.0f %s ago, so you're starting a new streak today. Good luck!"
 	habitStatus   = "You're currently on a %d-day streak for '%s'. Stick to it!"
+)
 
-	NewMessage MessageKind = iota
+//The values of MessageKind are stored with habits and must not change. They start at 7, where they were when they
+//followed the constants above.
+const (
+	NewMessage MessageKind = iota + 7
 	RepeatMessage
 	StreakMessage
 	BrokenMessage
+	ProgressMessage
+	RelapseMessage
+	GraceMessage
+	FreezeMessage
+)
+
+const (
+	startedHabit  = "Good luck with your new habit '%s'! Check it in to start your streak."
+	progressHabit = "You've logged %s of %s for '%s' today, %s to go."
+	targetReached = "You already reached today's target of %s for '%s'. Keep it up!"
+	quitHabit     = "Good luck quitting '%s'! Only log it when you slip, your streak grows every %s you don't."
+	relapsedHabit = "You slipped on '%s' after %d %s. Don't give up, your new streak starts now!"
+	quitStatus    = "You've gone %d %s without '%s'. Stick to it!"
+	graceSaved    = "You were late, but your grace period saved your streak."
+	freezeSaved   = "Your streak was saved by a freeze, %d left."
+	freezeEarned  = "You earned a streak freeze, you now have %d."
+
+	//freezeEvery is the number of streak periods that earn a freeze, up to maxFreezes
+	freezeEvery = 7
+	maxFreezes  = 2
+
+	//maxRating is the best rating of a check-in, ratings go from 1 to maxRating
+	maxRating = 5
+	//shownNotes is the number of noted check-ins shown by ShowHabit
+	shownNotes = 5
+)
+
+const (
+	//BuildHabit is a habit built up by checking in every period, it is the default kind
+	BuildHabit HabitKind = iota
+	//QuitHabit is a habit to stop doing, its streak grows with every period without a check-in and a check-in
+	//records a slip that resets it
+	QuitHabit
 )
 
 //Controller enforces business logic on Habits
 type Controller struct {
 	Store Store
+	//Calendar counts the days habits are due and checked in on
+	Calendar Calendar
+	//EventHandlers receive an Event for every habit created or checked in
+	EventHandlers []EventHandler
 }
 
 //NewController returns a new Controller which uses the given store
@@ -37,8 +82,22 @@ func NewController(store Store) (Controller, error) {
 	return Controller{Store: store}, nil
 }
 
-//Handle Creates, Delete, or Updates the provided habit based on the status
+//Handle checks in the habit of input.User, creating it from input if it does not exist. Habits it creates count their
+//creation as done, start with a zero streak and are first due a period later. It is kept for compatibility, Create and
+//CheckIn separate creating habits from checking them in.
 func (c Controller) Handle(input *Habit) (*Habit, error) {
+	return c.HandleAmount(input, 0)
+}
+
+//HandleAmount works like Handle and logs amount toward the target of a quantitative habit. A zero amount logs one
+//unit.
+func (c Controller) HandleAmount(input *Habit, amount float64) (*Habit, error) {
+	return c.HandleCheckIn(input, CheckIn{Amount: amount})
+}
+
+//HandleCheckIn works like HandleAmount and records the note and rating of checkIn as well. New habits only record a
+//check-in when they have a target.
+func (c Controller) HandleCheckIn(input *Habit, checkIn CheckIn) (*Habit, error) {
 	if input == nil {
 		return nil, ErrNilHabit
 	}
@@ -46,56 +105,490 @@ func (c Controller) Handle(input *Habit) (*Habit, error) {
 	if input.Name == "" {
 		return nil, errors.New("inputHabit name cannot be empty")
 	}
+	amount := checkIn.Amount
+	if amount < 0 {
+		return nil, errors.New("amount cannot be negative")
+	}
 
-	h, err := c.Store.Get(input.Name)
+	h, err := c.Store.Get(input.User, input.Name)
 	if err != nil {
 		return nil, err
 	}
 	if h != nil {
-		h.updateHabit()
-		err = c.Store.Update(h)
-		if err != nil {
-			return nil, err
+		if input.Unit != "" && input.Unit != h.Unit {
+			return nil, fmt.Errorf("habit '%s' is measured in %s, not %s", h.Name, unitName(h.Unit), input.Unit)
 		}
-		return h, nil
+		return c.checkIn(h, CheckIn{Amount: amount, Note: checkIn.Note, Rating: checkIn.Rating})
 	}
 
-	if input.Frequency != DailyInterval && input.Frequency != WeeklyInterval {
-		return nil, errors.New("invalid interval")
+	err = input.validateNew()
+	if err != nil {
+		return nil, err
+	}
+	if input.Target == 0 && (amount > 0 || input.Unit != "") {
+		return nil, errors.New("amounts can only be logged for habits with a target")
+	}
+	if input.Target == 0 && (checkIn.Note != "" || checkIn.Rating != 0) {
+		return nil, fmt.Errorf("habit '%s' does not exist yet, notes and ratings are added to check-ins", input.Name)
+	}
+	err = validateRating(checkIn.Rating)
+	if err != nil {
+		return nil, err
 	}
+	now := time.Now()
 	input.Streak = 0
-	input.DueDate = time.Now().Add(input.Frequency)
+	input.Progress = 0
+	input.Freezes = 0
+	input.GraceUsedAt = time.Time{}
+	input.DueDate = now.Add(input.Frequency)
+	input.CreatedAt = now
+	input.UpdatedAt = now
+	input.LastCheckIn = now
+	if input.Target > 0 {
+		//creating a quantitative habit logs the first amount toward today's target
+		amount = input.checkInAmount(amount)
+		input.DueDate = now
+		input.addProgress(now, amount)
+		input.CheckIns = []CheckIn{{Time: now, Amount: amount, Note: checkIn.Note, Rating: checkIn.Rating}}
+	}
 	input.GenerateMessage(NewMessage)
 	err = c.Store.Create(input)
 	if err != nil {
 		return nil, err
 	}
-
+	c.emit(input, firstCheckIn(input))
 	return input, nil
 }
 
-//GetAllHabits wraps Store.GetAllHabits and returns a string representation of the existing habits
-func (c Controller) GetAllHabits() string {
-	allHabits := c.Store.GetAllHabits()
+//CreateOptions are the settings of a habit created with Controller.Create
+type CreateOptions struct {
+	//Frequency is DailyInterval or WeeklyInterval, daily if zero
+	Frequency time.Duration
+	Kind      HabitKind
+	GraceDays int
+	//Target and Unit make the habit quantitative
+	Target      float64
+	Unit        string
+	Description string
+	//Start is when the habit starts, now if zero. Check-ins since an earlier start can be backfilled.
+	Start time.Time
+	//FirstCheckIn, if set, counts the creation as the first check-in, done at Start unless its Time is set. It starts
+	//the streak and logs its amount toward the target. Otherwise the habit is due on the day it starts.
+	FirstCheckIn *CheckIn
+}
+
+//Create creates the user's habit. Unlike Handle it never checks in an existing habit, which returns ErrHabitExists,
+//and the habit is due on the day it starts unless options.FirstCheckIn counts its creation as done.
+func (c Controller) Create(user, name string, options CreateOptions) (*Habit, error) {
+	if name == "" {
+		return nil, errors.New("habit name cannot be empty")
+	}
+	if options.Frequency == 0 {
+		options.Frequency = DailyInterval
+	}
+	h := &Habit{Name: name, User: user, Frequency: options.Frequency, Kind: options.Kind,
+		GraceDays: options.GraceDays, Target: options.Target, Unit: options.Unit, Description: options.Description,
+		DueOnCreation: true}
+	err := h.validateNew()
+	if err != nil {
+		return nil, err
+	}
+	if h.Target == 0 && h.Unit != "" {
+		return nil, errors.New("only habits with a target can have a unit")
+	}
+	now := time.Now()
+	start := options.Start
+	if start.IsZero() {
+		start = now
+	}
+	if start.After(now) {
+		return nil, errors.New("habits cannot start in the future")
+	}
+	h.CreatedAt, h.UpdatedAt, h.DueDate = start, now, start
+	if h.Kind == QuitHabit {
+		if options.FirstCheckIn != nil {
+			return nil, errors.New("quit habits are only checked in when you slip, their creation cannot be one")
+		}
+		//the streak of a quit habit grows from its start
+		h.LastCheckIn = start
+	}
+
+	if options.FirstCheckIn != nil {
+		checkIn := *options.FirstCheckIn
+		if checkIn.Time.IsZero() {
+			checkIn.Time = start
+		}
+		switch {
+		case checkIn.Time.Before(start):
+			return nil, fmt.Errorf("cannot check in habit '%s' before it was created", h.Name)
+		case checkIn.Time.After(now):
+			return nil, errors.New("cannot check in in the future")
+		case checkIn.Amount < 0:
+			return nil, errors.New("amount cannot be negative")
+		case checkIn.Amount > 0 && h.Target == 0:
+			return nil, errors.New("amounts can only be logged for habits with a target")
+		}
+		err = validateRating(checkIn.Rating)
+		if err != nil {
+			return nil, err
+		}
+		checkIn.Amount = h.checkInAmount(checkIn.Amount)
+		h.updateHabit(c.Calendar, checkIn.Time, checkIn.Amount)
+		h.CheckIns = []CheckIn{checkIn}
+		h.LastCheckIn = checkIn.Time
+	}
+	h.GenerateMessage(NewMessage)
+	err = c.Store.Create(h)
+	if err != nil {
+		return nil, err
+	}
+	c.emit(h, firstCheckIn(h))
+	return h, nil
+}
+
+//validateNew checks the settings of a habit about to be created
+func (h *Habit) validateNew() error {
+	if h.Frequency != DailyInterval && h.Frequency != WeeklyInterval {
+		return errors.New("invalid interval")
+	}
+	if h.Target < 0 {
+		return errors.New("target cannot be negative")
+	}
+	if h.Kind == QuitHabit && h.Target > 0 {
+		return errors.New("quit habits cannot have a target")
+	}
+	if h.GraceDays < 0 {
+		return errors.New("grace period cannot be negative")
+	}
+	if h.Kind == QuitHabit && h.GraceDays > 0 {
+		return errors.New("quit habits cannot have a grace period")
+	}
+	return nil
+}
+
+//validateStored checks a whole habit written by a store client, such as a remote store, which sets its settings
+//without going through Create
+func (h *Habit) validateStored() error {
+	if h.Name == "" {
+		return errors.New("habit name cannot be empty")
+	}
+	if h.Kind != BuildHabit && h.Kind != QuitHabit {
+		return errors.New("invalid kind")
+	}
+	if h.Target == 0 && h.Unit != "" {
+		return errors.New("only habits with a target can have a unit")
+	}
+	return h.validateNew()
+}
+
+//CheckIn checks in the user's existing habit. A zero checkIn.Time checks it in now, and an earlier time backfills the
+//check-in and replays the habit's history. A check-in whose Key was already recorded returns ErrDuplicateCheckIn.
+func (c Controller) CheckIn(user, name string, checkIn CheckIn) (*Habit, error) {
+	h, err := c.getHabit(user, name)
+	if err != nil {
+		return nil, err
+	}
+	return c.checkIn(h, checkIn)
+}
+
+func (c Controller) checkIn(h *Habit, checkIn CheckIn) (*Habit, error) {
+	if checkIn.Amount < 0 {
+		return nil, errors.New("amount cannot be negative")
+	}
+	if checkIn.Amount > 0 && h.Target == 0 {
+		return nil, fmt.Errorf("habit '%s' has no target, amounts can only be logged for habits with a target",
+			h.Name)
+	}
+	err := validateRating(checkIn.Rating)
+	if err != nil {
+		return nil, err
+	}
+	if checkIn.Key != "" {
+		for _, existing := range h.CheckIns {
+			if existing.Key == checkIn.Key {
+				return nil, ErrDuplicateCheckIn
+			}
+		}
+	}
+	now := time.Now()
+	if checkIn.Time.IsZero() {
+		checkIn.Time = now
+	}
+	if checkIn.Time.After(now) {
+		return nil, errors.New("cannot check in in the future")
+	}
+	checkIn.Amount = h.checkInAmount(checkIn.Amount)
+	//habits due on creation have no last check-in until their first, so check-ins before their start are caught here too
+	if checkIn.Time.Before(h.LastCheckIn) || checkIn.Time.Before(h.CreatedAt) {
+		if h.CreatedAt.IsZero() || checkIn.Time.Before(h.CreatedAt) {
+			return nil, fmt.Errorf("cannot check in habit '%s' before it was created", h.Name)
+		}
+		h.CheckIns = append(h.CheckIns, checkIn)
+		h.recomputeStreak(c.Calendar)
+	} else {
+		h.updateHabit(c.Calendar, checkIn.Time, checkIn.Amount)
+		h.CheckIns = append(h.CheckIns, checkIn)
+		h.LastCheckIn = checkIn.Time
+	}
+	err = c.Store.Update(h)
+	if err != nil {
+		return nil, err
+	}
+	c.emit(h, &checkIn)
+	return h, nil
+}
+
+//firstCheckIn returns the check-in a new habit was created with, if any
+func firstCheckIn(h *Habit) *CheckIn {
+	if len(h.CheckIns) == 0 {
+		return nil
+	}
+	return &h.CheckIns[0]
+}
+
+//validateRating checks that a check-in's rating is between 1 and 5, or 0 when it has none
+func validateRating(rating int) error {
+	if rating < 0 || rating > maxRating {
+		return fmt.Errorf("rating must be between 1 and %d", maxRating)
+	}
+	return nil
+}
+
+//GetAllHabits returns a string representation of the user's existing habits, ordered by name
+func (c Controller) GetAllHabits(user string) string {
+	message, err := c.GetHabits(HabitQuery{User: user})
+	if err != nil {
+		return err.Error()
+	}
+	return message
+}
+
+//GetHabits works like GetAllHabits and lists the habits selected, ordered and paged by the query
+func (c Controller) GetHabits(query HabitQuery) (string, error) {
+	query.Calendar = c.Calendar
+	allHabits, err := c.Store.ListHabits(query)
+	if err != nil {
+		return "", err
+	}
 	if len(allHabits) == 0 {
-		return "no habits have been started"
+		//sorting and paging options select nothing from an empty store either
+		existing, err := c.Store.ListHabits(HabitQuery{User: query.User, Limit: 1})
+		if err != nil {
+			return "", err
+		}
+		if len(existing) == 0 {
+			return "no habits have been started", nil
+		}
+		return "no habits match", nil
 	}
+	now := time.Now()
 	message := "Habits:\n"
 	for _, h := range allHabits {
+		if h.Kind == QuitHabit {
+			message += fmt.Sprintf(quitStatus+"\n", h.currentStreak(c.Calendar, now), periodName(h.Frequency),
+				h.Name)
+			continue
+		}
+		if p := h.currentPause(now); p != nil {
+			message += fmt.Sprintf(pausedStatus+"\n", h.Name, c.Calendar.pauseEnd(p), h.Streak)
+			continue
+		}
 		message += fmt.Sprintf(habitStatus+"\n", h.Streak, h.Name)
 	}
-	return message
+	return message, nil
+}
+
+//DeleteHabit deletes the user's habit and its history
+func (c Controller) DeleteHabit(user, name string) error {
+	h, err := c.getHabit(user, name)
+	if err != nil {
+		return err
+	}
+	return c.Store.Delete(h.User, h.Name)
+}
+
+//ShowHabit returns a detailed description of the user's habit, including the result of the last time it was logged
+func (c Controller) ShowHabit(user, name string) (string, error) {
+	h, err := c.Store.Get(user, name)
+	if err != nil {
+		return "", err
+	}
+	if h == nil {
+		return "", fmt.Errorf("habit '%s' not found", name)
+	}
+
+	message := fmt.Sprintf("Habit: %s\n", h.Name)
+	if h.Description != "" {
+		message += fmt.Sprintf("Description: %s\n", h.Description)
+	}
+	message += fmt.Sprintf("Frequency: %s\n", frequencyName(h.Frequency))
+	if h.Kind == QuitHabit {
+		message += fmt.Sprintf("Kind: %s\n", h.Kind)
+	}
+	if len(h.Tags) > 0 {
+		message += fmt.Sprintf("Tags: %s\n", strings.Join(h.Tags, ", "))
+	}
+	if h.Target > 0 {
+		message += fmt.Sprintf("Target: %s\n", formatAmount(h.Target, h.Unit))
+		message += fmt.Sprintf("Progress: %s of %s\n", formatAmount(h.Progress, ""), formatAmount(h.Target, h.Unit))
+	}
+	message += fmt.Sprintf("Streak: %d\n", h.currentStreak(c.Calendar, time.Now()))
+	if h.GraceDays > 0 {
+		message += fmt.Sprintf("Grace period: %d days late once a week\n", h.GraceDays)
+	}
+	if h.Freezes > 0 {
+		message += fmt.Sprintf("Freezes: %d\n", h.Freezes)
+	}
+	now := time.Now()
+	if p := h.currentPause(now); p != nil {
+		message += fmt.Sprintf("Paused: since %s%s\n", c.Calendar.local(p.From).Format(pauseDateForm),
+			c.Calendar.pauseEnd(p))
+	} else if p := h.pendingPause(now); p != nil {
+		message += fmt.Sprintf("Pause: from %s%s\n", c.Calendar.local(p.From).Format(pauseDateForm),
+			c.Calendar.pauseEnd(p))
+	}
+	if h.Kind != QuitHabit {
+		message += fmt.Sprintf("Due: %s\n", c.Calendar.formatDay(h.DueDate))
+	}
+	if !h.LastCheckIn.IsZero() {
+		message += fmt.Sprintf("Last check-in: %s\n", c.Calendar.local(h.LastCheckIn).Format("2006-01-02 15:04"))
+	}
+	if h.MessageKind != 0 {
+		message += fmt.Sprintf("Last result: %s\n", h.MessageKind)
+	}
+	if h.Message != "" {
+		message += h.Message + "\n"
+	}
+	if notes := h.notedCheckIns(shownNotes); len(notes) > 0 {
+		message += "Notes:\n"
+		for _, checkIn := range notes {
+			message += fmt.Sprintf("  %s%s\n", c.Calendar.local(checkIn.Time).Format("2006-01-02 15:04"),
+				formatNote(checkIn))
+		}
+	}
+	return message, nil
+}
+
+//notedCheckIns returns the last n check-ins that have a note or a rating, oldest first
+func (h *Habit) notedCheckIns(n int) []CheckIn {
+	var noted []CheckIn
+	for _, c := range h.CheckIns {
+		if c.Note != "" || c.Rating != 0 {
+			noted = append(noted, c)
+		}
+	}
+	sort.SliceStable(noted, func(i, j int) bool {
+		return noted[i].Time.Before(noted[j].Time)
+	})
+	if len(noted) > n {
+		noted = noted[len(noted)-n:]
+	}
+	return noted
+}
+
+//formatNote returns the rating and note of a check-in, each preceded by two spaces
+func formatNote(c CheckIn) string {
+	var note string
+	if c.Rating != 0 {
+		note += fmt.Sprintf("  %d/%d", c.Rating, maxRating)
+	}
+	if c.Note != "" {
+		note += "  " + c.Note
+	}
+	return note
 }
 
 //MessageKind represents the message to be displayed
 type MessageKind int
 
-// SameDay returns true if the days are the same ignoring hours, minutes,etc
-func SameDay(d1, d2 time.Time) bool {
-	if d1.Year() == d2.Year() && d1.Month() == d2.Month() && d1.Day() == d2.Day() {
-		return true
+//String returns a short name for the kind of message
+func (k MessageKind) String() string {
+	switch k {
+	case NewMessage:
+		return "new habit"
+	case RepeatMessage:
+		return "already logged"
+	case StreakMessage:
+		return "streak extended"
+	case BrokenMessage:
+		return "streak broken"
+	case ProgressMessage:
+		return "progress logged"
+	case RelapseMessage:
+		return "slipped"
+	case GraceMessage:
+		return "streak saved by grace period"
+	case FreezeMessage:
+		return "streak saved by a freeze"
+	}
+	return "unknown"
+}
+
+//HabitKind represents whether a habit is built or quit
+type HabitKind int
+
+//String returns the name of the kind as accepted by the -kind flag
+func (k HabitKind) String() string {
+	switch k {
+	case BuildHabit:
+		return "build"
+	case QuitHabit:
+		return "quit"
+	}
+	return "unknown"
+}
+
+func parseKind(kind string) (HabitKind, error) {
+	switch kind {
+	case "", "build":
+		return BuildHabit, nil
+	case "quit":
+		return QuitHabit, nil
+	}
+	return BuildHabit, fmt.Errorf("unknown habit kind: %s", kind)
+}
+
+//Calendar tells which day times count toward. Days are counted in Location, or the local time zone if it is nil, and
+//start DayStart after midnight, so late check-ins can count toward the day before. The zero Calendar counts local days
+//from midnight.
+type Calendar struct {
+	Location *time.Location
+	DayStart time.Duration
+}
+
+//location returns the time zone days are counted in
+func (cal Calendar) location() *time.Location {
+	if cal.Location == nil {
+		return time.Local
 	}
-	return false
+	return cal.Location
+}
+
+//local returns t in the time zone days are counted in
+func (cal Calendar) local(t time.Time) time.Time {
+	return t.In(cal.location())
+}
+
+//day shifts t so that its calendar day is the day it counts toward
+func (cal Calendar) day(t time.Time) time.Time {
+	return cal.local(t.Add(-cal.DayStart))
+}
+
+//formatDay formats the day t counts toward as YYYY-MM-DD
+func (cal Calendar) formatDay(t time.Time) string {
+	return cal.day(t).Format("2006-01-02")
+}
+
+//SameDay returns true if the times count toward the same day
+func (cal Calendar) SameDay(d1, d2 time.Time) bool {
+	d1, d2 = cal.day(d1), cal.day(d2)
+	return d1.Year() == d2.Year() && d1.Month() == d2.Month() && d1.Day() == d2.Day()
+}
+
+// SameDay returns true if the days are the same ignoring hours, minutes,etc. Days are local and start at midnight,
+//Calendar.SameDay counts others.
+func SameDay(d1, d2 time.Time) bool {
+	return Calendar{}.SameDay(d1, d2)
 }
 
 func parseHabit(name, frequency string) (*Habit, error) {
@@ -107,51 +600,328 @@ func parseHabit(name, frequency string) (*Habit, error) {
 		return nil, errors.New("habit frequency cannot be empty")
 	}
 
-	h := Habit{Name: name}
-	switch frequency {
-	case "daily":
-		h.Frequency = DailyInterval
-	case "weekly":
-		h.Frequency = WeeklyInterval
-	default:
-		return nil, fmt.Errorf("unknown frequency: %s", frequency)
+	for _, f := range frequencies {
+		if f.name == frequency {
+			return &Habit{Name: name, Frequency: f.interval}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown frequency: %s", frequency)
+}
+
+//frequencies are the frequencies of habits by the names parseHabit accepts
+var frequencies = []struct {
+	name     string
+	interval time.Duration
+}{
+	{"daily", DailyInterval},
+	{"weekly", WeeklyInterval},
+}
+
+//parseQuantity sets the target and unit of h and returns the amount to log. Target and amount are numbers optionally
+//followed by the unit, as in 8, 5km or 20m.
+func parseQuantity(h *Habit, target, unit, amount string) (float64, error) {
+	h.Unit = unit
+	if target != "" {
+		value, suffix, err := splitQuantity(target)
+		if err != nil || value <= 0 {
+			return 0, fmt.Errorf("invalid target: %s", target)
+		}
+		h.Target = value
+		err = h.setUnit(suffix)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if amount == "" {
+		return 0, nil
+	}
+	value, suffix, err := splitQuantity(amount)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid amount: %s", amount)
+	}
+	return value, h.setUnit(suffix)
+}
+
+func splitQuantity(quantity string) (float64, string, error) {
+	quantity = strings.TrimSpace(quantity)
+	end := strings.IndexFunc(quantity, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if end == -1 {
+		end = len(quantity)
+	}
+	value, err := strconv.ParseFloat(quantity[:end], 64)
+	if err != nil {
+		return 0, "", err
+	}
+	return value, strings.TrimSpace(quantity[end:]), nil
+}
+
+func (h *Habit) setUnit(unit string) error {
+	if unit == "" || unit == h.Unit {
+		return nil
+	}
+	if h.Unit != "" {
+		return fmt.Errorf("conflicting units: %s and %s", h.Unit, unit)
+	}
+	h.Unit = unit
+	return nil
+}
+
+//formatAmount formats amount rounded to two decimals, followed by the unit if any
+func formatAmount(amount float64, unit string) string {
+	formatted := strconv.FormatFloat(math.Round(amount*100)/100, 'f', -1, 64)
+	if unit == "" {
+		return formatted
+	}
+	return formatted + " " + unit
+}
+
+func unitName(unit string) string {
+	if unit == "" {
+		return "check-ins"
 	}
-	return &h, nil
+	return unit
 }
+
 func (h Habit) String() string {
 	return h.Message
 }
 
-func (h *Habit) updateHabit() {
-	if SameDay(h.DueDate, time.Now()) {
+//updateHabit checks in the habit at the given time, logging amount toward the target of quantitative habits
+func (h *Habit) updateHabit(cal Calendar, now time.Time, amount float64) {
+	if h.Kind == QuitHabit {
+		h.updateQuitHabit(cal, now)
+		return
+	}
+	h.skipPausedDays(cal, now)
+	if h.DueOnCreation && h.LastCheckIn.IsZero() {
+		//the first check-in of a habit never done starts it afresh, however long after its start
+		h.DueDate = now
+	}
+	if h.Target > 0 {
+		h.updateQuantitativeHabit(cal, now, amount)
+		return
+	}
+	freezes := h.Freezes
+	if cal.SameDay(h.DueDate, now) {
 		//increase streak
-		h.Streak++
-		h.DueDate = time.Now().Add(h.Frequency)
+		h.extendStreak(now)
 		h.GenerateMessage(StreakMessage)
-	} else if SameDay(h.DueDate, time.Now().Add(h.Frequency)) {
+		h.reportEarnedFreeze(freezes)
+	} else if cal.SameDay(h.DueDate, now.Add(h.Frequency)) {
 		//repeated habit
 		h.GenerateMessage(RepeatMessage)
-	} else if !SameDay(h.DueDate, time.Now()) && !SameDay(h.DueDate, time.Now().Add(h.Frequency)) {
+	} else if kind := h.rescueStreak(cal, now); kind != 0 {
+		//late, but the streak is kept
+		freezes = h.Freezes
+		h.extendStreak(now)
+		h.GenerateMessage(kind)
+		h.reportEarnedFreeze(freezes)
+	} else {
 		//streak lost
 		h.GenerateMessage(BrokenMessage)
 		h.Streak = 0
-		h.DueDate = time.Now().Add(h.Frequency)
+		h.DueDate = now.Add(h.Frequency)
+	}
+}
+
+//updateQuantitativeHabit checks in a quantitative habit. Amounts add up toward the target of the period due on
+//DueDate, and the period only extends the streak once the target is reached.
+func (h *Habit) updateQuantitativeHabit(cal Calendar, now time.Time, amount float64) {
+	switch {
+	case cal.SameDay(h.DueDate, now):
+		freezes := h.Freezes
+		if h.addProgress(now, amount) {
+			h.GenerateMessage(StreakMessage)
+			h.reportEarnedFreeze(freezes)
+		} else {
+			h.GenerateMessage(ProgressMessage)
+		}
+	case cal.SameDay(h.DueDate, now.Add(h.Frequency)):
+		//target already reached
+		h.GenerateMessage(RepeatMessage)
+	default:
+		if kind := h.rescueStreak(cal, now); kind != 0 {
+			//late, but the streak is kept and today is a new period
+			freezes := h.Freezes
+			h.Progress = 0
+			h.DueDate = now
+			h.addProgress(now, amount)
+			h.GenerateMessage(kind)
+			h.reportEarnedFreeze(freezes)
+			return
+		}
+		//streak lost, today is a new period
+		h.GenerateMessage(BrokenMessage)
+		h.Streak = 0
+		h.Progress = 0
+		h.DueDate = now
+		if !h.addProgress(now, amount) {
+			h.Message += " " + h.progressMessage()
+		}
+	}
+}
+
+//updateQuitHabit records a slip on a quit habit, ending the streak built since the last check-in
+func (h *Habit) updateQuitHabit(cal Calendar, now time.Time) {
+	h.Streak = cal.periodsBetween(h.LastCheckIn, now, h.Frequency)
+	h.GenerateMessage(RelapseMessage)
+	h.Streak = 0
+	h.DueDate = now.Add(h.Frequency)
+}
+
+//currentStreak returns the streak of the habit at the given time. The streak of a quit habit is the number of periods
+//since its last check-in, the streak of other habits only changes when they are checked in.
+func (h *Habit) currentStreak(cal Calendar, now time.Time) int {
+	if h.Kind == QuitHabit {
+		return cal.periodsBetween(h.LastCheckIn, now, h.Frequency)
+	}
+	return h.Streak
+}
+
+//periodsBetween returns the number of whole calendar days, or weeks for weekly habits, between from and to
+func (cal Calendar) periodsBetween(from, to time.Time, frequency time.Duration) int {
+	from, to = cal.day(from), cal.day(to)
+	fromDay := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDay := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(toDay.Sub(fromDay) / DailyInterval)
+	if days < 0 {
+		return 0
+	}
+	if frequency == WeeklyInterval {
+		return days / 7
+	}
+	return days
+}
+
+//addProgress logs amount toward the period due today. Once the target is reached the period extends the streak and
+//the next one is due. It returns whether the target was reached.
+func (h *Habit) addProgress(now time.Time, amount float64) bool {
+	h.Progress += amount
+	//tolerate rounding errors from fractional amounts
+	if h.Progress < h.Target-1e-9 {
+		return false
+	}
+	h.Progress = 0
+	h.extendStreak(now)
+	return true
+}
+
+//extendStreak counts a completed period toward the streak and makes the next one due. A freeze is earned every
+//freezeEvery periods.
+func (h *Habit) extendStreak(now time.Time) {
+	h.Streak++
+	h.DueDate = now.Add(h.Frequency)
+	if h.Streak%freezeEvery == 0 && h.Freezes < maxFreezes {
+		h.Freezes++
 	}
 }
 
-//GenerateMessage creates the appropriate message for a given habit.
+//reportEarnedFreeze tells about the freeze earned since the habit had the given number of freezes
+func (h *Habit) reportEarnedFreeze(freezes int) {
+	if h.Freezes > freezes {
+		h.Message += " " + fmt.Sprintf(freezeEarned, h.Freezes)
+	}
+}
+
+//rescueStreak keeps the streak of a habit checked in after its due date, first with its grace period and otherwise
+//with a freeze for every missed period. It returns the kind of message reporting how the streak was saved, or zero if
+//the streak is lost.
+func (h *Habit) rescueStreak(cal Calendar, now time.Time) MessageKind {
+	if !h.DueDate.Before(now) {
+		return 0
+	}
+	daysLate := cal.periodsBetween(h.DueDate, now, DailyInterval)
+	graceAvailable := h.GraceUsedAt.IsZero() || now.Sub(h.GraceUsedAt) >= WeeklyInterval
+	if daysLate <= h.GraceDays && graceAvailable {
+		h.GraceUsedAt = now
+		return GraceMessage
+	}
+	missed := daysLate
+	if h.Frequency == WeeklyInterval {
+		missed = (daysLate + 6) / 7
+	}
+	if missed > 0 && missed <= h.Freezes {
+		h.Freezes -= missed
+		return FreezeMessage
+	}
+	return 0
+}
+
+//checkInAmount returns the amount logged by a check-in, quantitative habits log one unit by default
+func (h *Habit) checkInAmount(amount float64) float64 {
+	if amount == 0 && h.Target > 0 {
+		return 1
+	}
+	return amount
+}
+
+func (h *Habit) progressMessage() string {
+	return fmt.Sprintf(progressHabit, formatAmount(h.Progress, ""), formatAmount(h.Target, h.Unit), h.Name,
+		formatAmount(h.Target-h.Progress, h.Unit))
+}
+
+//recomputeStreak replays the habit's check-in history from its creation to rebuild its streak and due date. Habits
+//created before check-ins were recorded have no CreatedAt and are left untouched.
+func (h *Habit) recomputeStreak(cal Calendar) {
+	if h.CreatedAt.IsZero() {
+		return
+	}
+	sort.Slice(h.CheckIns, func(i, j int) bool {
+		return h.CheckIns[i].Time.Before(h.CheckIns[j].Time)
+	})
+	h.Streak = 0
+	h.Progress = 0
+	h.DueDate = cal.local(h.CreatedAt).Add(h.Frequency)
+	if h.Target > 0 || h.DueOnCreation {
+		//the first check-in of a quantitative habit is its creation, which is due right away
+		h.DueDate = cal.local(h.CreatedAt)
+	}
+	h.Freezes = 0
+	h.GraceUsedAt = time.Time{}
+	h.LastCheckIn = h.CreatedAt
+	if h.DueOnCreation && h.Kind != QuitHabit {
+		h.LastCheckIn = time.Time{}
+	}
+	h.GenerateMessage(NewMessage)
+	for _, c := range h.CheckIns {
+		h.updateHabit(cal, cal.local(c.Time), c.Amount)
+		h.LastCheckIn = c.Time
+	}
+}
+
+//GenerateMessage creates the appropriate message for a given habit and records its kind.
 func (h *Habit) GenerateMessage(kind MessageKind) {
 	var intervalString string
+	h.MessageKind = kind
 	switch kind {
 	case NewMessage:
+		if h.Kind == QuitHabit {
+			intervalString = "day"
+			if h.Frequency == WeeklyInterval {
+				intervalString = "week"
+			}
+			h.Message = fmt.Sprintf(quitHabit, h.Name, intervalString)
+			break
+		}
 		if h.Frequency == WeeklyInterval {
 			intervalString = "in a week"
 		} else {
 			intervalString = "tomorrow"
 		}
 		h.Message = fmt.Sprintf(newHabit, h.Name, intervalString)
+		if h.DueOnCreation && h.LastCheckIn.IsZero() {
+			h.Message = fmt.Sprintf(startedHabit, h.Name)
+		}
+		if h.Target > 0 && h.Progress > 0 {
+			h.Message += " " + h.progressMessage()
+		}
 	case RepeatMessage:
 		h.Message = fmt.Sprintf(repeatedHabit, h.Name)
+		if h.Target > 0 {
+			h.Message = fmt.Sprintf(targetReached, formatAmount(h.Target, h.Unit), h.Name)
+		}
 	case StreakMessage:
 		if h.Frequency == WeeklyInterval {
 			intervalString = "weeks"
@@ -168,5 +938,29 @@ func (h *Habit) GenerateMessage(kind MessageKind) {
 			sinceDays = (sinceDuration.Hours() / 24.0) / 7.0
 		}
 		h.Message = fmt.Sprintf(brokeStreak, h.Name, sinceDays, intervalString)
+	case ProgressMessage:
+		h.Message = h.progressMessage()
+	case RelapseMessage:
+		h.Message = fmt.Sprintf(relapsedHabit, h.Name, h.Streak, periodName(h.Frequency))
+	case GraceMessage, FreezeMessage:
+		if h.Target > 0 && h.Progress > 0 {
+			h.Message = h.progressMessage()
+		} else {
+			h.GenerateMessage(StreakMessage)
+			h.MessageKind = kind
+		}
+		if kind == GraceMessage {
+			h.Message += " " + graceSaved
+		} else {
+			h.Message += " " + fmt.Sprintf(freezeSaved, h.Freezes)
+		}
+	}
+}
+
+//periodName returns the plural name of the habit's periods
+func periodName(frequency time.Duration) string {
+	if frequency == WeeklyInterval {
+		return "weeks"
 	}
+	return "days"
 }
@@ -1,6 +1,7 @@
 package habit_test
 
 import (
+	"fmt"
 	"github.com/crmejia/habit"
 	"strings"
 	"testing"
@@ -10,7 +11,7 @@ import (
 func TestNewController(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -31,7 +32,7 @@ func TestNewControllerReturnsErrorOnNilStore(t *testing.T) {
 func TestController_HandleReturnsErrorOnNilHabit(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -44,7 +45,7 @@ func TestController_HandleReturnsErrorOnNilHabit(t *testing.T) {
 func TestController_HandleReturnsErrorOnEmptyHabitName(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -60,10 +61,10 @@ func TestController_HandleUpdatesStreaksDueDateCorrectly(t *testing.T) {
 	inputHabit := habit.Habit{
 		Name: "piano",
 	}
-	store := habit.MemoryStore{
-		Habits: map[string]*habit.Habit{"piano": &inputHabit},
+	store := &habit.MemoryStore{
+		Habits: map[string]map[string]*habit.Habit{"": {"piano": &inputHabit}},
 	}
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -87,6 +88,8 @@ func TestController_HandleUpdatesStreaksDueDateCorrectly(t *testing.T) {
 		inputHabit.Streak = tc.streak
 		inputHabit.DueDate = tc.dueDate
 		inputHabit.Frequency = tc.interval
+		stored := inputHabit
+		store.Habits[""]["piano"] = &stored
 
 		h, err := controller.Handle(&inputHabit)
 		if err != nil {
@@ -96,7 +99,7 @@ func TestController_HandleUpdatesStreaksDueDateCorrectly(t *testing.T) {
 		if h.Name != "piano" {
 			t.Errorf("wantedStreak piano to be the habit's testName got %s", h.Name)
 		}
-		if store.Habits["piano"].Streak != tc.wantedStreak {
+		if store.Habits[""]["piano"].Streak != tc.wantedStreak {
 			t.Errorf("%s. Want habit.Streak to be %d got %d", tc.name, tc.wantedStreak, h.Streak)
 		}
 
@@ -109,7 +112,7 @@ func TestController_HandleUpdatesStreaksDueDateCorrectly(t *testing.T) {
 func TestController_HandleCreatesErrorsOnNoInterval(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -124,7 +127,7 @@ func TestController_HandleCreatesErrorsOnNoInterval(t *testing.T) {
 func TestController_HandleCreatesHabit(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -135,7 +138,7 @@ func TestController_HandleCreatesHabit(t *testing.T) {
 		t.Errorf("expected handle to return no errors, got: %s", err)
 	}
 
-	if store.Habits["piano"] == nil {
+	if store.Habits[""]["piano"] == nil {
 		t.Errorf("want new habit to be inserted into store")
 	}
 }
@@ -143,21 +146,598 @@ func TestController_HandleCreatesHabit(t *testing.T) {
 func TestController_AllHabits(t *testing.T) {
 	t.Parallel()
 	testCases := []struct {
-		store habit.MemoryStore
+		store *habit.MemoryStore
 		want  string
 	}{
-		{store: habit.MemoryStore{Habits: map[string]*habit.Habit{}}, want: "no habits have been started"},
-		{store: habit.MemoryStore{Habits: map[string]*habit.Habit{"piano": {Name: "piano"}}}, want: "piano"},
+		{store: &habit.MemoryStore{Habits: map[string]map[string]*habit.Habit{}}, want: "no habits have been started"},
+		{store: &habit.MemoryStore{Habits: map[string]map[string]*habit.Habit{"": {"piano": {Name: "piano"}}}}, want: "piano"},
 	}
 
 	for _, tc := range testCases {
-		controller, err := habit.NewController(&tc.store)
+		controller, err := habit.NewController(tc.store)
 		if err != nil {
 			t.Fatal(err)
 		}
-		got := controller.GetAllHabits()
+		got := controller.GetAllHabits("")
 		if !strings.Contains(got, tc.want) {
 			t.Errorf("want output to contain %s, got:\n    %s", tc.want, got)
 		}
 	}
 }
+
+func TestController_GetHabitsTellsEmptyStoreFromNoMatch(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(habit.OpenMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := habit.HabitQuery{User: "alice", SortBy: habit.SortByStreak, Limit: 5}
+	got, err := controller.GetHabits(query)
+	if err != nil || got != "no habits have been started" {
+		t.Errorf("want an empty store reported whatever the order and page, got %q, %v", got, err)
+	}
+	_, err = controller.Handle(&habit.Habit{Name: "piano", User: "alice", Frequency: habit.DailyInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query.Offset = 1
+	got, err = controller.GetHabits(query)
+	if err != nil || got != "no habits match" {
+		t.Errorf("want a page past the habits to match none, got %q, %v", got, err)
+	}
+}
+
+func TestController_HandleRecordsCheckInHistory(t *testing.T) {
+	t.Parallel()
+	store := habit.OpenMemoryStore()
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := controller.Handle(&habit.Habit{Name: "piano", Frequency: habit.DailyInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.CreatedAt.IsZero() || h.UpdatedAt.IsZero() || len(h.CheckIns) != 0 {
+		t.Errorf("want new habit to record its creation without check-ins, got %+v", h)
+	}
+
+	h, err = controller.Handle(&habit.Habit{Name: "piano"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.CheckIns) != 1 || !habit.SameDay(h.CheckIns[0].Time, time.Now()) {
+		t.Errorf("want check in to be recorded, got %+v", h.CheckIns)
+	}
+}
+
+func TestController_HandleAmountCountsStreakOnceTargetIsReached(t *testing.T) {
+	t.Parallel()
+	store := habit.OpenMemoryStore()
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name       string
+		amount     float64
+		wantStreak int
+		wantKind   habit.MessageKind
+		wantMsg    string
+	}{
+		{"creation logs the first amount", 2, 0, habit.NewMessage, "You've logged 2 of 8 glasses for 'water' today, 6 glasses to go."},
+		{"zero amount logs one unit", 0, 0, habit.ProgressMessage, "You've logged 3 of 8 glasses for 'water' today, 5 glasses to go."},
+		{"fractional amounts add up", 4.5, 0, habit.ProgressMessage, "You've logged 7.5 of 8 glasses"},
+		{"reaching the target extends the streak", 0.5, 1, habit.StreakMessage, "for 1 days in a row"},
+		{"amounts after reaching the target", 3, 1, habit.RepeatMessage, "You already reached today's target of 8 glasses for 'water'"},
+	}
+
+	for _, tc := range testCases {
+		h, err := controller.HandleAmount(&habit.Habit{Name: "water", Frequency: habit.DailyInterval, Target: 8,
+			Unit: "glasses"}, tc.amount)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if h.Streak != tc.wantStreak || h.MessageKind != tc.wantKind || !strings.Contains(h.Message, tc.wantMsg) {
+			t.Errorf("%s: want streak %d and %s message containing %q, got streak %d and %s message %q", tc.name,
+				tc.wantStreak, tc.wantKind, tc.wantMsg, h.Streak, h.MessageKind, h.Message)
+		}
+	}
+
+	h := store.Habits[""]["water"]
+	if len(h.CheckIns) != len(testCases) || h.CheckIns[1].Amount != 1 {
+		t.Errorf("want every amount to be recorded as a check-in, got %+v", h.CheckIns)
+	}
+	if !habit.SameDay(h.DueDate, time.Now().Add(habit.DailyInterval)) || h.Progress != 0 {
+		t.Errorf("want the next period to be due tomorrow with no progress, got due %s with progress %g", h.DueDate,
+			h.Progress)
+	}
+}
+
+func TestController_HandleAmountRestartsOverdueQuantitativeHabit(t *testing.T) {
+	t.Parallel()
+	store := &habit.MemoryStore{Habits: map[string]map[string]*habit.Habit{"": {"run": {Name: "run",
+		Frequency: habit.DailyInterval, Target: 5, Unit: "km", Streak: 4, Progress: 3,
+		DueDate: time.Now().Add(-2 * habit.DailyInterval)}}}}
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := controller.HandleAmount(&habit.Habit{Name: "run"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Streak != 0 || h.Progress != 2 || !habit.SameDay(h.DueDate, time.Now()) {
+		t.Errorf("want overdue habit to restart with today's amount, got %+v", h)
+	}
+	if h.MessageKind != habit.BrokenMessage || !strings.Contains(h.Message, "2 of 5 km") {
+		t.Errorf("want broken streak message with progress, got %q", h.Message)
+	}
+}
+
+func TestController_HandleAmountErrors(t *testing.T) {
+	t.Parallel()
+	store := &habit.MemoryStore{Habits: map[string]map[string]*habit.Habit{"": {
+		"piano": {Name: "piano", Frequency: habit.DailyInterval},
+		"water": {Name: "water", Frequency: habit.DailyInterval, Target: 8, Unit: "glasses"},
+	}}}
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name   string
+		input  habit.Habit
+		amount float64
+	}{
+		{"negative amount", habit.Habit{Name: "water"}, -1},
+		{"amount on habit without target", habit.Habit{Name: "piano"}, 2},
+		{"mismatched unit", habit.Habit{Name: "water", Unit: "km"}, 2},
+		{"amount on new habit without target", habit.Habit{Name: "run", Frequency: habit.DailyInterval}, 2},
+		{"negative target", habit.Habit{Name: "run", Frequency: habit.DailyInterval, Target: -5}, 0},
+	}
+	for _, tc := range testCases {
+		_, err := controller.HandleAmount(&tc.input, tc.amount)
+		if err == nil {
+			t.Errorf("%s: want HandleAmount to fail", tc.name)
+		}
+	}
+}
+
+func TestController_CheckInBackfillsAndDeduplicates(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	created := time.Date(now.Year(), now.Month(), now.Day()-3, 9, 0, 0, 0, time.Local)
+	store := &habit.MemoryStore{Habits: map[string]map[string]*habit.Habit{"alice": {
+		"piano": {Name: "piano", User: "alice", Frequency: habit.DailyInterval, CreatedAt: created,
+			LastCheckIn: created, DueDate: created.Add(habit.DailyInterval)},
+	}}}
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := controller.CheckIn("alice", "piano", habit.CheckIn{Time: created.AddDate(0, 0, 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Streak == 2 {
+		t.Fatal("want the streak to be broken before the missed day is backfilled")
+	}
+	h, err = controller.CheckIn("alice", "piano", habit.CheckIn{Time: created.AddDate(0, 0, 1), Key: "k1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Streak != 2 || !h.LastCheckIn.Equal(created.AddDate(0, 0, 2)) {
+		t.Errorf("want backfilled check-in to replay a 2-day streak, got %d last checked in %s", h.Streak,
+			h.LastCheckIn)
+	}
+
+	_, err = controller.CheckIn("alice", "piano", habit.CheckIn{Key: "k1"})
+	if err != habit.ErrDuplicateCheckIn {
+		t.Errorf("want ErrDuplicateCheckIn, got %v", err)
+	}
+	if len(h.CheckIns) != 2 {
+		t.Errorf("want duplicate check-in not to be recorded, got %+v", h.CheckIns)
+	}
+
+	testCases := []struct {
+		name    string
+		habit   string
+		checkIn habit.CheckIn
+	}{
+		{"future check-in", "piano", habit.CheckIn{Time: now.Add(time.Hour)}},
+		{"check-in before creation", "piano", habit.CheckIn{Time: created.Add(-time.Hour)}},
+		{"amount on habit without target", "piano", habit.CheckIn{Amount: 2}},
+		{"missing habit", "surfing", habit.CheckIn{}},
+		{"empty name", "", habit.CheckIn{}},
+	}
+	for _, tc := range testCases {
+		_, err := controller.CheckIn("alice", tc.habit, tc.checkIn)
+		if err == nil {
+			t.Errorf("%s: want CheckIn to fail", tc.name)
+		}
+	}
+}
+
+func TestController_ShowHabitListsLastNotes(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(habit.OpenMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.HandleCheckIn(&habit.Habit{Name: "water", Frequency: habit.DailyInterval, Target: 8},
+		habit.CheckIn{Note: "note 0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.HandleCheckIn(&habit.Habit{Name: "water"}, habit.CheckIn{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		_, err = controller.HandleCheckIn(&habit.Habit{Name: "water"}, habit.CheckIn{Note: fmt.Sprint("note ", i),
+			Rating: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = controller.HandleCheckIn(&habit.Habit{Name: "water"}, habit.CheckIn{Rating: -1})
+	if err == nil {
+		t.Error("want negative rating to fail")
+	}
+
+	details, err := controller.ShowHabit("", "water")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := strings.Index(details, "Notes:\n")
+	if i == -1 {
+		t.Fatalf("want notes to be shown, got:\n%s", details)
+	}
+	notes := details[i:]
+	if strings.Contains(notes, "note 0") || strings.Count(notes, "\n") != 6 {
+		t.Errorf("want the last 5 notes to be shown, got:\n%s", notes)
+	}
+	if !strings.Contains(notes, "  1/5  note 1\n") || !strings.HasSuffix(notes, "  5/5  note 5\n") {
+		t.Errorf("want notes to be shown oldest first with their rating, got:\n%s", notes)
+	}
+}
+
+func TestController_QuitHabitCountsPeriodsSinceLastSlip(t *testing.T) {
+	t.Parallel()
+	store := habit.OpenMemoryStore()
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := controller.Handle(&habit.Habit{Name: "smoking", Frequency: habit.DailyInterval, Kind: habit.QuitHabit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Good luck quitting 'smoking'! Only log it when you slip, your streak grows every day you don't."
+	if h.Message != want {
+		t.Errorf("want quit habit message %q, got %q", want, h.Message)
+	}
+
+	fiveDaysAgo := time.Now().Add(-5 * habit.DailyInterval)
+	store.Habits[""]["smoking"].LastCheckIn = fiveDaysAgo
+	store.Habits[""]["smoking"].CreatedAt = fiveDaysAgo
+	got := controller.GetAllHabits("")
+	if !strings.Contains(got, "You've gone 5 days without 'smoking'. Stick to it!") {
+		t.Errorf("want streak to grow with elapsed time, got:\n%s", got)
+	}
+
+	h, err = controller.Handle(&habit.Habit{Name: "smoking"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "You slipped on 'smoking' after 5 days. Don't give up, your new streak starts now!"
+	if h.Message != want || h.MessageKind != habit.RelapseMessage || h.Streak != 0 {
+		t.Errorf("want check in to record a slip, got %+v", h)
+	}
+	details, err := controller.ShowHabit("", "smoking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(details, "Kind: quit\n") || !strings.Contains(details, "Streak: 0\n") ||
+		strings.Contains(details, "Due:") {
+		t.Errorf("want show to display the quit habit's streak, got:\n%s", details)
+	}
+}
+
+func TestController_QuitHabitCountsWeeks(t *testing.T) {
+	t.Parallel()
+	store := &habit.MemoryStore{Habits: map[string]map[string]*habit.Habit{"": {"sugar": {Name: "sugar",
+		Frequency: habit.WeeklyInterval, Kind: habit.QuitHabit, LastCheckIn: time.Now().Add(-15 * habit.DailyInterval)}}}}
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := controller.GetAllHabits("")
+	if !strings.Contains(got, "You've gone 2 weeks without 'sugar'") {
+		t.Errorf("want weekly quit habit to count weeks, got:\n%s", got)
+	}
+}
+
+func TestController_QuitHabitCannotHaveTarget(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(habit.OpenMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.Handle(&habit.Habit{Name: "sugar", Frequency: habit.DailyInterval, Kind: habit.QuitHabit,
+		Target: 2})
+	if err == nil {
+		t.Error("want quit habit with a target to fail")
+	}
+}
+
+func TestController_HandleRescuesLateStreaks(t *testing.T) {
+	t.Parallel()
+	yesterday := time.Now().Add(-1 * habit.DailyInterval)
+	twoDaysAgo := time.Now().Add(-2 * habit.DailyInterval)
+	testCases := []struct {
+		name        string
+		habit       habit.Habit
+		amount      float64
+		wantStreak  int
+		wantFreezes int
+		wantKind    habit.MessageKind
+		wantMsg     string
+	}{
+		{
+			name:       "grace period saves a late check in",
+			habit:      habit.Habit{Streak: 5, DueDate: yesterday, GraceDays: 1},
+			wantStreak: 6, wantKind: habit.GraceMessage,
+			wantMsg: "for 6 days in a row now. Keep it up! You were late, but your grace period saved your streak.",
+		},
+		{
+			name:       "grace period is used once a week",
+			habit:      habit.Habit{Streak: 5, DueDate: yesterday, GraceDays: 1, GraceUsedAt: twoDaysAgo},
+			wantStreak: 0, wantKind: habit.BrokenMessage,
+		},
+		{
+			name:       "grace period does not cover longer delays",
+			habit:      habit.Habit{Streak: 5, DueDate: twoDaysAgo, GraceDays: 1},
+			wantStreak: 0, wantKind: habit.BrokenMessage,
+		},
+		{
+			name:       "freezes cover every missed day",
+			habit:      habit.Habit{Streak: 5, DueDate: twoDaysAgo, Freezes: 2},
+			wantStreak: 6, wantFreezes: 0, wantKind: habit.FreezeMessage,
+			wantMsg: "Your streak was saved by a freeze, 0 left.",
+		},
+		{
+			name:       "too few freezes are kept",
+			habit:      habit.Habit{Streak: 5, DueDate: twoDaysAgo, Freezes: 1},
+			wantStreak: 0, wantFreezes: 1, wantKind: habit.BrokenMessage,
+		},
+		{
+			name:       "freezes are earned every 7 days",
+			habit:      habit.Habit{Streak: 6, DueDate: time.Now()},
+			wantStreak: 7, wantFreezes: 1, wantKind: habit.StreakMessage,
+			wantMsg: "You earned a streak freeze, you now have 1.",
+		},
+		{
+			name:       "freezes are capped",
+			habit:      habit.Habit{Streak: 13, DueDate: time.Now(), Freezes: 2},
+			wantStreak: 14, wantFreezes: 2, wantKind: habit.StreakMessage,
+			wantMsg: "for 14 days in a row now. Keep it up!",
+		},
+		{
+			name:       "freezes keep the streak of quantitative habits",
+			habit:      habit.Habit{Streak: 5, DueDate: yesterday, Freezes: 1, Target: 2, Unit: "km"},
+			amount:     1,
+			wantStreak: 5, wantFreezes: 0, wantKind: habit.FreezeMessage,
+			wantMsg: "You've logged 1 of 2 km for 'piano' today, 1 km to go. Your streak was saved by a freeze, 0 left.",
+		},
+	}
+
+	for _, tc := range testCases {
+		h := tc.habit
+		h.Name = "piano"
+		h.Frequency = habit.DailyInterval
+		store := &habit.MemoryStore{Habits: map[string]map[string]*habit.Habit{"": {"piano": &h}}}
+		controller, err := habit.NewController(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := controller.HandleAmount(&habit.Habit{Name: "piano"}, tc.amount)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got.Streak != tc.wantStreak || got.Freezes != tc.wantFreezes || got.MessageKind != tc.wantKind {
+			t.Errorf("%s: want streak %d, %d freezes and %s message, got streak %d, %d freezes and %s message",
+				tc.name, tc.wantStreak, tc.wantFreezes, tc.wantKind, got.Streak, got.Freezes, got.MessageKind)
+		}
+		if !strings.HasSuffix(got.Message, tc.wantMsg) {
+			t.Errorf("%s: want message ending in %q, got %q", tc.name, tc.wantMsg, got.Message)
+		}
+	}
+}
+
+func TestController_CreateStartsDueOrCheckedIn(t *testing.T) {
+	t.Parallel()
+	store := habit.OpenMemoryStore()
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := controller.Create("alice", "piano", habit.CreateOptions{Description: "scales"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Streak != 0 || !habit.SameDay(h.DueDate, time.Now()) || !h.LastCheckIn.IsZero() || len(h.CheckIns) != 0 {
+		t.Errorf("want the habit due today and not checked in, got streak %d due %s, %d check-ins", h.Streak,
+			h.DueDate, len(h.CheckIns))
+	}
+	if h.Frequency != habit.DailyInterval || h.Description != "scales" || h.MessageKind != habit.NewMessage ||
+		!strings.Contains(h.Message, "Check it in to start your streak") {
+		t.Errorf("want a new daily habit described as scales, got %+v", h)
+	}
+	h, err = controller.CheckIn("alice", "piano", habit.CheckIn{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Streak != 1 || !habit.SameDay(h.DueDate, time.Now().Add(habit.DailyInterval)) {
+		t.Errorf("want the first check-in to start the streak, got streak %d due %s", h.Streak, h.DueDate)
+	}
+
+	h, err = controller.Create("alice", "run", habit.CreateOptions{Frequency: habit.WeeklyInterval, Target: 10,
+		Unit: "km", FirstCheckIn: &habit.CheckIn{Amount: 10, Note: "park loop"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Streak != 1 || h.Progress != 0 || len(h.CheckIns) != 1 || h.CheckIns[0].Note != "park loop" ||
+		!habit.SameDay(h.DueDate, time.Now().Add(habit.WeeklyInterval)) {
+		t.Errorf("want the creation to count as a check-in reaching the target, got streak %d, progress %v, "+
+			"check-ins %+v, due %s", h.Streak, h.Progress, h.CheckIns, h.DueDate)
+	}
+
+	_, err = controller.Create("alice", "piano", habit.CreateOptions{})
+	if err != habit.ErrHabitExists {
+		t.Errorf("want ErrHabitExists creating an existing habit, got %v", err)
+	}
+	_, err = controller.CheckIn("alice", "surfing", habit.CheckIn{})
+	if err == nil {
+		t.Error("want check-ins of unknown habits refused")
+	}
+}
+
+func TestController_CreateBackfillsFromStart(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), now.Day()-3, 12, 0, 0, 0, time.Local)
+	store := habit.OpenMemoryStore()
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := controller.Create("alice", "piano", habit.CreateOptions{Start: start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.CreatedAt.Equal(start) || !h.DueDate.Equal(start) {
+		t.Errorf("want the habit started and due %s, got created %s due %s", start, h.CreatedAt, h.DueDate)
+	}
+
+	_, err = controller.CheckIn("alice", "piano", habit.CheckIn{Time: start.AddDate(0, 0, -1)})
+	if err == nil {
+		t.Error("want check-ins before the start refused")
+	}
+	for _, days := range []int{1, 0, 2} {
+		_, err = controller.CheckIn("alice", "piano", habit.CheckIn{Time: start.AddDate(0, 0, days)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	h, err = controller.CheckIn("alice", "piano", habit.CheckIn{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Streak != 4 || len(h.CheckIns) != 4 {
+		t.Errorf("want the backfilled days to count from the start, got streak %d and %d check-ins", h.Streak,
+			len(h.CheckIns))
+	}
+}
+
+func TestController_CreateBackdatedStartsStreakOnFirstCheckIn(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), now.Day()-5, 12, 0, 0, 0, time.Local)
+	controller, err := habit.NewController(habit.OpenMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, options := range []habit.CreateOptions{{Start: start}, {Start: start, Target: 2, Unit: "km"}} {
+		name := "piano"
+		if options.Target > 0 {
+			name = "run"
+		}
+		_, err = controller.Create("alice", name, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := controller.CheckIn("alice", name, habit.CheckIn{Amount: options.Target})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Streak != 1 || h.MessageKind != habit.StreakMessage ||
+			!habit.SameDay(h.DueDate, now.Add(habit.DailyInterval)) {
+			t.Errorf("%s: want the first check-in to start the streak, got streak %d due %s: %s", name, h.Streak,
+				h.DueDate, h.Message)
+		}
+	}
+}
+
+func TestController_CreateErrors(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(habit.OpenMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name    string
+		habit   string
+		options habit.CreateOptions
+	}{
+		{"empty name", "", habit.CreateOptions{}},
+		{"invalid frequency", "piano", habit.CreateOptions{Frequency: time.Hour}},
+		{"negative target", "piano", habit.CreateOptions{Target: -1}},
+		{"unit without target", "piano", habit.CreateOptions{Unit: "km"}},
+		{"future start", "piano", habit.CreateOptions{Start: time.Now().Add(48 * time.Hour)}},
+		{"quit habit checked in", "smoking", habit.CreateOptions{Kind: habit.QuitHabit,
+			FirstCheckIn: &habit.CheckIn{}}},
+		{"check-in before start", "piano", habit.CreateOptions{FirstCheckIn: &habit.CheckIn{
+			Time: time.Now().Add(-48 * time.Hour)}}},
+		{"amount without target", "piano", habit.CreateOptions{FirstCheckIn: &habit.CheckIn{Amount: 2}}},
+		{"invalid rating", "piano", habit.CreateOptions{FirstCheckIn: &habit.CheckIn{Rating: 6}}},
+	}
+	for _, tc := range testCases {
+		_, err := controller.Create("alice", tc.habit, tc.options)
+		if err == nil {
+			t.Errorf("%s: want an error", tc.name)
+		}
+	}
+	if habits := controller.Store.GetAllHabits("alice"); len(habits) != 0 {
+		t.Errorf("want no habit created, got %d", len(habits))
+	}
+}
+
+func TestMessageKindValuesAreStable(t *testing.T) {
+	t.Parallel()
+	kinds := []habit.MessageKind{habit.NewMessage, habit.RepeatMessage, habit.StreakMessage, habit.BrokenMessage,
+		habit.ProgressMessage, habit.RelapseMessage, habit.GraceMessage, habit.FreezeMessage}
+	for i, kind := range kinds {
+		if int(kind) != 7+i {
+			t.Errorf("want %s stored as %d, got %d", kind, 7+i, int(kind))
+		}
+	}
+}
+
+func TestController_CalendarCountsDaysFromDayStart(t *testing.T) {
+	t.Parallel()
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), now.Day()-3, 12, 0, 0, 0, time.UTC)
+	for _, dayStart := range []time.Duration{0, 4 * time.Hour} {
+		controller, err := habit.NewController(habit.OpenMemoryStore())
+		if err != nil {
+			t.Fatal(err)
+		}
+		controller.Calendar = habit.Calendar{Location: time.UTC, DayStart: dayStart}
+		_, err = controller.Create("alice", "piano", habit.CreateOptions{Start: start, FirstCheckIn: &habit.CheckIn{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		//2 a.m. two days after the start still counts toward the day after the start from 4 a.m.
+		h, err := controller.CheckIn("alice", "piano", habit.CheckIn{Time: start.Add(38 * time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wantStreak := map[time.Duration]int{0: 0, 4 * time.Hour: 2}[dayStart]; h.Streak != wantStreak {
+			t.Errorf("day start %s: want streak %d, got %d: %s", dayStart, wantStreak, h.Streak, h.Message)
+		}
+	}
+}
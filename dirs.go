@@ -0,0 +1,89 @@
+package habit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+//projectDirName is the directory holding the store of a project, found in the working directory or its parents
+const projectDirName = ".habit"
+
+//DataDir returns the directory habit keeps its stores in by default: habit in $XDG_DATA_HOME, which defaults to
+//~/.local/share.
+func DataDir() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		homeDir, err := homedir.Dir()
+		if err != nil {
+			return "", err
+		}
+		dataHome = filepath.Join(homeDir, ".local", "share")
+	}
+	return filepath.Join(dataHome, "habit"), nil
+}
+
+//FindProjectDir looks for a .habit directory in dir and its parents, like git looks for .git, and returns its path. It
+//returns an empty path if there is none.
+func FindProjectDir(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, projectDirName)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+//projectStoreType returns the type of the store kept in a project directory: file if it holds a file store, otherwise
+//db
+func projectStoreType(dir string) string {
+	if _, err := os.Stat(filepath.Join(dir, ".habitTracker")); err == nil {
+		return "file"
+	}
+	return "db"
+}
+
+//migrateHomeFiles creates dataDir and moves the stores and the webhook queue that were kept in the home directory,
+//before habit followed the XDG base directory spec, into it. Nothing is moved once dataDir holds a store. It returns
+//the files moved.
+func migrateHomeFiles(homeDir, dataDir string) ([]string, error) {
+	err := os.MkdirAll(dataDir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := filepath.Glob(filepath.Join(dataDir, ".habitTracker*"))
+	if err != nil || len(existing) > 0 {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(homeDir, ".habitTracker*"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, ".habitWebhooks.json")); err == nil {
+		files = append(files, filepath.Join(homeDir, ".habitWebhooks.json"))
+	}
+	var moved []string
+	for _, file := range files {
+		target := filepath.Join(dataDir, filepath.Base(file))
+		if _, err := os.Stat(target); err == nil {
+			continue
+		}
+		err = os.Rename(file, target)
+		if err != nil {
+			return moved, fmt.Errorf("could not move %s to %s: %w", file, dataDir, err)
+		}
+		moved = append(moved, file)
+	}
+	return moved, nil
+}
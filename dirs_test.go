@@ -0,0 +1,144 @@
+package habit_test
+
+import (
+	"bytes"
+	"github.com/crmejia/habit"
+	"github.com/mitchellh/go-homedir"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindProjectDir(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	project := filepath.Join(tmpDir, "repo", ".habit")
+	nested := filepath.Join(tmpDir, "repo", "src", "pkg")
+	for _, dir := range []string{project, nested} {
+		err := os.MkdirAll(dir, 0700)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := habit.FindProjectDir(nested); got != project {
+		t.Errorf("want the .habit directory of a parent, got %q", got)
+	}
+	if got := habit.FindProjectDir(project); got != project {
+		t.Errorf("want the .habit directory itself, got %q", got)
+	}
+	if got := habit.FindProjectDir(tmpDir); got != "" {
+		t.Errorf("want no project outside the repo, got %q", got)
+	}
+}
+
+//useTempHome points the home, data and config directories to temporary directories for the rest of the test
+func useTempHome(t *testing.T) (homeDir, dataDir string) {
+	t.Cleanup(homedir.Reset)
+	homeDir, dataDir = t.TempDir(), t.TempDir()
+	t.Setenv("HOME", homeDir)
+	t.Setenv("XDG_DATA_HOME", dataDir)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	homedir.Reset()
+	return homeDir, filepath.Join(dataDir, "habit")
+}
+
+func TestRunCLIMigratesHomeStore(t *testing.T) {
+	homeDir, dataDir := useTempHome(t)
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", homeDir, "piano"}, &buffer)
+
+	buffer.Reset()
+	status := habit.RunCLI([]string{"all"}, &buffer)
+	if status != 0 || !strings.Contains(buffer.String(), "Moved "+filepath.Join(homeDir, ".habitTracker.db")+" to "+
+		dataDir) || !strings.Contains(buffer.String(), "piano") {
+		t.Fatalf("want the home store moved to the data directory, got %d:\n%s", status, buffer.String())
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, ".habitTracker.db")); !os.IsNotExist(err) {
+		t.Errorf("want the home store gone, got %v", err)
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"all"}, &buffer)
+	if strings.Contains(buffer.String(), "Moved") || !strings.Contains(buffer.String(), "piano") {
+		t.Errorf("want the store migrated once, got:\n%s", buffer.String())
+	}
+}
+
+func TestRunCLICompletionLeavesHomeStore(t *testing.T) {
+	homeDir, dataDir := useTempHome(t)
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", homeDir, "piano"}, &buffer)
+
+	buffer.Reset()
+	status := habit.RunCLI([]string{"__complete", "--", "log", ""}, &buffer)
+	if status != 0 || buffer.Len() != 0 {
+		t.Errorf("want no candidates from the unmigrated store, got %d:\n%s", status, buffer.String())
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, ".habitTracker.db")); err != nil {
+		t.Errorf("want the home store left in place, got %v", err)
+	}
+	if _, err := os.Stat(dataDir); !os.IsNotExist(err) {
+		t.Errorf("want no data directory created, got %v", err)
+	}
+
+	buffer.Reset()
+	status = habit.RunCLI([]string{"__complete", "--", "-d", homeDir, "log", ""}, &buffer)
+	if status != 0 || strings.TrimSpace(buffer.String()) != "piano" {
+		t.Errorf("want habits completed from the store directory, got %d:\n%s", status, buffer.String())
+	}
+}
+
+func TestRunCLIUsesProjectStore(t *testing.T) {
+	_, dataDir := useTempHome(t)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	repo, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	project := filepath.Join(repo, ".habit")
+	err = os.MkdirAll(filepath.Join(repo, "docs"), 0700)
+	if err == nil {
+		err = os.Mkdir(project, 0700)
+	}
+	if err == nil {
+		err = os.Chdir(filepath.Join(repo, "docs"))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"new", "code-review"}, &buffer)
+	if _, err := os.Stat(filepath.Join(project, ".habitTracker.db")); err != nil {
+		t.Fatalf("want the habit created in the project store, got %v:\n%s", err, buffer.String())
+	}
+	if _, err := os.Stat(dataDir); !os.IsNotExist(err) {
+		t.Errorf("want the data directory unused, got %v", err)
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"config", "show"}, &buffer)
+	if !strings.Contains(buffer.String(), "store_dir = \""+project+"\"") ||
+		!strings.Contains(buffer.String(), "# project\n") {
+		t.Errorf("want the project store shown, got:\n%s", buffer.String())
+	}
+}
+
+func TestRunCLICreatesDataDirOnFreshHome(t *testing.T) {
+	_, dataDir := useTempHome(t)
+	buffer := bytes.Buffer{}
+	status := habit.RunCLI([]string{"piano", "-webhook", "http://127.0.0.1:1/hooks"}, &buffer)
+	if status != 0 || !strings.Contains(buffer.String(), "Good luck with your new habit 'piano'") {
+		t.Fatalf("want the habit created in a fresh home, got %d:\n%s", status, buffer.String())
+	}
+	for _, file := range []string{".habitTracker.db", ".habitWebhooks.json"} {
+		if _, err := os.Stat(filepath.Join(dataDir, file)); err != nil {
+			t.Errorf("want %s in the data directory, got %v", file, err)
+		}
+	}
+}
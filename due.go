@@ -0,0 +1,158 @@
+package habit
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	//OverdueStatus is a habit checked in late, whose streak can still be saved by its grace period or freezes
+	OverdueStatus DueStatus = iota + 1
+	//DueTodayStatus is a habit due today
+	DueTodayStatus
+	//BrokenStatus is a habit missed for longer than its streak can be saved
+	BrokenStatus
+	//DoneStatus is a habit done for the current period
+	DoneStatus
+	//PausedStatus is a paused habit
+	PausedStatus
+)
+
+const (
+	overdueHabit  = "'%s' was due %s, check in today to save your %d-day streak."
+	dueTodayHabit = "'%s' is due today to keep your %d-day streak going."
+	brokenHabit   = "'%s' was due %s, check in to start a new streak."
+	doneHabit     = "'%s' is done until %s."
+	pausedHabit   = "'%s' is paused."
+)
+
+//DueStatus represents whether a habit needs doing, from the most urgent status to the least
+type DueStatus int
+
+//HabitDue is the due status of a habit
+type HabitDue struct {
+	Name     string
+	Status   DueStatus
+	Streak   int
+	DueDate  time.Time
+	Unit     string
+	Target   float64
+	Progress float64
+
+	//dueDay is the day DueDate counts toward, as counted by the controller's Calendar
+	dueDay string
+}
+
+//DueHabits returns the due status of the user's habits, the most urgent first. Quit habits have no due dates and are
+//left out.
+func (c Controller) DueHabits(user string) []HabitDue {
+	now := time.Now()
+	var due []HabitDue
+	for _, h := range c.Store.GetAllHabits(user) {
+		if h.Kind == QuitHabit {
+			continue
+		}
+		due = append(due, h.due(c.Calendar, now))
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].Status != due[j].Status {
+			return due[i].Status < due[j].Status
+		}
+		return due[i].Name < due[j].Name
+	})
+	return due
+}
+
+//due classifies the habit at the given time without changing it
+func (h Habit) due(cal Calendar, now time.Time) HabitDue {
+	h.skipPausedDays(cal, now)
+	d := HabitDue{Name: h.Name, Streak: h.Streak, DueDate: h.DueDate, Unit: h.Unit, Target: h.Target,
+		Progress: h.Progress, dueDay: cal.formatDay(h.DueDate)}
+	switch {
+	case h.currentPause(now) != nil:
+		d.Status = PausedStatus
+	case cal.SameDay(h.DueDate, now):
+		d.Status = DueTodayStatus
+	case h.DueDate.After(now):
+		d.Status = DoneStatus
+	case h.Streak > 0 && h.rescueStreak(cal, now) != 0:
+		d.Status = OverdueStatus
+	default:
+		d.Status = BrokenStatus
+	}
+	return d
+}
+
+//String returns a sentence describing the due status of the habit
+func (d HabitDue) String() string {
+	dueDay := d.day()
+	switch d.Status {
+	case OverdueStatus:
+		return fmt.Sprintf(overdueHabit, d.Name, dueDay, d.Streak)
+	case DueTodayStatus:
+		message := fmt.Sprintf(dueTodayHabit, d.Name, d.Streak)
+		if d.Target > 0 {
+			message += fmt.Sprintf(" %s to go.", formatAmount(d.Target-d.Progress, d.Unit))
+		}
+		return message
+	case BrokenStatus:
+		return fmt.Sprintf(brokenHabit, d.Name, dueDay)
+	case DoneStatus:
+		return fmt.Sprintf(doneHabit, d.Name, dueDay)
+	case PausedStatus:
+		return fmt.Sprintf(pausedHabit, d.Name)
+	}
+	return ""
+}
+
+//day returns the day the habit is due, a local day from midnight for statuses not made by the controller
+func (d HabitDue) day() string {
+	if d.dueDay == "" {
+		return Calendar{}.formatDay(d.DueDate)
+	}
+	return d.dueDay
+}
+
+//String returns the name of the status
+func (s DueStatus) String() string {
+	switch s {
+	case OverdueStatus:
+		return "overdue"
+	case DueTodayStatus:
+		return "due"
+	case BrokenStatus:
+		return "broken"
+	case DoneStatus:
+		return "done"
+	case PausedStatus:
+		return "paused"
+	}
+	return "unknown"
+}
+
+//MarshalText encodes the status by name
+func (s DueStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+//UnmarshalText decodes a status encoded by MarshalText
+func (s *DueStatus) UnmarshalText(text []byte) error {
+	for status := OverdueStatus; status <= PausedStatus; status++ {
+		if status.String() == string(text) {
+			*s = status
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown due status: %s", text)
+}
+
+//needsDoing returns whether any of the habits is due today or overdue
+func needsDoing(due []HabitDue) bool {
+	for _, d := range due {
+		if d.Status == OverdueStatus || d.Status == DueTodayStatus {
+			return true
+		}
+	}
+	return false
+}
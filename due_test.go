@@ -0,0 +1,91 @@
+package habit_test
+
+import (
+	"encoding/json"
+	"github.com/crmejia/habit"
+	"testing"
+	"time"
+)
+
+func TestController_DueHabitsSortsByUrgency(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	yesterday := now.Add(-habit.DailyInterval)
+	twoDaysAgo := now.Add(-2 * habit.DailyInterval)
+	store := &habit.MemoryStore{Habits: map[string]map[string]*habit.Habit{"": {
+		"done":      {Name: "done", Frequency: habit.DailyInterval, Streak: 2, DueDate: now.Add(habit.DailyInterval)},
+		"today":     {Name: "today", Frequency: habit.DailyInterval, Streak: 3, DueDate: now},
+		"water":     {Name: "water", Frequency: habit.DailyInterval, DueDate: now, Target: 8, Progress: 3},
+		"overdue":   {Name: "overdue", Frequency: habit.DailyInterval, Streak: 4, DueDate: yesterday, Freezes: 1},
+		"broken":    {Name: "broken", Frequency: habit.DailyInterval, Streak: 5, DueDate: twoDaysAgo, Freezes: 1},
+		"abandoned": {Name: "abandoned", Frequency: habit.DailyInterval, DueDate: twoDaysAgo, Freezes: 2},
+		"vacation": {Name: "vacation", Frequency: habit.DailyInterval, Streak: 6, DueDate: twoDaysAgo,
+			Pauses: []habit.Pause{{From: twoDaysAgo}}},
+		"back": {Name: "back", Frequency: habit.DailyInterval, Streak: 7, DueDate: twoDaysAgo,
+			Pauses: []habit.Pause{{From: twoDaysAgo, Until: now}}},
+		"smoking": {Name: "smoking", Frequency: habit.DailyInterval, Kind: habit.QuitHabit},
+	}}}
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		name   string
+		status habit.DueStatus
+	}{
+		{"overdue", habit.OverdueStatus},
+		{"back", habit.DueTodayStatus},
+		{"today", habit.DueTodayStatus},
+		{"water", habit.DueTodayStatus},
+		{"abandoned", habit.BrokenStatus},
+		{"broken", habit.BrokenStatus},
+		{"done", habit.DoneStatus},
+		{"vacation", habit.PausedStatus},
+	}
+	got := controller.DueHabits("")
+	if len(got) != len(want) {
+		t.Fatalf("want %d habits, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i].Name != want[i].name || got[i].Status != want[i].status {
+			t.Errorf("want habit %d to be %s %s, got %s %s", i, want[i].status, want[i].name, got[i].Status,
+				got[i].Name)
+		}
+	}
+
+	wantMessages := map[string]string{
+		"overdue": "'overdue' was due " + yesterday.Format("2006-01-02") +
+			", check in today to save your 4-day streak.",
+		"water": "'water' is due today to keep your 0-day streak going. 5 to go.",
+		"done":  "'done' is done until " + now.Add(habit.DailyInterval).Format("2006-01-02") + ".",
+	}
+	for _, d := range got {
+		if want, ok := wantMessages[d.Name]; ok && d.String() != want {
+			t.Errorf("want %q, got %q", want, d.String())
+		}
+	}
+	if stored, _ := store.Get("", "overdue"); stored.Freezes != 1 {
+		t.Error("want DueHabits not to use up freezes")
+	}
+}
+
+func TestDueStatusEncodesByName(t *testing.T) {
+	t.Parallel()
+	data, err := json.Marshal(habit.HabitDue{Name: "piano", Status: habit.OverdueStatus})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := habit.HabitDue{}
+	err = json.Unmarshal(data, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != habit.OverdueStatus {
+		t.Errorf("want status to round trip, got %s from %s", got.Status, data)
+	}
+	err = json.Unmarshal([]byte(`{"Status":"late"}`), &got)
+	if err == nil {
+		t.Error("want error decoding an unknown status")
+	}
+}
@@ -0,0 +1,84 @@
+package habit
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	//HabitCreatedEvent is emitted when a habit is created
+	HabitCreatedEvent EventType = "habit.created"
+	//StreakExtendedEvent is emitted when a check-in extends the streak, including late check-ins saved by a grace
+	//period or freezes
+	StreakExtendedEvent EventType = "streak.extended"
+	//StreakBrokenEvent is emitted when a check-in comes too late to keep the streak, or records a slip on a quit habit
+	StreakBrokenEvent EventType = "streak.broken"
+	//RepeatedCheckInEvent is emitted when a habit is checked in again in the same period
+	RepeatedCheckInEvent EventType = "checkin.repeated"
+	//ProgressLoggedEvent is emitted when an amount is logged without reaching the target
+	ProgressLoggedEvent EventType = "progress.logged"
+)
+
+//EventType identifies what happened to a habit
+type EventType string
+
+//Event tells what happened to a habit. Habit sums up the habit right after the event and CheckIn is the check-in that
+//triggered it, if any. The rest of the habit's history is left out, so events stay small however long it gets.
+type Event struct {
+	ID      string
+	Type    EventType
+	Time    time.Time
+	User    string
+	Habit   HabitSummary
+	CheckIn *CheckIn `json:",omitempty"`
+}
+
+//HabitSummary is the state of a habit carried by an event
+type HabitSummary struct {
+	Name    string
+	User    string
+	Streak  int
+	DueDate time.Time
+}
+
+//EventHandler receives the events emitted by a Controller. HandleEvent is called synchronously after the habit is
+//stored and should not block.
+type EventHandler interface {
+	HandleEvent(e Event)
+}
+
+//emit sends the event for the last change of h, made by checkIn if it is not nil, to the controller's event handlers
+func (c Controller) emit(h *Habit, checkIn *CheckIn) {
+	if len(c.EventHandlers) == 0 {
+		return
+	}
+	id, err := randomHex(16)
+	if err != nil {
+		log.Println("cannot emit event:", err)
+		return
+	}
+	e := Event{ID: id, Type: eventType(h.MessageKind), Time: time.Now(), User: h.User,
+		Habit: HabitSummary{Name: h.Name, User: h.User, Streak: h.Streak, DueDate: h.DueDate}}
+	if checkIn != nil {
+		copied := *checkIn
+		e.CheckIn = &copied
+	}
+	for _, handler := range c.EventHandlers {
+		handler.HandleEvent(e)
+	}
+}
+
+//eventType returns the type of event reported by a message kind
+func eventType(kind MessageKind) EventType {
+	switch kind {
+	case NewMessage:
+		return HabitCreatedEvent
+	case RepeatMessage:
+		return RepeatedCheckInEvent
+	case BrokenMessage, RelapseMessage:
+		return StreakBrokenEvent
+	case ProgressMessage:
+		return ProgressLoggedEvent
+	}
+	return StreakExtendedEvent
+}
@@ -0,0 +1,92 @@
+package habit_test
+
+import (
+	"encoding/json"
+	"github.com/crmejia/habit"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordingHandler struct {
+	events []habit.Event
+}
+
+func (h *recordingHandler) HandleEvent(e habit.Event) {
+	h.events = append(h.events, e)
+}
+
+func TestController_EmitsEvents(t *testing.T) {
+	t.Parallel()
+	store := habit.OpenMemoryStore()
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &recordingHandler{}
+	controller.EventHandlers = []habit.EventHandler{handler}
+
+	_, err = controller.Handle(&habit.Habit{Name: "piano", User: "alice", Frequency: habit.DailyInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.Handle(&habit.Habit{Name: "piano", User: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Habits["alice"]["piano"].DueDate = time.Now()
+	_, err = controller.Handle(&habit.Habit{Name: "piano", User: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Habits["alice"]["piano"].DueDate = time.Now().Add(-2 * habit.DailyInterval)
+	_, err = controller.Handle(&habit.Habit{Name: "piano", User: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.Handle(&habit.Habit{Name: "water", User: "alice", Frequency: habit.DailyInterval, Target: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.Handle(&habit.Habit{Name: "water", User: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []habit.EventType{habit.HabitCreatedEvent, habit.RepeatedCheckInEvent, habit.StreakExtendedEvent,
+		habit.StreakBrokenEvent, habit.HabitCreatedEvent, habit.ProgressLoggedEvent}
+	if len(handler.events) != len(want) {
+		t.Fatalf("want %d events, got %+v", len(want), handler.events)
+	}
+	for i, e := range handler.events {
+		if e.Type != want[i] || e.User != "alice" || e.ID == "" || e.Habit.Name == "" || e.Habit.User != "alice" {
+			t.Errorf("want event %d to be a %s event for alice, got %+v", i, want[i], e)
+		}
+	}
+	if handler.events[2].Habit.Streak != 1 || handler.events[3].Habit.Streak != 0 {
+		t.Error("want events to carry a copy of the habit at the time of the event")
+	}
+	if handler.events[0].CheckIn != nil || handler.events[2].CheckIn == nil ||
+		handler.events[5].CheckIn == nil || handler.events[5].CheckIn.Amount != 1 {
+		t.Errorf("want events to carry the check-in that triggered them, got %+v", handler.events)
+	}
+	payload, err := json.Marshal(handler.events[5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(payload), "CheckIns") || strings.Contains(string(payload), "Message") {
+		t.Errorf("want events to leave out the habit's history, got %s", payload)
+	}
+
+	_, err = controller.Handle(&habit.Habit{Name: "piano", User: "alice", Frequency: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(handler.events) != len(want)+1 {
+		t.Error("want an event for every check-in")
+	}
+	_, err = controller.Handle(&habit.Habit{Name: "surfing", User: "alice", Frequency: time.Hour})
+	if err == nil || len(handler.events) != len(want)+1 {
+		t.Error("want no event when handling fails")
+	}
+}
@@ -0,0 +1,114 @@
+package habit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//maxSuggestions is the number of close habit names suggested for a name that does not exist
+const maxSuggestions = 3
+
+//SuggestHabits returns the names of the user's habits close to name, which were likely meant when name does not
+//exist. The closest names come first.
+func (c Controller) SuggestHabits(user, name string) ([]string, error) {
+	habits, err := c.Store.ListHabits(HabitQuery{User: user})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(habits))
+	for _, h := range habits {
+		names = append(names, h.Name)
+	}
+	return closeNames(name, names), nil
+}
+
+//closeNames returns the names that differ from name by a few edits ignoring case, about one per three letters, or
+//that start with it. The closest names come first.
+func closeNames(name string, names []string) []string {
+	type match struct {
+		name     string
+		distance int
+	}
+	exact, name := name, strings.ToLower(name)
+	maxDistance := len([]rune(name)) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+	var matches []match
+	for _, candidate := range names {
+		if candidate == exact {
+			continue
+		}
+		lower := strings.ToLower(candidate)
+		distance := editDistance(name, lower)
+		if distance > maxDistance && (len(name) < 3 || !strings.HasPrefix(lower, name)) {
+			continue
+		}
+		matches = append(matches, match{candidate, distance})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].name < matches[j].name
+	})
+	if len(matches) > maxSuggestions {
+		matches = matches[:maxSuggestions]
+	}
+	suggestions := make([]string, 0, len(matches))
+	for _, m := range matches {
+		suggestions = append(suggestions, m.name)
+	}
+	return suggestions
+}
+
+//editDistance returns the number of letters inserted, deleted, replaced or swapped with the next one to turn a into b,
+//the optimal string alignment distance
+func editDistance(a, b string) int {
+	from, to := []rune(a), []rune(b)
+	distances := make([][]int, len(from)+1)
+	for i := range distances {
+		distances[i] = make([]int, len(to)+1)
+		distances[i][0] = i
+	}
+	for j := range distances[0] {
+		distances[0][j] = j
+	}
+	for i := 1; i <= len(from); i++ {
+		for j := 1; j <= len(to); j++ {
+			cost := 1
+			if from[i-1] == to[j-1] {
+				cost = 0
+			}
+			distance := minInt(distances[i-1][j]+1, distances[i][j-1]+1, distances[i-1][j-1]+cost)
+			if i > 1 && j > 1 && from[i-1] == to[j-2] && from[i-2] == to[j-1] {
+				distance = minInt(distance, distances[i-2][j-2]+1)
+			}
+			distances[i][j] = distance
+		}
+	}
+	return distances[len(from)][len(to)]
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, v := range values[1:] {
+		if v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+//didYouMean asks whether one of the suggested habit names was meant, e.g. did you mean 'piano' or 'pilates'?
+func didYouMean(suggestions []string) string {
+	quoted := make([]string, 0, len(suggestions))
+	for _, s := range suggestions {
+		quoted = append(quoted, fmt.Sprintf("'%s'", s))
+	}
+	if len(quoted) == 1 {
+		return fmt.Sprintf("did you mean %s?", quoted[0])
+	}
+	return fmt.Sprintf("did you mean %s or %s?", strings.Join(quoted[:len(quoted)-1], ", "), quoted[len(quoted)-1])
+}
@@ -0,0 +1,75 @@
+package habit_test
+
+import (
+	"bytes"
+	"github.com/crmejia/habit"
+	"strings"
+	"testing"
+)
+
+func TestController_SuggestHabits(t *testing.T) {
+	t.Parallel()
+	store := habit.OpenMemoryStore()
+	store.Habits["crismar"] = map[string]*habit.Habit{}
+	for _, name := range []string{"piano", "pilates", "meditation", "Running", "go"} {
+		store.Habits["crismar"][name] = &habit.Habit{Name: name, User: "crismar", Frequency: habit.DailyInterval}
+	}
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name string
+		want []string
+	}{
+		{"pian", []string{"piano"}},
+		{"paino", []string{"piano"}},
+		{"pilate", []string{"pilates"}},
+		{"running", []string{"Running"}},
+		{"med", []string{"meditation"}},
+		{"g", []string{"go"}},
+		{"surfing", []string{}},
+		{"piano", []string{}},
+	}
+	for _, tc := range testCases {
+		got, err := controller.SuggestHabits("crismar", tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s: want suggestions %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestRunCLIShortcutProtectsAgainstTypos(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", tmpDir, "piano"}, &buffer)
+
+	buffer.Reset()
+	status := habit.RunCLI([]string{"-d", tmpDir, "pian"}, &buffer)
+	want := "habit 'pian' not found, did you mean 'piano'? Pass -y to log 'piano' or -strict to create 'pian'"
+	if status != 2 || !strings.Contains(buffer.String(), want) {
+		t.Errorf("want a likely typo refused without a terminal to ask, got %d:\n%s", status, buffer.String())
+	}
+
+	buffer.Reset()
+	status = habit.RunCLI([]string{"-d", tmpDir, "pian", "-y"}, &buffer)
+	if status != 0 || !strings.Contains(buffer.String(), "'piano'") {
+		t.Errorf("want -y to log the closest habit, got %d:\n%s", status, buffer.String())
+	}
+
+	buffer.Reset()
+	status = habit.RunCLI([]string{"-d", tmpDir, "-strict", "pian"}, &buffer)
+	if status != 0 || !strings.Contains(buffer.String(), "new habit 'pian'") {
+		t.Errorf("want -strict to create the habit, got %d:\n%s", status, buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "log", "pianno"}, &buffer)
+	if !strings.Contains(buffer.String(), "habit 'pianno' not found, did you mean 'piano' or 'pian'?") {
+		t.Errorf("want log to suggest close habits, got:\n%s", buffer.String())
+	}
+}
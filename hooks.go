@@ -0,0 +1,163 @@
+package habit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	//IdempotencyKeyHeader identifies a hook check-in, a check-in retried with the same key is only recorded once
+	IdempotencyKeyHeader = "Idempotency-Key"
+	//ReplayedHeader is set on the response to a hook check-in whose key was already recorded
+	ReplayedHeader = "Idempotent-Replayed"
+
+	hookDateForm = "2006-01-02"
+)
+
+//HookCheckIn is the payload of POST /hooks/checkin, sent as JSON or as a form
+type HookCheckIn struct {
+	Habit string
+	//Amount is logged toward the target of quantitative habits. Forms may include the unit, as in amount=2+glasses.
+	Amount float64
+	//Date backfills the check-in, as YYYY-MM-DD or RFC 3339. It defaults to now.
+	Date string
+	Note string
+	//Rating goes from 1 to 5
+	Rating int
+	//Key defaults to the Idempotency-Key header
+	Key string
+}
+
+//HandleHookCheckIn handler that serves /hooks/checkin. POST checks in the habit of the JSON or form encoded
+//HookCheckIn in the request body and returns the habit. Retried requests with an already recorded key return the habit
+//without checking it in again.
+func (server *server) HandleHookCheckIn() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		user := server.requestUser(r)
+		payload, unit, err := decodeHookCheckIn(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if payload.Habit == "" {
+			http.Error(w, "missing habit name", http.StatusBadRequest)
+			return
+		}
+		if payload.Key == "" {
+			payload.Key = r.Header.Get(IdempotencyKeyHeader)
+		}
+		checkIn := CheckIn{Amount: payload.Amount, Key: payload.Key, Note: payload.Note, Rating: payload.Rating}
+		if payload.Date != "" {
+			checkIn.Time, err = server.controller.Calendar.parseHookDate(payload.Date, time.Now())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		//hook check-ins are serialized so that concurrent retries cannot both record the same key
+		server.hooks.Lock()
+		defer server.hooks.Unlock()
+		existing, err := server.controller.Store.Get(user, payload.Habit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if existing == nil {
+			http.Error(w, "habit not found", http.StatusNotFound)
+			return
+		}
+		if unit != "" && unit != existing.Unit {
+			http.Error(w, fmt.Sprintf("habit '%s' is measured in %s, not %s", existing.Name, unitName(existing.Unit),
+				unit), http.StatusBadRequest)
+			return
+		}
+		h, err := server.controller.CheckIn(user, payload.Habit, checkIn)
+		if errors.Is(err, ErrDuplicateCheckIn) {
+			w.Header().Set(ReplayedHeader, "true")
+			writeJSON(w, http.StatusOK, existing)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, h)
+	}
+}
+
+//decodeHookCheckIn decodes the JSON or form encoded payload of a hook, returning the unit of a form amount as well
+func decodeHookCheckIn(r *http.Request) (HookCheckIn, string, error) {
+	payload := HookCheckIn{}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		if err != nil {
+			return payload, "", errors.New("cannot parse check-in")
+		}
+		return payload, "", nil
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		return payload, "", errors.New("cannot parse check-in")
+	}
+	payload.Habit = r.PostForm.Get("habit")
+	payload.Date = r.PostForm.Get("date")
+	payload.Key = r.PostForm.Get("key")
+	payload.Note = r.PostForm.Get("note")
+	if rating := r.PostForm.Get("rating"); rating != "" {
+		payload.Rating, err = strconv.Atoi(rating)
+		if err != nil {
+			return payload, "", fmt.Errorf("invalid rating: %s", rating)
+		}
+	}
+	var unit string
+	if amount := r.PostForm.Get("amount"); amount != "" {
+		payload.Amount, unit, err = splitQuantity(amount)
+		if err != nil {
+			return payload, "", fmt.Errorf("invalid amount: %s", amount)
+		}
+	}
+	return payload, unit, nil
+}
+
+//parseHookDate parses the date of a hook check-in. A day checks in at noon, or half a day after it starts if it
+//starts later than midnight, or now for today.
+func (cal Calendar) parseHookDate(value string, now time.Time) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation(hookDateForm, value, cal.location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date: %s, use YYYY-MM-DD or RFC 3339", value)
+	}
+	t = time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, day.Location()).Add(cal.DayStart)
+	if cal.SameDay(t, now) {
+		return now, nil
+	}
+	return t, nil
+}
+
+//tokenFromQuery lets clients that cannot set headers pass their token as ?token=, it is moved to the Authorization
+//header unless one is set
+func tokenFromQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
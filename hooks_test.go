@@ -0,0 +1,189 @@
+package habit_test
+
+import (
+	"encoding/json"
+	"github.com/crmejia/habit"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newHookServer(t *testing.T) (http.Handler, *habit.MemoryStore, string) {
+	t.Helper()
+	store := habit.OpenMemoryStore()
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.Handle(&habit.Habit{Name: "piano", User: "alice", Frequency: habit.DailyInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.Handle(&habit.Habit{Name: "water", User: "alice", Frequency: habit.DailyInterval, Target: 8,
+		Unit: "glasses"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := habit.NewServer(&controller, localHostAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.EnableAuth(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, secret, err := habit.NewToken("alice", "shortcuts", habit.HookScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.CreateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server.Routes(), store, secret
+}
+
+func TestServer_HookChecksInJSONAndForms(t *testing.T) {
+	t.Parallel()
+	handler, store, secret := newHookServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/hooks/checkin", strings.NewReader(`{"habit":"water","amount":3}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+secret)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	h := habit.Habit{}
+	err := json.Unmarshal(recorder.Body.Bytes(), &h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//creating a quantitative habit logs its first glass
+	if h.Progress != 4 {
+		t.Errorf("want 3 glasses to be logged, got %v", h.Progress)
+	}
+
+	form := url.Values{"habit": {"water"}, "amount": {"2 glasses"}, "note": {"after running"}, "rating": {"5"}}
+	req = httptest.NewRequest(http.MethodPost, "/hooks/checkin?token="+secret, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	water, err := store.Get("alice", "water")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if water.Progress != 6 {
+		t.Errorf("want form amount to be logged, got %v", water.Progress)
+	}
+	if last := water.CheckIns[len(water.CheckIns)-1]; last.Note != "after running" || last.Rating != 5 {
+		t.Errorf("want form note and rating to be recorded, got %+v", last)
+	}
+
+	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	form = url.Values{"habit": {"piano"}, "date": {yesterday}}
+	req = httptest.NewRequest(http.MethodPost, "/hooks/checkin?token="+secret, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("want check-in before the habit was created to fail, got %d", recorder.Code)
+	}
+}
+
+func TestServer_HookIgnoresRetriedCheckIns(t *testing.T) {
+	t.Parallel()
+	handler, store, secret := newHookServer(t)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/hooks/checkin", strings.NewReader(`{"habit":"water"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+secret)
+		req.Header.Set(habit.IdempotencyKeyHeader, "delivery-1")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("want status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+		}
+		replayed := recorder.Header().Get(habit.ReplayedHeader) == "true"
+		if replayed != (i == 1) {
+			t.Errorf("want only the retry to be replayed, got replayed %t on request %d", replayed, i+1)
+		}
+	}
+	water, err := store.Get("alice", "water")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if water.Progress != 2 || len(water.CheckIns) != 2 {
+		t.Errorf("want retried check-in to be counted once, got progress %v with %d check-ins", water.Progress,
+			len(water.CheckIns))
+	}
+}
+
+func TestServer_HookErrors(t *testing.T) {
+	t.Parallel()
+	handler, store, secret := newHookServer(t)
+	checkInToken, checkInSecret, err := habit.NewToken("alice", "cli", habit.CheckInScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.CreateToken(checkInToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tomorrow := time.Now().AddDate(0, 0, 1).Format("2006-01-02")
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       string
+		wantStatus int
+	}{
+		{"no token", http.MethodPost, "/hooks/checkin", "", `{"habit":"piano"}`, http.StatusUnauthorized},
+		{"wrong token", http.MethodPost, "/hooks/checkin", "nope", `{"habit":"piano"}`, http.StatusUnauthorized},
+		{"get", http.MethodGet, "/hooks/checkin", secret, "", http.StatusMethodNotAllowed},
+		{"missing habit name", http.MethodPost, "/hooks/checkin", secret, `{}`, http.StatusBadRequest},
+		{"unknown habit", http.MethodPost, "/hooks/checkin", secret, `{"habit":"surfing"}`, http.StatusNotFound},
+		{"bad payload", http.MethodPost, "/hooks/checkin", secret, `{"habit":`, http.StatusBadRequest},
+		{"bad rating", http.MethodPost, "/hooks/checkin", secret, `{"habit":"piano","rating":9}`,
+			http.StatusBadRequest},
+		{"bad date", http.MethodPost, "/hooks/checkin", secret, `{"habit":"piano","date":"monday"}`,
+			http.StatusBadRequest},
+		{"future date", http.MethodPost, "/hooks/checkin", secret, `{"habit":"piano","date":"` + tomorrow + `"}`,
+			http.StatusBadRequest},
+		{"hook token on the API", http.MethodGet, "/api/habits", secret, "", http.StatusForbidden},
+		{"hook token on check in", http.MethodGet, "/?habit=piano", secret, "", http.StatusForbidden},
+		{"checkin token on hook", http.MethodPost, "/hooks/checkin", checkInSecret, `{"habit":"piano"}`,
+			http.StatusOK},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if recorder.Code != tc.wantStatus {
+			t.Errorf("%s: want status %d, got %d: %s", tc.name, tc.wantStatus, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	form := url.Values{"habit": {"water"}, "amount": {"2 km"}}
+	req := httptest.NewRequest(http.MethodPost, "/hooks/checkin?token="+secret, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "glasses") {
+		t.Errorf("want mismatched unit to fail, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,369 @@
+package habit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Output formats accepted by the -o flag
+const (
+	textOutput = "text"
+	jsonOutput = "json"
+	yamlOutput = "yaml"
+	tsvOutput  = "tsv"
+)
+
+//printer writes the results of CLI commands as text, or as structured data in the format chosen with -o
+type printer struct {
+	format string
+	output io.Writer
+}
+
+func newPrinter(format string, output io.Writer) (printer, error) {
+	switch format {
+	case textOutput, jsonOutput, yamlOutput, tsvOutput:
+		return printer{format: format, output: output}, nil
+	}
+	return printer{}, fmt.Errorf("unknown output format: %s, expected text, json, yaml or tsv", format)
+}
+
+//structured returns whether results are printed as data rather than text
+func (p printer) structured() bool {
+	return p.format != textOutput
+}
+
+//print writes text followed by a new line, or data in the structured formats. Data is a struct or a slice of
+//structs, printed as a row per struct in the tsv format.
+func (p printer) print(data interface{}, text string) error {
+	switch p.format {
+	case jsonOutput:
+		encoded, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(p.output, "%s\n", encoded)
+		return err
+	case yamlOutput:
+		return writeYAML(p.output, data)
+	case tsvOutput:
+		return writeTSV(p.output, data)
+	}
+	_, err := fmt.Fprintln(p.output, text)
+	return err
+}
+
+//habitOutput is a habit as printed in the structured formats. Streak and Status are current, and MessageKind and
+//Message tell the result of the last time the habit was logged.
+type habitOutput struct {
+	Name        string
+	User        string
+	Kind        string
+	Frequency   string
+	Streak      int
+	Status      string
+	DueDate     time.Time
+	Unit        string
+	Target      float64
+	Progress    float64
+	Tags        []string
+	MessageKind string
+	Message     string
+	LastCheckIn time.Time
+	CreatedAt   time.Time
+}
+
+//habitDetailsOutput is the output of habit show, adding the habit's history
+type habitDetailsOutput struct {
+	habitOutput
+	Description string
+	CheckIns    []CheckIn
+	Pauses      []Pause
+}
+
+func newHabitOutput(h *Habit, cal Calendar, now time.Time) habitOutput {
+	out := habitOutput{
+		Name:        h.Name,
+		User:        h.User,
+		Kind:        h.Kind.String(),
+		Frequency:   frequencyName(h.Frequency),
+		Streak:      h.currentStreak(cal, now),
+		DueDate:     h.DueDate,
+		Unit:        h.Unit,
+		Target:      h.Target,
+		Progress:    h.Progress,
+		Tags:        h.Tags,
+		MessageKind: h.MessageKind.String(),
+		Message:     h.Message,
+		LastCheckIn: h.LastCheckIn,
+		CreatedAt:   h.CreatedAt,
+	}
+	if h.Kind != QuitHabit {
+		out.Status = h.due(cal, now).Status.String()
+	}
+	if out.Tags == nil {
+		out.Tags = []string{}
+	}
+	return out
+}
+
+func newHabitDetailsOutput(h *Habit, cal Calendar, now time.Time) habitDetailsOutput {
+	out := habitDetailsOutput{habitOutput: newHabitOutput(h, cal, now), Description: h.Description, CheckIns: h.CheckIns,
+		Pauses: h.Pauses}
+	if out.CheckIns == nil {
+		out.CheckIns = []CheckIn{}
+	}
+	if out.Pauses == nil {
+		out.Pauses = []Pause{}
+	}
+	return out
+}
+
+func newHabitsOutput(habits []*Habit, cal Calendar) []habitOutput {
+	now := time.Now()
+	out := make([]habitOutput, 0, len(habits))
+	for _, h := range habits {
+		out = append(out, newHabitOutput(h, cal, now))
+	}
+	return out
+}
+
+//tokenOutput is an API token as printed in the structured formats. Secret is only set when the token is created.
+type tokenOutput struct {
+	ID      string
+	User    string
+	Name    string
+	Scope   string
+	Created time.Time
+	Secret  string
+}
+
+func newTokenOutput(t *Token) tokenOutput {
+	return tokenOutput{ID: t.ID, User: t.User, Name: t.Name, Scope: t.Scope.String(), Created: t.Created}
+}
+
+//configSettingOutput is a setting of the config as printed in the structured formats
+type configSettingOutput struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+func newConfigOutput(c *Config) []configSettingOutput {
+	settings := make([]configSettingOutput, 0, len(configSettings))
+	for _, setting := range configSettings {
+		settings = append(settings, configSettingOutput{Key: setting.key, Value: c.shown(setting.key),
+			Source: c.Sources[setting.key]})
+	}
+	return settings
+}
+
+//writeTSV writes a struct, or a slice of structs, as tab separated values with a header of field names. Embedded
+//structs are flattened, times are written as RFC 3339, slices of strings are joined by commas and other values that
+//are not plain are written as JSON.
+func writeTSV(w io.Writer, data interface{}) error {
+	v := reflect.ValueOf(data)
+	var rows []reflect.Value
+	if v.Kind() == reflect.Slice {
+		for i := 0; i < v.Len(); i++ {
+			rows = append(rows, v.Index(i))
+		}
+	} else {
+		rows = append(rows, v)
+	}
+	t := v.Type()
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot write %s as tsv", t)
+	}
+
+	var header []string
+	for _, field := range tsvFields(t) {
+		header = append(header, field.Name)
+	}
+	_, err := fmt.Fprintln(w, strings.Join(header, "\t"))
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var cells []string
+		for _, field := range tsvFields(t) {
+			cell, err := tsvCell(row.FieldByIndex(field.Index))
+			if err != nil {
+				return err
+			}
+			cells = append(cells, cell)
+		}
+		_, err = fmt.Fprintln(w, strings.Join(cells, "\t"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//tsvFields returns the exported fields of t, with the fields of embedded structs in place of the structs
+func tsvFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for _, embedded := range tsvFields(field.Type) {
+				embedded.Index = append([]int{i}, embedded.Index...)
+				fields = append(fields, embedded)
+			}
+			continue
+		}
+		if field.PkgPath == "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+func tsvCell(v reflect.Value) (string, error) {
+	switch value := v.Interface().(type) {
+	case time.Time:
+		if value.IsZero() {
+			return "", nil
+		}
+		return value.Format(time.RFC3339), nil
+	case fmt.Stringer:
+		return tsvEscaper.Replace(value.String()), nil
+	case []string:
+		return tsvEscaper.Replace(strings.Join(value, ",")), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return tsvEscaper.Replace(v.String()), nil
+	case reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return fmt.Sprint(v.Interface()), nil
+	}
+	encoded, err := json.Marshal(v.Interface())
+	if err != nil {
+		return "", err
+	}
+	return tsvEscaper.Replace(string(encoded)), nil
+}
+
+//writeYAML writes data as YAML. Data is first encoded as JSON, so it reads like the JSON output and keeps its field
+//order.
+func writeYAML(w io.Writer, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	node, err := decodeYAMLNode(decoder)
+	if err != nil {
+		return err
+	}
+	buffer := bytes.Buffer{}
+	node.write(&buffer, "")
+	_, err = w.Write(buffer.Bytes())
+	return err
+}
+
+//yamlNode is a decoded JSON value that keeps the order of object keys
+type yamlNode struct {
+	//scalar is the YAML representation of a value that is neither an object nor an array
+	scalar string
+	isMap  bool
+	isList bool
+	keys   []string
+	values []*yamlNode
+}
+
+func decodeYAMLNode(decoder *json.Decoder) (*yamlNode, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch value := token.(type) {
+	case json.Delim:
+		node := &yamlNode{isMap: value == '{', isList: value == '['}
+		for decoder.More() {
+			if node.isMap {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.keys = append(node.keys, key.(string))
+			}
+			child, err := decodeYAMLNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			node.values = append(node.values, child)
+		}
+		_, err = decoder.Token()
+		return node, err
+	case string:
+		quoted, err := json.Marshal(value)
+		return &yamlNode{scalar: string(quoted)}, err
+	case nil:
+		return &yamlNode{scalar: "null"}, nil
+	}
+	return &yamlNode{scalar: fmt.Sprint(token)}, nil
+}
+
+//empty returns whether the node is an empty object or array, which are written inline
+func (n *yamlNode) empty() bool {
+	return (n.isMap || n.isList) && len(n.values) == 0
+}
+
+func (n *yamlNode) inline() string {
+	switch {
+	case n.isMap:
+		return "{}"
+	case n.isList:
+		return "[]"
+	}
+	return n.scalar
+}
+
+var plainYAMLKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+//write writes the node with every line indented by indent
+func (n *yamlNode) write(b *bytes.Buffer, indent string) {
+	if !n.isMap && !n.isList || n.empty() {
+		b.WriteString(indent + n.inline() + "\n")
+		return
+	}
+	for i, child := range n.values {
+		prefix := indent + "- "
+		if n.isMap {
+			key := n.keys[i]
+			if !plainYAMLKey.MatchString(key) {
+				key = strconv.Quote(key)
+			}
+			prefix = indent + key + ":"
+		}
+		switch {
+		case !child.isMap && !child.isList || child.empty():
+			if n.isMap {
+				prefix += " "
+			}
+			b.WriteString(prefix + child.inline() + "\n")
+		case n.isList && child.isMap:
+			//the first key of an object in a list follows the dash
+			nested := bytes.Buffer{}
+			child.write(&nested, indent+"  ")
+			b.WriteString(prefix + strings.TrimPrefix(nested.String(), indent+"  "))
+		default:
+			b.WriteString(strings.TrimSuffix(prefix, " ") + "\n")
+			child.write(b, indent+"  ")
+		}
+	}
+}
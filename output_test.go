@@ -0,0 +1,146 @@
+package habit_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/crmejia/habit"
+	"strings"
+	"testing"
+)
+
+func TestRunCLIPrintsJSON(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	status := habit.RunCLI([]string{"-d", tmpDir, "-o", "json", "-target", "8", "-unit", "glasses", "water"}, &buffer)
+	if status != 0 {
+		t.Fatalf("want habit to be created, got %d:\n%s", status, buffer.String())
+	}
+	var created struct {
+		Name, Frequency, Status, Unit, MessageKind, Message string
+		Target, Progress                                    float64
+		Tags                                                []string
+	}
+	err := json.Unmarshal(buffer.Bytes(), &created)
+	if err != nil {
+		t.Fatalf("want JSON output, got %v:\n%s", err, buffer.String())
+	}
+	if created.Name != "water" || created.Frequency != "daily" || created.MessageKind != "new habit" ||
+		created.Target != 8 || created.Progress != 1 || created.Unit != "glasses" || created.Tags == nil {
+		t.Errorf("want the created habit's fields, got %+v", created)
+	}
+	if !strings.Contains(created.Message, "water") || created.Status != "due" {
+		t.Errorf("want the habit's message and status, got %+v", created)
+	}
+
+	habit.RunCLI([]string{"-d", tmpDir, "piano"}, &buffer)
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "-o", "json", "-sort", "name", "all"}, &buffer)
+	var listed []struct{ Name string }
+	err = json.Unmarshal(buffer.Bytes(), &listed)
+	if err != nil || len(listed) != 2 || listed[0].Name != "piano" || listed[1].Name != "water" {
+		t.Errorf("want piano and water to be listed, got %v:\n%s", err, buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "-o", "json", "-tag", "music", "all"}, &buffer)
+	if strings.TrimSpace(buffer.String()) != "[]" {
+		t.Errorf("want an empty list when no habits match, got:\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "-o", "json", "show", "water"}, &buffer)
+	var shown struct {
+		Name     string
+		CheckIns []habit.CheckIn
+	}
+	err = json.Unmarshal(buffer.Bytes(), &shown)
+	if err != nil || shown.Name != "water" || len(shown.CheckIns) != 1 || shown.CheckIns[0].Amount != 1 {
+		t.Errorf("want show to include the check-ins, got %v:\n%s", err, buffer.String())
+	}
+
+	buffer.Reset()
+	status = habit.RunCLI([]string{"-d", tmpDir, "-o", "json", "due", "-exit-code"}, &buffer)
+	var due []struct{ Name, Status string }
+	err = json.Unmarshal(buffer.Bytes(), &due)
+	if status != 1 || err != nil || len(due) != 2 || due[0].Status != "due" {
+		t.Errorf("want due habits and exit status 1, got %d, %v:\n%s", status, err, buffer.String())
+	}
+}
+
+func TestRunCLIPrintsYAML(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", tmpDir, "piano"}, &buffer)
+	habit.RunCLI([]string{"-d", tmpDir, "tag", "add", "piano", "music", "practice"}, &buffer)
+	habit.RunCLI([]string{"-d", tmpDir, "surfing"}, &buffer)
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "-o", "yaml", "all"}, &buffer)
+	got := buffer.String()
+	for _, want := range []string{
+		"- Name: \"piano\"\n  User: ",
+		"  Tags:\n    - \"music\"\n    - \"practice\"\n",
+		"- Name: \"surfing\"\n",
+		"  Tags: []\n",
+		"  MessageKind: \"new habit\"\n",
+		"  Streak: 0\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want YAML output to contain %q, got:\n%s", want, got)
+		}
+	}
+
+	habit.RunCLI([]string{"-d", tmpDir, "piano", "-note", "scales", "-rating", "4"}, &buffer)
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "-o", "yaml", "show", "piano"}, &buffer)
+	if got := buffer.String(); !strings.HasPrefix(got, "Name: \"piano\"\n") ||
+		!strings.Contains(got, "CheckIns:\n  - Time: ") || !strings.Contains(got, "    Note: \"scales\"\n    Rating: 4\n") ||
+		!strings.Contains(got, "Pauses: []\n") {
+		t.Errorf("want show as a YAML mapping, got:\n%s", got)
+	}
+}
+
+func TestRunCLIPrintsTSV(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", tmpDir, "piano"}, &buffer)
+	habit.RunCLI([]string{"-d", tmpDir, "tag", "add", "piano", "music", "practice"}, &buffer)
+	habit.RunCLI([]string{"-d", tmpDir, "-f", "weekly", "surfing"}, &buffer)
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", tmpDir, "-o", "tsv", "all"}, &buffer)
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("want a header and a row per habit, got:\n%s", buffer.String())
+	}
+	header := strings.Split(lines[0], "\t")
+	column := func(row, name string) string {
+		cells := strings.Split(row, "\t")
+		for i, h := range header {
+			if h == name && i < len(cells) {
+				return cells[i]
+			}
+		}
+		t.Fatalf("no column %s in:\n%s", name, buffer.String())
+		return ""
+	}
+	if column(lines[1], "Name") != "piano" || column(lines[1], "Tags") != "music,practice" ||
+		column(lines[2], "Frequency") != "weekly" || column(lines[2], "MessageKind") != "new habit" {
+		t.Errorf("want a row per habit, got:\n%s", buffer.String())
+	}
+	if column(lines[2], "LastCheckIn") == "" || strings.Contains(column(lines[2], "Message"), "\n") {
+		t.Errorf("want times and messages in a single cell, got:\n%s", buffer.String())
+	}
+}
+
+func TestRunCLIRejectsUnknownOutputFormat(t *testing.T) {
+	t.Parallel()
+	buffer := bytes.Buffer{}
+	status := habit.RunCLI([]string{"-d", t.TempDir(), "-o", "xml", "piano"}, &buffer)
+	if status != 2 || !strings.Contains(buffer.String(), "unknown output format: xml") {
+		t.Errorf("want unknown output format error, got %d:\n%s", status, buffer.String())
+	}
+}
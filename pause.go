@@ -0,0 +1,223 @@
+package habit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	pausedStatus  = "'%s' is paused%s, your %d-day streak is safe."
+	pauseDateForm = "2006-01-02"
+)
+
+//Pause pauses the user's habit from the given time, or from now if from is zero, until the given time or until it is
+//resumed if until is zero. Periods missed while paused do not break the streak.
+func (c Controller) Pause(user, name string, from, until time.Time) (*Habit, error) {
+	h, err := c.getHabit(user, name)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if from.IsZero() {
+		from = now
+	}
+	err = h.pause(from, until)
+	if err != nil {
+		return nil, err
+	}
+	h.UpdatedAt = now
+	err = c.Store.Update(h)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+//PauseAll pauses every habit of the user that is not already paused, as Pause does. Quit habits are left out, they
+//have no due dates to skip. It returns the paused habits.
+func (c Controller) PauseAll(user string, from, until time.Time) ([]*Habit, error) {
+	var paused []*Habit
+	for _, h := range habitsSortedByName(c.Store.GetAllHabits(user)) {
+		if h.Kind == QuitHabit || h.pendingPause(time.Now()) != nil {
+			continue
+		}
+		h, err := c.Pause(user, h.Name, from, until)
+		if err != nil {
+			return paused, err
+		}
+		paused = append(paused, h)
+	}
+	return paused, nil
+}
+
+//Resume ends the current pause of the user's habit, or cancels its upcoming one
+func (c Controller) Resume(user, name string) (*Habit, error) {
+	h, err := c.getHabit(user, name)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	err = h.resume(now)
+	if err != nil {
+		return nil, err
+	}
+	h.UpdatedAt = now
+	err = c.Store.Update(h)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+//ResumeAll resumes every paused habit of the user and returns them
+func (c Controller) ResumeAll(user string) ([]*Habit, error) {
+	var resumed []*Habit
+	for _, h := range habitsSortedByName(c.Store.GetAllHabits(user)) {
+		if h.pendingPause(time.Now()) == nil {
+			continue
+		}
+		h, err := c.Resume(user, h.Name)
+		if err != nil {
+			return resumed, err
+		}
+		resumed = append(resumed, h)
+	}
+	return resumed, nil
+}
+
+func habitsSortedByName(habits []*Habit) []*Habit {
+	sort.Slice(habits, func(i, j int) bool {
+		return habits[i].Name < habits[j].Name
+	})
+	return habits
+}
+
+func (c Controller) getHabit(user, name string) (*Habit, error) {
+	if name == "" {
+		return nil, errors.New("habit name cannot be empty")
+	}
+	h, err := c.Store.Get(user, name)
+	if err != nil {
+		return nil, err
+	}
+	if h == nil {
+		suggestions, err := c.SuggestHabits(user, name)
+		if err == nil && len(suggestions) > 0 {
+			return nil, fmt.Errorf("habit '%s' not found, %s", name, didYouMean(suggestions))
+		}
+		return nil, fmt.Errorf("habit '%s' not found", name)
+	}
+	return h, nil
+}
+
+func (h *Habit) pause(from, until time.Time) error {
+	if h.Kind == QuitHabit {
+		return errors.New("quit habits cannot be paused")
+	}
+	if !until.IsZero() && !until.After(from) {
+		return errors.New("pause must end after it starts")
+	}
+	if h.pendingPause(from) != nil {
+		return fmt.Errorf("habit '%s' is already paused", h.Name)
+	}
+	h.Pauses = append(h.Pauses, Pause{From: from, Until: until})
+	return nil
+}
+
+func (h *Habit) resume(now time.Time) error {
+	p := h.pendingPause(now)
+	if p == nil {
+		return fmt.Errorf("habit '%s' is not paused", h.Name)
+	}
+	if p.From.After(now) {
+		//the pause has not started yet, drop it
+		i := len(h.Pauses) - 1
+		for &h.Pauses[i] != p {
+			i--
+		}
+		h.Pauses = append(h.Pauses[:i], h.Pauses[i+1:]...)
+		return nil
+	}
+	p.Until = now
+	return nil
+}
+
+//pendingPause returns the pause of the habit that is ongoing or starts after the given time, if any
+func (h *Habit) pendingPause(t time.Time) *Pause {
+	for i := range h.Pauses {
+		p := &h.Pauses[i]
+		if p.Until.IsZero() || p.Until.After(t) {
+			return p
+		}
+	}
+	return nil
+}
+
+//currentPause returns the pause of the habit ongoing at the given time, if any
+func (h *Habit) currentPause(now time.Time) *Pause {
+	p := h.pendingPause(now)
+	if p == nil || p.From.After(now) {
+		return nil
+	}
+	return p
+}
+
+//pausedOn returns whether the habit is paused during the calendar day of t. The day a pause ends on is not paused.
+func (h *Habit) pausedOn(cal Calendar, t time.Time) bool {
+	day := cal.startOfDay(t)
+	for _, p := range h.Pauses {
+		if cal.startOfDay(p.From).After(day) {
+			continue
+		}
+		if p.Until.IsZero() || day.Before(cal.startOfDay(p.Until)) {
+			return true
+		}
+	}
+	return false
+}
+
+//skipPausedDays moves an overdue due date past the days the habit was paused, so they are not counted as missed. A
+//quantitative habit starts a new period at the new due date.
+func (h *Habit) skipPausedDays(cal Calendar, now time.Time) {
+	due := cal.local(h.DueDate)
+	moved := false
+	for due.Before(now) && !cal.SameDay(due, now) && h.pausedOn(cal, due) {
+		due = due.AddDate(0, 0, 1)
+		moved = true
+	}
+	if !moved {
+		return
+	}
+	h.DueDate = due
+	if h.Target > 0 {
+		h.Progress = 0
+	}
+}
+
+//pauseEnd describes when the pause ends
+func (cal Calendar) pauseEnd(p *Pause) string {
+	if p.Until.IsZero() {
+		return ""
+	}
+	return " until " + cal.local(p.Until).Format(pauseDateForm)
+}
+
+//parseDate parses a YYYY-MM-DD date as the time that day starts at. An empty date is zero.
+func (cal Calendar) parseDate(date string) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(pauseDateForm, date, cal.location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %s, expected YYYY-MM-DD", date)
+	}
+	return t.Add(cal.DayStart), nil
+}
+
+//startOfDay returns the time the day t counts toward starts at
+func (cal Calendar) startOfDay(t time.Time) time.Time {
+	t = cal.day(t)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Add(cal.DayStart)
+}
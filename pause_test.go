@@ -0,0 +1,227 @@
+package habit_test
+
+import (
+	"github.com/crmejia/habit"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestController_HandleSkipsPausedDays(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	daysAgo := func(days int) time.Time {
+		return now.Add(time.Duration(-days) * habit.DailyInterval)
+	}
+	testCases := []struct {
+		name         string
+		habit        habit.Habit
+		amount       float64
+		wantStreak   int
+		wantProgress float64
+		wantKind     habit.MessageKind
+	}{
+		{
+			name: "ongoing pause keeps the streak",
+			habit: habit.Habit{Streak: 5, DueDate: daysAgo(3),
+				Pauses: []habit.Pause{{From: daysAgo(4)}}},
+			wantStreak: 6, wantKind: habit.StreakMessage,
+		},
+		{
+			name: "pause ending today keeps the streak",
+			habit: habit.Habit{Streak: 5, DueDate: daysAgo(3),
+				Pauses: []habit.Pause{{From: daysAgo(3), Until: now}}},
+			wantStreak: 6, wantKind: habit.StreakMessage,
+		},
+		{
+			name: "days missed after a pause break the streak",
+			habit: habit.Habit{Streak: 5, DueDate: daysAgo(4),
+				Pauses: []habit.Pause{{From: daysAgo(5), Until: daysAgo(2)}}},
+			wantStreak: 0, wantKind: habit.BrokenMessage,
+		},
+		{
+			name: "days missed before a pause break the streak",
+			habit: habit.Habit{Streak: 5, DueDate: daysAgo(3),
+				Pauses: []habit.Pause{{From: daysAgo(1)}}},
+			wantStreak: 0, wantKind: habit.BrokenMessage,
+		},
+		{
+			name: "quantitative habits start a new period after a pause",
+			habit: habit.Habit{Streak: 5, DueDate: daysAgo(3), Target: 2, Unit: "km", Progress: 1.5,
+				Pauses: []habit.Pause{{From: daysAgo(3)}}},
+			amount:     1,
+			wantStreak: 5, wantProgress: 1, wantKind: habit.ProgressMessage,
+		},
+	}
+
+	for _, tc := range testCases {
+		h := tc.habit
+		h.Name = "piano"
+		h.Frequency = habit.DailyInterval
+		store := &habit.MemoryStore{Habits: map[string]map[string]*habit.Habit{"": {"piano": &h}}}
+		controller, err := habit.NewController(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := controller.HandleAmount(&habit.Habit{Name: "piano"}, tc.amount)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got.Streak != tc.wantStreak || got.Progress != tc.wantProgress || got.MessageKind != tc.wantKind {
+			t.Errorf("%s: want streak %d, progress %g and %s message, got streak %d, progress %g and %s message",
+				tc.name, tc.wantStreak, tc.wantProgress, tc.wantKind, got.Streak, got.Progress, got.MessageKind)
+		}
+	}
+}
+
+func TestController_PauseAndResume(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(habit.OpenMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.Handle(&habit.Habit{Name: "piano", Frequency: habit.DailyInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	until := time.Now().Add(3 * habit.DailyInterval)
+	h, err := controller.Pause("", "piano", time.Time{}, until)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Pauses) != 1 || !h.Pauses[0].Until.Equal(until) {
+		t.Errorf("want a pause until %s, got %+v", until, h.Pauses)
+	}
+	wantStatus := "'piano' is paused until " + until.Format("2006-01-02") + ", your 0-day streak is safe."
+	if got := controller.GetAllHabits(""); !strings.Contains(got, wantStatus) {
+		t.Errorf("want listing to contain %q, got %q", wantStatus, got)
+	}
+	details, err := controller.ShowHabit("", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(details, "Paused: since ") {
+		t.Errorf("want details to show the pause, got %q", details)
+	}
+	_, err = controller.Pause("", "piano", time.Time{}, time.Time{})
+	if err == nil {
+		t.Error("want error pausing a paused habit")
+	}
+
+	h, err = controller.Resume("", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Pauses) != 1 || h.Pauses[0].Until.After(time.Now()) {
+		t.Errorf("want the pause to end on resume, got %+v", h.Pauses)
+	}
+	if got := controller.GetAllHabits(""); strings.Contains(got, "paused") {
+		t.Errorf("want resumed habit not to be listed as paused, got %q", got)
+	}
+	_, err = controller.Resume("", "piano")
+	if err == nil {
+		t.Error("want error resuming a habit that is not paused")
+	}
+}
+
+func TestController_ResumeCancelsUpcomingPause(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(habit.OpenMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.Handle(&habit.Habit{Name: "piano", Frequency: habit.DailyInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Now().Add(2 * habit.DailyInterval)
+	_, err = controller.Pause("", "piano", from, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := controller.GetAllHabits(""); strings.Contains(got, "paused") {
+		t.Errorf("want habit not to be paused before the pause starts, got %q", got)
+	}
+	h, err := controller.Resume("", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Pauses) != 0 {
+		t.Errorf("want upcoming pause to be cancelled, got %+v", h.Pauses)
+	}
+}
+
+func TestController_PauseErrors(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(habit.OpenMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.Handle(&habit.Habit{Name: "piano", Frequency: habit.DailyInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.Handle(&habit.Habit{Name: "smoking", Frequency: habit.DailyInterval, Kind: habit.QuitHabit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	testCases := []struct {
+		name        string
+		habit       string
+		from, until time.Time
+	}{
+		{"unknown habit", "surfing", time.Time{}, time.Time{}},
+		{"empty name", "", time.Time{}, time.Time{}},
+		{"quit habit", "smoking", time.Time{}, time.Time{}},
+		{"end before start", "piano", now, now.Add(-habit.DailyInterval)},
+	}
+	for _, tc := range testCases {
+		_, err = controller.Pause("", tc.habit, tc.from, tc.until)
+		if err == nil {
+			t.Errorf("%s: want error", tc.name)
+		}
+	}
+}
+
+func TestController_PauseAllAndResumeAll(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(habit.OpenMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range []*habit.Habit{
+		{Name: "surfing", Frequency: habit.DailyInterval},
+		{Name: "piano", Frequency: habit.WeeklyInterval},
+		{Name: "smoking", Frequency: habit.DailyInterval, Kind: habit.QuitHabit},
+	} {
+		_, err = controller.Handle(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paused, err := controller.PauseAll("", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paused) != 2 || paused[0].Name != "piano" || paused[1].Name != "surfing" {
+		t.Errorf("want piano and surfing to be paused, got %+v", paused)
+	}
+	paused, err = controller.PauseAll("", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paused) != 0 {
+		t.Errorf("want paused habits to be skipped, got %+v", paused)
+	}
+
+	resumed, err := controller.ResumeAll("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resumed) != 2 {
+		t.Errorf("want 2 habits resumed, got %+v", resumed)
+	}
+}
@@ -0,0 +1,211 @@
+package habit
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//SortByName lists habits by name, it is the default order
+	SortByName SortField = iota
+	//SortByStreak lists habits by streak, the shortest first
+	SortByStreak
+	//SortByDueDate lists habits by due date, the earliest first
+	SortByDueDate
+)
+
+//SortField is the field habit listings are ordered by
+type SortField int
+
+//String returns the name of the field as accepted by the -sort flag
+func (f SortField) String() string {
+	switch f {
+	case SortByName:
+		return "name"
+	case SortByStreak:
+		return "streak"
+	case SortByDueDate:
+		return "due"
+	}
+	return "unknown"
+}
+
+func parseSortField(field string) (SortField, error) {
+	for f := SortByName; f <= SortByDueDate; f++ {
+		if f.String() == field {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown sort field: %s, expected name, streak or due", field)
+}
+
+//HabitQuery selects, orders and pages the habits of a user listed by Store.ListHabits. Zero filters match every
+//habit.
+type HabitQuery struct {
+	User string
+	Tag  string
+	//Frequency matches habits checked in daily or weekly
+	Frequency time.Duration
+	//Status matches habits with the given due status now, quit habits have none
+	Status DueStatus
+	SortBy SortField
+	//Descending reverses the order, habits with the same value stay ordered by name
+	Descending bool
+	//Limit is the maximum number of habits returned, 0 returns all of them
+	Limit  int
+	Offset int
+	//Calendar counts the days of Status
+	Calendar Calendar
+}
+
+//Apply returns the habits matching the query in its order and page. Stores that cannot query their habits more
+//efficiently implement ListHabits with it.
+func (q HabitQuery) Apply(habits []*Habit) []*Habit {
+	now := time.Now()
+	matching := make([]*Habit, 0, len(habits))
+	for _, h := range habits {
+		if q.Frequency != 0 && h.Frequency != q.Frequency {
+			continue
+		}
+		if q.Status != 0 && !q.hasStatus(h, now) {
+			continue
+		}
+		matching = append(matching, h)
+	}
+	matching = filterTagged(matching, q.Tag)
+	sort.SliceStable(matching, func(i, j int) bool {
+		a, b := matching[i], matching[j]
+		var less, greater bool
+		switch q.SortBy {
+		case SortByStreak:
+			less, greater = a.Streak < b.Streak, a.Streak > b.Streak
+		case SortByDueDate:
+			less, greater = a.DueDate.Before(b.DueDate), a.DueDate.After(b.DueDate)
+		}
+		if !less && !greater {
+			if q.SortBy == SortByName && q.Descending {
+				return a.Name > b.Name
+			}
+			return a.Name < b.Name
+		}
+		return less != q.Descending
+	})
+	return q.page(matching)
+}
+
+//hasStatus returns whether the habit has the query's due status at the given time
+func (q HabitQuery) hasStatus(h *Habit, now time.Time) bool {
+	return h.Kind != QuitHabit && h.due(q.Calendar, now).Status == q.Status
+}
+
+//page returns the habits within the query's limit and offset
+func (q HabitQuery) page(habits []*Habit) []*Habit {
+	if q.Offset >= len(habits) {
+		return habits[:0]
+	}
+	habits = habits[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(habits) {
+		habits = habits[:q.Limit]
+	}
+	return habits
+}
+
+//validate checks the paging of the query
+func (q HabitQuery) validate() error {
+	if q.Limit < 0 {
+		return fmt.Errorf("limit cannot be negative")
+	}
+	if q.Offset < 0 {
+		return fmt.Errorf("offset cannot be negative")
+	}
+	return nil
+}
+
+//values encodes the query as the query parameters accepted by the habit server, leaving out the user
+func (q HabitQuery) values() url.Values {
+	values := url.Values{}
+	if q.Tag != "" {
+		values.Set("tag", q.Tag)
+	}
+	if q.Frequency != 0 {
+		values.Set("frequency", frequencyName(q.Frequency))
+	}
+	if q.Status != 0 {
+		values.Set("status", q.Status.String())
+	}
+	if q.SortBy != SortByName {
+		values.Set("sort", q.SortBy.String())
+	}
+	if q.Descending {
+		values.Set("desc", "true")
+	}
+	if q.Limit != 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Offset != 0 {
+		values.Set("offset", strconv.Itoa(q.Offset))
+	}
+	return values
+}
+
+//parseHabitQuery parses the options of a listing, as given to the CLI flags or the server's query parameters. Empty
+//options are left out.
+func parseHabitQuery(user, tag, frequency, status, sortBy string, descending bool, limit, offset int) (HabitQuery,
+	error) {
+	q := HabitQuery{User: user, Tag: strings.ToLower(strings.TrimSpace(tag)), Descending: descending, Limit: limit,
+		Offset: offset}
+	if frequency != "" {
+		h, err := parseHabit("query", frequency)
+		if err != nil {
+			return q, err
+		}
+		q.Frequency = h.Frequency
+	}
+	if status != "" {
+		err := q.Status.UnmarshalText([]byte(status))
+		if err != nil {
+			return q, err
+		}
+	}
+	if sortBy != "" {
+		var err error
+		q.SortBy, err = parseSortField(sortBy)
+		if err != nil {
+			return q, err
+		}
+	}
+	return q, q.validate()
+}
+
+//habitQueryFromValues parses the query parameters of a listing request
+func habitQueryFromValues(user string, values url.Values) (HabitQuery, error) {
+	var (
+		descending    bool
+		limit, offset int
+		err           error
+	)
+	if desc := values.Get("desc"); desc != "" {
+		descending, err = strconv.ParseBool(desc)
+		if err != nil {
+			return HabitQuery{}, fmt.Errorf("invalid desc: %s", desc)
+		}
+	}
+	if l := values.Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil {
+			return HabitQuery{}, fmt.Errorf("invalid limit: %s", l)
+		}
+	}
+	if o := values.Get("offset"); o != "" {
+		offset, err = strconv.Atoi(o)
+		if err != nil {
+			return HabitQuery{}, fmt.Errorf("invalid offset: %s", o)
+		}
+	}
+	return parseHabitQuery(user, values.Get("tag"), values.Get("frequency"), values.Get("status"), values.Get("sort"),
+		descending, limit, offset)
+}
@@ -0,0 +1,145 @@
+package habit_test
+
+import (
+	"encoding/json"
+	"github.com/crmejia/habit"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//queryHabits returns habits of every status, frequency and kind, with distinct streaks and due dates
+func queryHabits() []*habit.Habit {
+	now := time.Now()
+	return []*habit.Habit{
+		{Name: "piano", User: "alice", Frequency: habit.DailyInterval, Streak: 3, DueDate: now.AddDate(0, 0, 1),
+			Tags: []string{"music"}},
+		{Name: "guitar", User: "alice", Frequency: habit.DailyInterval, Streak: 1, DueDate: now,
+			Tags: []string{"music"}},
+		{Name: "run", User: "alice", Frequency: habit.WeeklyInterval, Streak: 5, DueDate: now.AddDate(0, 0, 3),
+			Tags: []string{"outdoors"}},
+		{Name: "chess", User: "alice", Frequency: habit.WeeklyInterval, DueDate: now.AddDate(0, 0, -10)},
+		{Name: "smoking", User: "alice", Kind: habit.QuitHabit, Frequency: habit.DailyInterval,
+			DueDate: now.AddDate(0, 0, 2)},
+	}
+}
+
+func habitNames(habits []*habit.Habit) string {
+	names := make([]string, 0, len(habits))
+	for _, h := range habits {
+		names = append(names, h.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestHabitQuery_ApplyFiltersSortsAndPages(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		name  string
+		query habit.HabitQuery
+		want  string
+	}{
+		{"all by name", habit.HabitQuery{}, "chess,guitar,piano,run,smoking"},
+		{"tag", habit.HabitQuery{Tag: "music"}, "guitar,piano"},
+		{"frequency", habit.HabitQuery{Frequency: habit.WeeklyInterval}, "chess,run"},
+		{"due today", habit.HabitQuery{Status: habit.DueTodayStatus}, "guitar"},
+		{"done", habit.HabitQuery{Status: habit.DoneStatus}, "piano,run"},
+		{"broken", habit.HabitQuery{Status: habit.BrokenStatus}, "chess"},
+		{"tag and frequency", habit.HabitQuery{Tag: "music", Frequency: habit.WeeklyInterval}, ""},
+		{"name descending", habit.HabitQuery{Descending: true}, "smoking,run,piano,guitar,chess"},
+		{"streak, ties by name", habit.HabitQuery{SortBy: habit.SortByStreak}, "chess,smoking,guitar,piano,run"},
+		{"streak descending, ties by name", habit.HabitQuery{SortBy: habit.SortByStreak, Descending: true},
+			"run,piano,guitar,chess,smoking"},
+		{"due date", habit.HabitQuery{SortBy: habit.SortByDueDate}, "chess,guitar,piano,smoking,run"},
+		{"limit", habit.HabitQuery{Limit: 2}, "chess,guitar"},
+		{"limit and offset", habit.HabitQuery{Limit: 2, Offset: 2}, "piano,run"},
+		{"offset past the end", habit.HabitQuery{Offset: 10}, ""},
+		{"paged after filtering and sorting", habit.HabitQuery{Tag: "music", SortBy: habit.SortByStreak,
+			Descending: true, Limit: 1}, "piano"},
+		{"status paged", habit.HabitQuery{Status: habit.DoneStatus, Offset: 1}, "run"},
+	}
+	for _, tc := range testCases {
+		got := habitNames(tc.query.Apply(queryHabits()))
+		if got != tc.want {
+			t.Errorf("%s: want %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestHabitQuery_ApplyLeavesQuitHabitsOutOfStatuses(t *testing.T) {
+	t.Parallel()
+	habits := []*habit.Habit{
+		{Name: "smoking", Kind: habit.QuitHabit, Frequency: habit.DailyInterval, DueDate: time.Now()},
+		{Name: "piano", Frequency: habit.DailyInterval, DueDate: time.Now()},
+	}
+	got := habit.HabitQuery{Status: habit.DueTodayStatus}.Apply(habits)
+	if len(got) != 1 || got[0].Name != "piano" {
+		t.Errorf("want only piano to be due today, got %+v", got)
+	}
+	got = habit.HabitQuery{}.Apply(habits)
+	if len(got) != 2 || got[0].Name != "piano" {
+		t.Errorf("want quit habits to be listed without a status filter, got %+v", got)
+	}
+}
+
+func TestServer_ParsesHabitQueries(t *testing.T) {
+	t.Parallel()
+	store := habit.OpenMemoryStore()
+	for _, h := range queryHabits() {
+		err := store.Create(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := habit.NewServer(&controller, localHostAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.DefaultUser = "alice"
+	handler := server.Routes()
+
+	testCases := []struct {
+		query      string
+		wantStatus int
+		want       string
+	}{
+		{"", http.StatusOK, "chess,guitar,piano,run,smoking"},
+		{"tag=+Music+", http.StatusOK, "guitar,piano"},
+		{"frequency=weekly", http.StatusOK, "chess,run"},
+		{"status=due", http.StatusOK, "guitar"},
+		{"sort=streak&desc=true&limit=2", http.StatusOK, "run,piano"},
+		{"sort=due&offset=3", http.StatusOK, "smoking,run"},
+		{"frequency=monthly", http.StatusBadRequest, ""},
+		{"status=late", http.StatusBadRequest, ""},
+		{"sort=age", http.StatusBadRequest, ""},
+		{"desc=maybe", http.StatusBadRequest, ""},
+		{"limit=some", http.StatusBadRequest, ""},
+		{"limit=-1", http.StatusBadRequest, ""},
+		{"offset=-2", http.StatusBadRequest, ""},
+	}
+	for _, tc := range testCases {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/habits?"+tc.query, nil))
+		if recorder.Code != tc.wantStatus {
+			t.Errorf("%s: want status %d, got %d: %s", tc.query, tc.wantStatus, recorder.Code, recorder.Body.String())
+			continue
+		}
+		if tc.wantStatus != http.StatusOK {
+			continue
+		}
+		var habits []*habit.Habit
+		err = json.Unmarshal(recorder.Body.Bytes(), &habits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := habitNames(habits); got != tc.want {
+			t.Errorf("%s: want %q, got %q", tc.query, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package habit
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+//StoreOpener opens the Store described by a parsed DSN
+type StoreOpener func(dsn *url.URL) (Store, error)
+
+var (
+	storesMu sync.RWMutex
+	stores   = make(map[string]StoreOpener)
+)
+
+func init() {
+	RegisterStore("sqlite", func(dsn *url.URL) (Store, error) {
+		return OpenDBStore(dsnPath(dsn))
+	})
+	RegisterStore("file", func(dsn *url.URL) (Store, error) {
+		return OpenFileStore(dsnPath(dsn))
+	})
+	RegisterStore("memory", func(dsn *url.URL) (Store, error) {
+		return OpenMemoryStore(), nil
+	})
+	RegisterStore("http", openHTTPStoreDSN)
+	RegisterStore("https", openHTTPStoreDSN)
+}
+
+//RegisterStore makes a store backend available to OpenStore under the given DSN scheme. It panics if opener is nil or
+//the scheme is already registered.
+func RegisterStore(scheme string, opener StoreOpener) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if opener == nil {
+		panic("habit: RegisterStore opener is nil")
+	}
+	scheme = strings.ToLower(scheme)
+	if _, dup := stores[scheme]; dup {
+		panic("habit: RegisterStore called twice for scheme " + scheme)
+	}
+	stores[scheme] = opener
+}
+
+//Stores returns a sorted list of the registered DSN schemes
+func Stores() []string {
+	storesMu.RLock()
+	defer storesMu.RUnlock()
+	schemes := make([]string, 0, len(stores))
+	for scheme := range stores {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+//OpenStore opens the store described by dsn, for example sqlite:///home/me/.habitTracker.db,
+//file:///home/me/.habitTracker, memory:// or http://homebox:8080?token=TOKEN. A leading ~ in paths is expanded to the
+//home directory.
+func OpenStore(dsn string) (Store, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid store DSN %q: %w", dsn, err)
+	}
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("invalid store DSN %q, expected scheme://location", dsn)
+	}
+	storesMu.RLock()
+	opener, ok := stores[u.Scheme]
+	storesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown store scheme %s, expected one of: %s", u.Scheme, strings.Join(Stores(), ", "))
+	}
+	return opener(u)
+}
+
+//dsnPath returns the filesystem path of a DSN. Both sqlite:///abs/path and sqlite://relative/path are accepted.
+func dsnPath(dsn *url.URL) string {
+	path := dsn.Host + dsn.Path
+	if dsn.Opaque != "" {
+		path = dsn.Opaque
+	}
+	expanded, err := homedir.Expand(path)
+	if err != nil {
+		return path
+	}
+	return expanded
+}
+
+//openHTTPStoreDSN opens an HTTPStore, taking the API token from the token query parameter
+func openHTTPStoreDSN(dsn *url.URL) (Store, error) {
+	u := *dsn
+	query := u.Query()
+	token := query.Get("token")
+	query.Del("token")
+	u.RawQuery = query.Encode()
+	return OpenHTTPStore(u.String(), token)
+}
+
+//legacyStoreDSN converts the store type and directory of the -s and -d flags to a DSN
+func legacyStoreDSN(storeType, dir string) (string, error) {
+	var scheme, filename string
+	switch storeType {
+	case "db":
+		scheme, filename = "sqlite", ".habitTracker.db"
+	case "file":
+		scheme, filename = "file", ".habitTracker"
+	case "remote":
+		return dir, nil
+	default:
+		return "", fmt.Errorf("unknown store type %s", storeType)
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	dsn := url.URL{Scheme: scheme, Path: filepath.ToSlash(filepath.Join(dir, filename))}
+	return dsn.String(), nil
+}
+
+//redactToken returns dsn with the value of its token query parameter hidden, to show or identify a store without
+//its secret
+func redactToken(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.Query().Get("token") == "" {
+		return dsn
+	}
+	query := u.Query()
+	query.Set("token", "REDACTED")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+//withToken adds token to the DSN of a remote store unless it already carries one
+func withToken(dsn, token string) string {
+	if token == "" {
+		return dsn
+	}
+	u, err := url.Parse(dsn)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return dsn
+	}
+	query := u.Query()
+	if query.Get("token") != "" {
+		return dsn
+	}
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,124 @@
+package habit_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/crmejia/habit"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOpenStoreOpensRegisteredSchemes(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	testCases := []struct {
+		dsn  string
+		want string
+	}{
+		{"sqlite://" + dir + "/test.db", "*habit.DBStore"},
+		{"file://" + dir + "/.habitTracker", "*habit.FileStore"},
+		{"memory://", "*habit.MemoryStore"},
+		{"http://127.0.0.1:8080?token=secret", "*habit.HTTPStore"},
+	}
+	for _, tc := range testCases {
+		store, err := habit.OpenStore(tc.dsn)
+		if err != nil {
+			t.Errorf("%s: %v", tc.dsn, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T", store); got != tc.want {
+			t.Errorf("%s: want %s, got %s", tc.dsn, tc.want, got)
+		}
+	}
+	for _, name := range []string{"test.db", ".habitTracker"} {
+		_, err := os.Stat(dir + "/" + name)
+		if err != nil {
+			t.Errorf("want OpenStore to create %s in the DSN path", name)
+		}
+	}
+}
+
+func TestOpenStoreErrorsOnInvalidDSN(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		dsn  string
+		want string
+	}{
+		{"/home/me/.habitTracker", "expected scheme://location"},
+		{"cloud://bucket", "unknown store scheme cloud"},
+		{"sqlite://", "empty"},
+		{"http://", "invalid server URL"},
+	}
+	for _, tc := range testCases {
+		_, err := habit.OpenStore(tc.dsn)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: want error containing %q, got %v", tc.dsn, tc.want, err)
+		}
+	}
+}
+
+func TestRegisterStoreAddsBackend(t *testing.T) {
+	t.Parallel()
+	var opened string
+	habit.RegisterStore("registrytest", func(dsn *url.URL) (habit.Store, error) {
+		opened = dsn.Host
+		return habit.OpenMemoryStore(), nil
+	})
+	store, err := habit.OpenStore("registrytest://bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store == nil || opened != "bucket" {
+		t.Errorf("want registered opener to receive the DSN, got %q", opened)
+	}
+
+	found := false
+	for _, scheme := range habit.Stores() {
+		found = found || scheme == "registrytest"
+	}
+	if !found {
+		t.Errorf("want Stores to list the registered scheme, got %v", habit.Stores())
+	}
+}
+
+func TestRegisterStorePanicsOnDuplicateScheme(t *testing.T) {
+	t.Parallel()
+	defer func() {
+		if recover() == nil {
+			t.Error("want RegisterStore to panic on a duplicate scheme")
+		}
+	}()
+	habit.RegisterStore("sqlite", func(dsn *url.URL) (habit.Store, error) {
+		return nil, errors.New("not reached")
+	})
+}
+
+func TestRunCLIOpensStoreDSN(t *testing.T) {
+	t.Parallel()
+	fileName := t.TempDir() + "/habits.json"
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-store", "file://" + fileName, "-u", "alice", "piano"}, &buffer)
+	if !strings.Contains(buffer.String(), "Good luck with your new habit") {
+		t.Fatalf("want habit to be created, got:\n%s", buffer.String())
+	}
+	store, err := habit.OpenFileStore(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := store.Get("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h == nil {
+		t.Error("want habit to be stored in the DSN's file")
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"--store", "cloud://bucket", "piano"}, &buffer)
+	if !strings.Contains(buffer.String(), "unknown store scheme cloud") {
+		t.Errorf("want unknown scheme error, got:\n%s", buffer.String())
+	}
+}
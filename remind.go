@@ -0,0 +1,310 @@
+package habit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//Reminder tells that a habit is due today or overdue
+type Reminder struct {
+	User    string
+	Name    string
+	Status  DueStatus
+	Streak  int
+	DueDate time.Time
+	Message string
+
+	//dueDay is the day DueDate counts toward, as counted by the controller's Calendar
+	dueDay string
+}
+
+//defaultNotifyTimeout bounds every notification unless Reminders.Timeout is set
+const defaultNotifyTimeout = 30 * time.Second
+
+//defaultHTTPClient is used by the notifiers and webhook dispatchers posting over HTTP without a Client. Unlike
+//http.DefaultClient it gives up on servers that never respond.
+var defaultHTTPClient = &http.Client{Timeout: defaultNotifyTimeout}
+
+//Notifier delivers reminders. Reminders are sent once to every notifier, which is identified by its String when it is
+//a fmt.Stringer, so that it is still known when notifiers are added or removed between checks, and by its type and
+//position among the notifiers otherwise.
+type Notifier interface {
+	Notify(ctx context.Context, r Reminder) error
+}
+
+//Reminders checks the habits of Users for the ones about to lapse and sends a reminder to every notifier once per
+//period. Habits overdue but still savable are reminded right away, habits due today once the end of the day is less
+//than Before away, or as soon as they are due if Before is zero.
+type Reminders struct {
+	Controller Controller
+	Users      []string
+	Notifiers  []Notifier
+	Before     time.Duration
+	//SentFile keeps the reminders already sent in a JSON file, so that checks run by separate processes, such as a
+	//cron job, send them once as well. Without it they are only kept in memory.
+	SentFile string
+	//Timeout bounds every notification, so that one hanging doesn't hold up the others. It defaults to 30 seconds.
+	Timeout time.Duration
+
+	mu   sync.Mutex
+	sent map[string]bool
+}
+
+//Check sends the reminders due now and returns them. Reminders that fail to be delivered are retried by the next
+//check, the returned error reports the last failure.
+func (r *Reminders) Check(ctx context.Context) ([]Reminder, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sent == nil {
+		err := r.loadSent()
+		if err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	sent := make(map[string]bool)
+	var (
+		reminded []Reminder
+		failed   int
+		lastErr  error
+	)
+	for _, user := range r.Users {
+		for _, d := range r.Controller.DueHabits(user) {
+			if !r.shouldRemind(d, now) {
+				continue
+			}
+			reminder := Reminder{User: user, Name: d.Name, Status: d.Status, Streak: d.Streak, DueDate: d.DueDate,
+				Message: d.String(), dueDay: d.day()}
+			delivered := false
+			for i, n := range r.Notifiers {
+				key := fmt.Sprintf("%s/%s/%s/%s", notifierID(n, i), user, d.Name, d.day())
+				if r.sent[key] {
+					sent[key] = true
+					continue
+				}
+				err := r.notify(ctx, n, reminder)
+				if err != nil {
+					failed++
+					lastErr = err
+					continue
+				}
+				sent[key] = true
+				delivered = true
+			}
+			if delivered {
+				reminded = append(reminded, reminder)
+			}
+		}
+	}
+	//periods no longer due are forgotten
+	r.sent = sent
+	err := r.saveSent()
+	if err != nil {
+		return reminded, err
+	}
+	if lastErr != nil {
+		return reminded, fmt.Errorf("%d reminders failed, last error: %w", failed, lastErr)
+	}
+	return reminded, nil
+}
+
+//notify sends the reminder to the notifier, giving up after Timeout
+func (r *Reminders) notify(ctx context.Context, n Notifier, reminder Reminder) error {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = defaultNotifyTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return n.Notify(ctx, reminder)
+}
+
+//notifierID returns the identity of the notifier at index i of Notifiers
+func notifierID(n Notifier, i int) string {
+	if s, ok := n.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T#%d", n, i)
+}
+
+//loadSent reads the reminders sent by earlier checks from SentFile. It triggers file io operations.
+func (r *Reminders) loadSent() error {
+	r.sent = make(map[string]bool)
+	if r.SentFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(r.SentFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var keys []string
+	err = json.Unmarshal(data, &keys)
+	if err != nil {
+		return fmt.Errorf("cannot read sent reminders from %s: %w", r.SentFile, err)
+	}
+	for _, key := range keys {
+		r.sent[key] = true
+	}
+	return nil
+}
+
+//saveSent writes the sent reminders to SentFile, replacing the saved ones. It triggers file io operations.
+func (r *Reminders) saveSent() error {
+	if r.SentFile == "" {
+		return nil
+	}
+	keys := make([]string, 0, len(r.sent))
+	for key := range r.sent {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.SentFile, data, 0600)
+}
+
+func (r *Reminders) shouldRemind(d HabitDue, now time.Time) bool {
+	switch d.Status {
+	case OverdueStatus:
+		return true
+	case DueTodayStatus:
+		endOfDay := r.Controller.Calendar.startOfDay(now).AddDate(0, 0, 1)
+		return r.Before == 0 || !now.Before(endOfDay.Add(-r.Before))
+	}
+	return false
+}
+
+//Run checks for reminders every interval until ctx is done, passing the reminders sent and errors of every check to
+//report
+func (r *Reminders) Run(ctx context.Context, every time.Duration, report func(reminded []Reminder, err error)) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		reminded, err := r.Check(ctx)
+		report(reminded, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//CommandNotifier runs Command with sh for every reminder. The reminder is passed in the HABIT_USER, HABIT_NAME,
+//HABIT_STATUS, HABIT_STREAK, HABIT_DUE and HABIT_MESSAGE environment variables.
+type CommandNotifier struct {
+	Command string
+}
+
+//String identifies the notifier by its command
+func (n CommandNotifier) String() string {
+	return "exec " + n.Command
+}
+
+//Notify runs the command
+func (n CommandNotifier) Notify(ctx context.Context, r Reminder) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", n.Command)
+	cmd.Env = append(os.Environ(),
+		"HABIT_USER="+r.User,
+		"HABIT_NAME="+r.Name,
+		"HABIT_STATUS="+r.Status.String(),
+		"HABIT_STREAK="+strconv.Itoa(r.Streak),
+		"HABIT_DUE="+r.day(),
+		"HABIT_MESSAGE="+r.Message,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("reminder command failed: %w: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+//day returns the day the habit is due, a local day from midnight for reminders not made by Reminders
+func (r Reminder) day() string {
+	if r.dueDay == "" {
+		return Calendar{}.formatDay(r.DueDate)
+	}
+	return r.dueDay
+}
+
+//DesktopNotifier shows reminders as desktop notifications with notify-send
+type DesktopNotifier struct {
+	path string
+}
+
+//NewDesktopNotifier returns a DesktopNotifier, or an error if notify-send is not installed
+func NewDesktopNotifier() (*DesktopNotifier, error) {
+	path, err := exec.LookPath("notify-send")
+	if err != nil {
+		return nil, errors.New("notify-send not found, desktop notifications are unavailable")
+	}
+	return &DesktopNotifier{path: path}, nil
+}
+
+//String identifies the notifier, there is one desktop to notify
+func (n *DesktopNotifier) String() string {
+	return "desktop"
+}
+
+//Notify shows the notification
+func (n *DesktopNotifier) Notify(ctx context.Context, r Reminder) error {
+	output, err := exec.CommandContext(ctx, n.path, "habit: "+r.Name, r.Message).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("notify-send failed: %w: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+//WebhookNotifier posts every reminder as JSON to URL
+type WebhookNotifier struct {
+	URL string
+	//Client defaults to a client with a timeout of 30 seconds
+	Client *http.Client
+}
+
+//String identifies the notifier by its URL
+func (n WebhookNotifier) String() string {
+	return "webhook " + n.URL
+}
+
+//Notify posts the reminder
+func (n WebhookNotifier) Notify(ctx context.Context, r Reminder) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := n.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("reminder webhook %s returned %s", n.URL, resp.Status)
+	}
+	return nil
+}
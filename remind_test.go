@@ -0,0 +1,270 @@
+package habit_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/crmejia/habit"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordingNotifier struct {
+	reminders []habit.Reminder
+	err       error
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, r habit.Reminder) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.reminders = append(n.reminders, r)
+	return nil
+}
+
+//namedNotifier is a recordingNotifier identified by its name
+type namedNotifier struct {
+	*recordingNotifier
+	name string
+}
+
+func (n namedNotifier) String() string {
+	return n.name
+}
+
+//hangingNotifier never delivers a reminder, waiting until it is given up on
+type hangingNotifier struct{}
+
+func (hangingNotifier) Notify(ctx context.Context, r habit.Reminder) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func newRemindersStore() *habit.MemoryStore {
+	now := time.Now()
+	return &habit.MemoryStore{Habits: map[string]map[string]*habit.Habit{"alice": {
+		"piano": {Name: "piano", User: "alice", Frequency: habit.DailyInterval, Streak: 3, DueDate: now},
+		"surfing": {Name: "surfing", User: "alice", Frequency: habit.DailyInterval, Streak: 4, Freezes: 1,
+			DueDate: now.Add(-habit.DailyInterval)},
+		"reading": {Name: "reading", User: "alice", Frequency: habit.DailyInterval, Streak: 5,
+			DueDate: now.Add(habit.DailyInterval)},
+	}}}
+}
+
+func TestReminders_CheckRemindsOncePerPeriod(t *testing.T) {
+	t.Parallel()
+	store := newRemindersStore()
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := &recordingNotifier{}
+	reminders := habit.Reminders{Controller: controller, Users: []string{"alice"},
+		Notifiers: []habit.Notifier{notifier}}
+
+	reminded, err := reminders.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reminded) != 2 || reminded[0].Name != "surfing" || reminded[0].Status != habit.OverdueStatus ||
+		reminded[1].Name != "piano" || reminded[1].Status != habit.DueTodayStatus {
+		t.Fatalf("want overdue surfing and piano due today to be reminded, got %+v", reminded)
+	}
+	if reminded[1].User != "alice" || reminded[1].Message != "'piano' is due today to keep your 3-day streak going." {
+		t.Errorf("want reminder to describe the habit, got %+v", reminded[1])
+	}
+
+	reminded, err = reminders.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reminded) != 0 || len(notifier.reminders) != 2 {
+		t.Errorf("want reminders to fire once, got %+v", notifier.reminders)
+	}
+
+	_, err = controller.Handle(&habit.Habit{Name: "piano", User: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = reminders.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the next period is due
+	store.Habits["alice"]["piano"].DueDate = time.Now()
+	reminded, err = reminders.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reminded) != 1 || reminded[0].Name != "piano" {
+		t.Errorf("want a new period to be reminded again, got %+v", reminded)
+	}
+}
+
+func TestReminders_CheckRemembersSentRemindersInSentFile(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(newRemindersStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sentFile := filepath.Join(t.TempDir(), "sent.json")
+	notifier := &recordingNotifier{}
+	for i := 0; i < 2; i++ {
+		//every run starts with new Reminders, as a cron job would
+		reminders := habit.Reminders{Controller: controller, Users: []string{"alice"},
+			Notifiers: []habit.Notifier{notifier}, SentFile: sentFile}
+		_, err = reminders.Check(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(notifier.reminders) != 2 {
+		t.Errorf("want reminders to be sent once across runs, got %+v", notifier.reminders)
+	}
+}
+
+func TestReminders_CheckKeysSentRemindersByNotifier(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(newRemindersStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sentFile := filepath.Join(t.TempDir(), "sent.json")
+	phone := namedNotifier{&recordingNotifier{}, "phone"}
+	laptop := namedNotifier{&recordingNotifier{}, "laptop"}
+	//a notifier added before the one used by the first run takes its position
+	for _, notifiers := range [][]habit.Notifier{{phone}, {laptop, phone}} {
+		reminders := habit.Reminders{Controller: controller, Users: []string{"alice"}, Notifiers: notifiers,
+			SentFile: sentFile}
+		_, err = reminders.Check(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(phone.reminders) != 2 || len(laptop.reminders) != 2 {
+		t.Errorf("want every notifier reminded once, got %d and %d", len(phone.reminders), len(laptop.reminders))
+	}
+}
+
+func TestReminders_CheckGivesUpOnHangingNotifier(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(newRemindersStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	working := &recordingNotifier{}
+	reminders := habit.Reminders{Controller: controller, Users: []string{"alice"},
+		Notifiers: []habit.Notifier{hangingNotifier{}, working}, Timeout: 10 * time.Millisecond}
+	_, err = reminders.Check(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want the hanging notifier to time out, got %v", err)
+	}
+	if len(working.reminders) != 2 {
+		t.Errorf("want the other notifier reminded, got %+v", working.reminders)
+	}
+}
+
+func TestReminders_CheckWaitsUntilBeforeEndOfDay(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(newRemindersStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := &recordingNotifier{}
+	reminders := habit.Reminders{Controller: controller, Users: []string{"alice"},
+		Notifiers: []habit.Notifier{notifier}, Before: time.Nanosecond}
+	reminded, err := reminders.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reminded) != 1 || reminded[0].Name != "surfing" {
+		t.Errorf("want only the overdue habit to be reminded, got %+v", reminded)
+	}
+}
+
+func TestReminders_CheckRetriesFailedReminders(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(newRemindersStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing := &recordingNotifier{err: errors.New("offline")}
+	working := &recordingNotifier{}
+	reminders := habit.Reminders{Controller: controller, Users: []string{"alice"},
+		Notifiers: []habit.Notifier{failing, working}}
+	_, err = reminders.Check(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "2 reminders failed, last error: offline") {
+		t.Errorf("want failures to be reported, got %v", err)
+	}
+
+	failing.err = nil
+	_, err = reminders.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failing.reminders) != 2 || len(working.reminders) != 2 {
+		t.Errorf("want failed reminders to be retried without repeating delivered ones, got %d and %d",
+			len(failing.reminders), len(working.reminders))
+	}
+}
+
+func TestCommandNotifierPassesReminderInEnvironment(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "reminder")
+	notifier := habit.CommandNotifier{Command: `echo "$HABIT_USER $HABIT_NAME $HABIT_STATUS $HABIT_STREAK" > ` + path}
+	err := notifier.Notify(context.Background(), habit.Reminder{User: "alice", Name: "piano",
+		Status: habit.OverdueStatus, Streak: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "alice piano overdue 3\n" {
+		t.Errorf("want reminder in the environment, got %q", got)
+	}
+
+	err = habit.CommandNotifier{Command: "echo oops; exit 1"}.Notify(context.Background(), habit.Reminder{})
+	if err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Errorf("want failing command to return its output, got %v", err)
+	}
+}
+
+func TestWebhookNotifierPostsReminder(t *testing.T) {
+	t.Parallel()
+	received := make(chan habit.Reminder, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		reminder := habit.Reminder{}
+		err := json.NewDecoder(r.Body).Decode(&reminder)
+		if err != nil || r.Method != http.MethodPost {
+			http.Error(w, "bad reminder", http.StatusBadRequest)
+			return
+		}
+		received <- reminder
+	}))
+	defer server.Close()
+
+	notifier := habit.WebhookNotifier{URL: server.URL}
+	err := notifier.Notify(context.Background(), habit.Reminder{Name: "piano", Status: habit.DueTodayStatus})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got.Name != "piano" || got.Status != habit.DueTodayStatus {
+		t.Errorf("want reminder to be posted, got %+v", got)
+	}
+
+	err = habit.WebhookNotifier{URL: server.URL + "/fail"}.Notify(context.Background(), habit.Reminder{})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("want error on a failed delivery, got %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package habit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	remoteTimeout   = 10 * time.Second
+	remoteRetries   = 3
+	remoteRetryWait = 500 * time.Millisecond
+)
+
+//HTTPStore is a Store backed by the JSON API of a habit server. The server decides which user's habits are served
+//based on the token, so the user passed to Get and GetAllHabits is ignored.
+type HTTPStore struct {
+	baseURL string
+	token   string
+	//Client is used for every request, its Timeout bounds each attempt
+	Client *http.Client
+	//Retries is the number of times a request is retried when the server is unreachable or unavailable
+	Retries int
+	//RetryWait is the time waited before the first retry, it doubles on each subsequent retry
+	RetryWait time.Duration
+}
+
+//OpenHTTPStore returns a Store that talks to the habit server at baseURL, authenticating with the given API token.
+func OpenHTTPStore(baseURL, token string) (Store, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return &HTTPStore{}, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &HTTPStore{}, fmt.Errorf("invalid server URL %q, expected http://host:port", baseURL)
+	}
+	store := HTTPStore{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		token:     token,
+		Client:    &http.Client{Timeout: remoteTimeout},
+		Retries:   remoteRetries,
+		RetryWait: remoteRetryWait,
+	}
+	return &store, nil
+}
+
+//Get fetches the habit with the given name from the server and returns it if it exists
+func (s *HTTPStore) Get(user, name string) (*Habit, error) {
+	h := Habit{}
+	status, err := s.do(http.MethodGet, "/api/habits/"+url.PathEscape(name), nil, &h)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+//Create sends the given habit to the server. It returns an error if the habit already exists
+func (s *HTTPStore) Create(habit *Habit) error {
+	if habit == nil {
+		return ErrNilHabit
+	}
+	status, err := s.do(http.MethodPost, "/api/habits", habit, nil)
+	if status == http.StatusConflict {
+		return ErrHabitExists
+	}
+	return err
+}
+
+//Update sends the given habit to the server. It returns an error if the habit does not exist
+func (s *HTTPStore) Update(habit *Habit) error {
+	if habit == nil {
+		return ErrNilHabit
+	}
+	status, err := s.do(http.MethodPut, "/api/habits/"+url.PathEscape(habit.Name), habit, nil)
+	if status == http.StatusNotFound {
+		return ErrHabitNotFound
+	}
+	return err
+}
+
+//Delete asks the server to delete the habit. It returns an error if the habit does not exist
+func (s *HTTPStore) Delete(user, name string) error {
+	status, err := s.do(http.MethodDelete, "/api/habits/"+url.PathEscape(name), nil, nil)
+	if status == http.StatusNotFound {
+		return ErrHabitNotFound
+	}
+	return err
+}
+
+//GetAllHabits returns a []*Habits of all the habits the server holds for the token's user. It returns nil if the
+//server cannot be reached.
+func (s *HTTPStore) GetAllHabits(user string) []*Habit {
+	habits := make([]*Habit, 0)
+	_, err := s.do(http.MethodGet, "/api/habits", nil, &habits)
+	if err != nil {
+		return nil
+	}
+	return habits
+}
+
+//ListHabits returns the habits the server holds for the token's user, selected, ordered and paged by the server
+func (s *HTTPStore) ListHabits(query HabitQuery) ([]*Habit, error) {
+	err := query.validate()
+	if err != nil {
+		return nil, err
+	}
+	path := "/api/habits"
+	if values := query.values(); len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+	habits := make([]*Habit, 0)
+	_, err = s.do(http.MethodGet, path, nil, &habits)
+	if err != nil {
+		return nil, err
+	}
+	return habits, nil
+}
+
+//do sends a request with the JSON encoded body and decodes a successful response into out. Requests are retried with
+//an exponential backoff while the server is unreachable or unavailable. The returned status is 0 if no response was
+//received.
+func (s *HTTPStore) do(method, path string, body interface{}, out interface{}) (int, error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	wait := s.RetryWait
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, s.baseURL+path, bytes.NewReader(payload))
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if s.token != "" {
+			req.Header.Set("Authorization", "Bearer "+s.token)
+		}
+
+		res, err := s.Client.Do(req)
+		if err != nil {
+			//a create that was sent but timed out might have been applied, only retry it if it never left
+			retryable := method != http.MethodPost || isDialError(err)
+			if attempt < s.Retries && retryable {
+				time.Sleep(wait)
+				wait *= 2
+				continue
+			}
+			return 0, fmt.Errorf("habit server at %s is unreachable: %w", s.baseURL, err)
+		}
+
+		resBody, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return res.StatusCode, err
+		}
+
+		switch {
+		case res.StatusCode >= 200 && res.StatusCode < 300:
+			if out != nil {
+				err = json.Unmarshal(resBody, out)
+			}
+			return res.StatusCode, err
+		case res.StatusCode == http.StatusUnauthorized:
+			return res.StatusCode, fmt.Errorf("habit server at %s rejected the API token", s.baseURL)
+		case res.StatusCode == http.StatusForbidden:
+			return res.StatusCode, fmt.Errorf("the API token is not allowed to %s habits", methodAction(method))
+		case res.StatusCode == http.StatusBadGateway || res.StatusCode == http.StatusServiceUnavailable ||
+			res.StatusCode == http.StatusGatewayTimeout:
+			if attempt < s.Retries && method != http.MethodPost {
+				time.Sleep(wait)
+				wait *= 2
+				continue
+			}
+		}
+		return res.StatusCode, fmt.Errorf("habit server at %s returned %s: %s", s.baseURL, res.Status,
+			strings.TrimSpace(string(resBody)))
+	}
+}
+
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func methodAction(method string) string {
+	if method == http.MethodGet {
+		return "read"
+	}
+	return "modify"
+}
@@ -0,0 +1,291 @@
+package habit_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/crmejia/habit"
+	"github.com/crmejia/habit/storetest"
+	"github.com/phayes/freeport"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestHabitServer(t *testing.T, scope habit.Scope) (*habit.MemoryStore, *httptest.Server, string) {
+	t.Helper()
+	store := habit.OpenMemoryStore()
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := habit.NewServer(&controller, localHostAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.EnableAuth(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, secret, err := habit.NewToken("alice", "test", scope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.CreateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testServer := httptest.NewServer(server.Routes())
+	t.Cleanup(testServer.Close)
+	return store, testServer, secret
+}
+
+func TestOpenHTTPStoreErrorsOnInvalidURL(t *testing.T) {
+	t.Parallel()
+	for _, baseURL := range []string{"", "localhost:8080", "ftp://localhost", "http://"} {
+		_, err := habit.OpenHTTPStore(baseURL, "token")
+		if err == nil {
+			t.Errorf("want OpenHTTPStore to fail on %q", baseURL)
+		}
+	}
+}
+
+func TestHTTPStore_CreateGetUpdateRoundTrip(t *testing.T) {
+	t.Parallel()
+	serverStore, testServer, secret := newTestHabitServer(t, habit.StoreScope)
+	store, err := habit.OpenHTTPStore(testServer.URL, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := store.Get("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h != nil {
+		t.Error("want Get to return nil on unknown habit")
+	}
+
+	dueDate := time.Now().Add(habit.DailyInterval).Truncate(time.Second)
+	err = store.Create(&habit.Habit{Name: "piano", Frequency: habit.DailyInterval, DueDate: dueDate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serverStore.Habits["alice"]["piano"] == nil {
+		t.Fatal("want habit to be created for the token's user")
+	}
+	err = store.Create(&habit.Habit{Name: "piano", Frequency: habit.DailyInterval})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("want creating an existing habit to fail, got %v", err)
+	}
+
+	h, err = store.Get("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h == nil || h.Frequency != habit.DailyInterval || !h.DueDate.Equal(dueDate) {
+		t.Fatalf("want Get to return the created habit, got %+v", h)
+	}
+
+	h.Streak = 5
+	err = store.Update(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serverStore.Habits["alice"]["piano"].Streak != 5 {
+		t.Error("want Update to change the habit on the server")
+	}
+	err = store.Update(&habit.Habit{Name: "surfing"})
+	if err == nil {
+		t.Error("want updating an unknown habit to fail")
+	}
+
+	got := store.GetAllHabits("alice")
+	if len(got) != 1 || got[0].Name != "piano" {
+		t.Errorf("want GetAllHabits to return the server's habits, got %+v", got)
+	}
+}
+
+func TestHTTPStore_ControllerHandlesRemoteHabits(t *testing.T) {
+	t.Parallel()
+	serverStore, testServer, secret := newTestHabitServer(t, habit.StoreScope)
+	store, err := habit.OpenHTTPStore(testServer.URL, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := controller.Handle(&habit.Habit{Name: "piano", User: "alice", Frequency: habit.DailyInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(h.String(), "Good luck with your new habit") {
+		t.Errorf("want new habit message, got %s", h)
+	}
+	if serverStore.Habits["alice"]["piano"] == nil {
+		t.Error("want controller to create the habit on the server")
+	}
+}
+
+func TestHTTPStore_ReportsAuthErrors(t *testing.T) {
+	t.Parallel()
+	_, testServer, secret := newTestHabitServer(t, habit.ReadScope)
+
+	store, err := habit.OpenHTTPStore(testServer.URL, "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Get("alice", "piano")
+	if err == nil || !strings.Contains(err.Error(), "rejected the API token") {
+		t.Errorf("want invalid token error, got %v", err)
+	}
+
+	store, err = habit.OpenHTTPStore(testServer.URL, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Create(&habit.Habit{Name: "piano"})
+	if err == nil || !strings.Contains(err.Error(), "not allowed to modify") {
+		t.Errorf("want read only token to be refused, got %v", err)
+	}
+}
+
+func TestHTTPStore_ReportsUnreachableServer(t *testing.T) {
+	t.Parallel()
+	freePort, err := freeport.GetFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := habit.OpenHTTPStore(fmt.Sprintf("http://%s:%d", localHostAddress, freePort), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.(*habit.HTTPStore).RetryWait = time.Millisecond
+
+	_, err = store.Get("alice", "piano")
+	if err == nil || !strings.Contains(err.Error(), "is unreachable") {
+		t.Errorf("want unreachable server error, got %v", err)
+	}
+}
+
+func TestHTTPStore_RetriesUnavailableServer(t *testing.T) {
+	t.Parallel()
+	var calls int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"Name":"piano","Streak":2}`))
+	}))
+	defer testServer.Close()
+
+	store, err := habit.OpenHTTPStore(testServer.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.(*habit.HTTPStore).RetryWait = time.Millisecond
+
+	h, err := store.Get("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Streak != 2 || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("want Get to succeed after retrying, got %+v after %d calls", h, atomic.LoadInt32(&calls))
+	}
+}
+
+func TestHTTPStore_TimesOutSlowServer(t *testing.T) {
+	t.Parallel()
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer testServer.Close()
+
+	store, err := habit.OpenHTTPStore(testServer.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpStore := store.(*habit.HTTPStore)
+	httpStore.Client.Timeout = 10 * time.Millisecond
+	httpStore.Retries = 0
+
+	_, err = store.Get("alice", "piano")
+	if err == nil || !strings.Contains(err.Error(), "is unreachable") {
+		t.Errorf("want timeout error, got %v", err)
+	}
+}
+
+func TestRunCLIRemoteStore(t *testing.T) {
+	t.Parallel()
+	serverStore, testServer, secret := newTestHabitServer(t, habit.StoreScope)
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-s", "remote", "-d", testServer.URL, "-t", secret, "piano"}, &buffer)
+	if !strings.Contains(buffer.String(), "Good luck with your new habit") {
+		t.Errorf("want remote habit to be created, got:\n%s", buffer.String())
+	}
+	if serverStore.Habits["alice"]["piano"] == nil {
+		t.Error("want habit to be stored on the server")
+	}
+}
+
+//userHTTPStore routes each user to an HTTPStore authenticated with that user's token, as the server picks the user
+//from the token rather than from the habit
+type userHTTPStore map[string]habit.Store
+
+func (s userHTTPStore) Get(user, name string) (*habit.Habit, error) {
+	return s[user].Get(user, name)
+}
+
+func (s userHTTPStore) Create(h *habit.Habit) error {
+	if h == nil {
+		return s["alice"].Create(h)
+	}
+	return s[h.User].Create(h)
+}
+
+func (s userHTTPStore) Update(h *habit.Habit) error {
+	if h == nil {
+		return s["alice"].Update(h)
+	}
+	return s[h.User].Update(h)
+}
+
+func (s userHTTPStore) GetAllHabits(user string) []*habit.Habit {
+	return s[user].GetAllHabits(user)
+}
+
+func (s userHTTPStore) ListHabits(query habit.HabitQuery) ([]*habit.Habit, error) {
+	return s[query.User].ListHabits(query)
+}
+
+func (s userHTTPStore) Delete(user, name string) error {
+	return s[user].Delete(user, name)
+}
+
+func TestHTTPStoreConformance(t *testing.T) {
+	t.Parallel()
+	storetest.RunConformance(t, func() habit.Store {
+		serverStore, testServer, aliceSecret := newTestHabitServer(t, habit.StoreScope)
+		token, bobSecret, err := habit.NewToken("bob", "test", habit.StoreScope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = serverStore.CreateToken(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store := userHTTPStore{}
+		for user, secret := range map[string]string{"alice": aliceSecret, "bob": bobSecret} {
+			store[user], err = habit.OpenHTTPStore(testServer.URL, secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return store
+	})
+}
@@ -1,15 +1,25 @@
 package habit
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 type server struct {
 	*http.Server
 	controller *Controller
+	tokens     TokenStore
+	hooks      sync.Mutex
+	//DefaultUser owns the habits served when auth is disabled
+	DefaultUser string
 }
 
 //NewServer returns a new server
@@ -24,7 +34,8 @@ func NewServer(controller *Controller, address string) (*server, error) {
 	server := server{
 		Server: &http.Server{
 			Addr: address},
-		controller: controller,
+		controller:  controller,
+		DefaultUser: DefaultUser(),
 	}
 	return &server, nil
 }
@@ -40,16 +51,23 @@ func (server *server) Run() {
 	}
 }
 
-//Routes returns a http.Handler with the appropriate routes
+//Routes returns a http.Handler with the appropriate routes. Routes require a token when auth is enabled.
 func (server *server) Routes() http.Handler {
 	router := http.NewServeMux()
-	router.HandleFunc("/", server.HandleIndex())
-	router.HandleFunc("/all", server.HandleAll())
+	router.Handle("/", server.requireScope(CheckInScope, server.HandleIndex()))
+	router.Handle("/all", server.requireScope(ReadScope, server.HandleAll()))
+	router.Handle("/api/habits", server.requireMethodScope(server.HandleAPIHabits()))
+	router.Handle("/api/habits/", server.requireMethodScope(server.HandleAPIHabit()))
+	router.Handle("/api/due", server.requireScope(ReadScope, server.HandleAPIDue()))
+	router.Handle("/api/pause", server.requireScope(CheckInScope, server.HandleAPIPauseAll()))
+	router.Handle("/api/resume", server.requireScope(CheckInScope, server.HandleAPIResumeAll()))
+	router.Handle("/hooks/checkin", tokenFromQuery(server.requireScope(HookScope, server.HandleHookCheckIn())))
 
 	return router
 }
 
-//HandleIndex handler that servers habits.
+//HandleIndex handler that servers habits. A new habit whose name is close to an existing one is only created with the
+//create=true query parameter, otherwise the response is a 404 suggesting the existing names.
 func (server *server) HandleIndex() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		//parsing querystring
@@ -69,8 +87,37 @@ func (server *server) HandleIndex() http.HandlerFunc {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		inputHabit.User = server.requestUser(r)
+		inputHabit.Kind, err = parseKind(r.FormValue("kind"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if grace := r.FormValue("grace"); grace != "" {
+			inputHabit.GraceDays, err = strconv.Atoi(grace)
+			if err != nil {
+				http.Error(w, "invalid grace period", http.StatusBadRequest)
+				return
+			}
+		}
+		amount, err := parseQuantity(inputHabit, r.FormValue("target"), r.FormValue("unit"), r.FormValue("amount"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		create := false
+		if value := r.FormValue("create"); value != "" {
+			create, err = strconv.ParseBool(value)
+			if err != nil {
+				http.Error(w, "invalid create", http.StatusBadRequest)
+				return
+			}
+		}
+		if !create && !server.allowNewName(w, inputHabit.User, habitName) {
+			return
+		}
 
-		h, err := server.controller.Handle(inputHabit)
+		h, err := server.controller.HandleAmount(inputHabit, amount)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
@@ -79,10 +126,373 @@ func (server *server) HandleIndex() http.HandlerFunc {
 	}
 }
 
-//HandleAll handler that serves /all
+//HandleAll handler that serves /all. The optional tag, frequency, status, sort, desc, limit and offset query
+//parameters select, order and page the habits listed.
 func (server *server) HandleAll() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		allHabits := server.controller.GetAllHabits()
+		query, err := habitQueryFromValues(server.requestUser(r), r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		allHabits, err := server.controller.GetHabits(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		fmt.Fprint(w, allHabits)
 	}
 }
+
+//HandleAPIHabits handler that serves /api/habits. GET lists the user's habits, selected, ordered and paged by the same
+//query parameters as /all, and POST creates the JSON encoded habit in the request body.
+func (server *server) HandleAPIHabits() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := server.requestUser(r)
+		switch r.Method {
+		case http.MethodGet:
+			query, err := habitQueryFromValues(user, r.URL.Query())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			query.Calendar = server.controller.Calendar
+			habits, err := server.controller.Store.ListHabits(query)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, nonNilHabits(habits))
+		case http.MethodPost:
+			h := Habit{}
+			err := json.NewDecoder(r.Body).Decode(&h)
+			if err != nil {
+				http.Error(w, "cannot parse habit", http.StatusBadRequest)
+				return
+			}
+			err = h.validateStored()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			h.User = user
+			err = server.controller.Store.Create(&h)
+			if errors.Is(err, ErrHabitExists) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusCreated, h)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+//HandleAPIHabit handler that serves /api/habits/{name}. GET returns the habit, PUT replaces it with the JSON encoded
+//habit in the request body and DELETE deletes it. POST to /api/habits/{name}/checkins checks in the habit with the
+//optional JSON encoded check-in in the request body, which may backfill its Time and, like hooks, deduplicate retries
+//by Key. POST to /api/habits/{name}/pause pauses the habit from and until the optional JSON encoded Pause in the
+//request body, and POST to /api/habits/{name}/resume resumes it.
+func (server *server) HandleAPIHabit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := server.requestUser(r)
+		name, action, ok := parseHabitPath(r.URL)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		switch action {
+		case "checkins":
+			server.handleAPICheckIn(w, r, user, name)
+			return
+		case "pause":
+			server.handleAPIPause(w, r, user, name)
+			return
+		case "resume":
+			server.handleAPIResume(w, r, user, name)
+			return
+		case "":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if name == "" {
+			http.Error(w, "missing habit name", http.StatusBadRequest)
+			return
+		}
+		existing, err := server.controller.Store.Get(user, name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if existing == nil {
+			http.Error(w, "habit not found", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, existing)
+		case http.MethodPut:
+			h := Habit{}
+			err := json.NewDecoder(r.Body).Decode(&h)
+			if err != nil {
+				http.Error(w, "cannot parse habit", http.StatusBadRequest)
+				return
+			}
+			h.User = user
+			h.Name = name
+			err = h.validateStored()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			err = server.controller.Store.Update(&h)
+			if errors.Is(err, ErrHabitNotFound) {
+				http.Error(w, "habit not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, h)
+		case http.MethodDelete:
+			err = server.controller.DeleteHabit(user, name)
+			if errors.Is(err, ErrHabitNotFound) {
+				http.Error(w, "habit not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+//parseHabitPath splits the path of a request to /api/habits/{name}[/{action}] into the unescaped habit name and
+//action, so that names containing a slash escaped as %2F are kept whole. It returns false for other paths.
+func parseHabitPath(u *url.URL) (name, action string, ok bool) {
+	path := strings.TrimPrefix(u.EscapedPath(), "/api/habits")
+	if path == "" {
+		return "", "", true
+	}
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(segments) > 2 || path[0] != '/' {
+		return "", "", false
+	}
+	name, err := url.PathUnescape(segments[0])
+	if err != nil {
+		return "", "", false
+	}
+	if len(segments) == 2 {
+		action = segments[1]
+	}
+	return name, action, true
+}
+
+func (server *server) handleAPICheckIn(w http.ResponseWriter, r *http.Request, user, name string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	checkIn := CheckIn{}
+	err := json.NewDecoder(r.Body).Decode(&checkIn)
+	if err != nil && err != io.EOF {
+		http.Error(w, "cannot parse check-in", http.StatusBadRequest)
+		return
+	}
+	//check-ins are serialized like hook check-ins so that concurrent retries cannot both record the same key
+	server.hooks.Lock()
+	defer server.hooks.Unlock()
+	if !server.requireHabit(w, user, name) {
+		return
+	}
+	h, err := server.controller.CheckIn(user, name, checkIn)
+	if errors.Is(err, ErrDuplicateCheckIn) {
+		h, err = server.controller.Store.Get(user, name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(ReplayedHeader, "true")
+		writeJSON(w, http.StatusOK, h)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, h)
+}
+
+func (server *server) handleAPIPause(w http.ResponseWriter, r *http.Request, user, name string) {
+	pause, ok := decodeAPIPause(w, r)
+	if !ok {
+		return
+	}
+	if !server.requireHabit(w, user, name) {
+		return
+	}
+	h, err := server.controller.Pause(user, name, pause.From, pause.Until)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, h)
+}
+
+func (server *server) handleAPIResume(w http.ResponseWriter, r *http.Request, user, name string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !server.requireHabit(w, user, name) {
+		return
+	}
+	h, err := server.controller.Resume(user, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, h)
+}
+
+//HandleAPIDue handler that serves /api/due. GET returns the due status of the user's habits, the most urgent first.
+func (server *server) HandleAPIDue() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		due := server.controller.DueHabits(server.requestUser(r))
+		if due == nil {
+			due = []HabitDue{}
+		}
+		writeJSON(w, http.StatusOK, due)
+	}
+}
+
+//HandleAPIPauseAll handler that serves /api/pause. POST pauses all the user's habits from and until the optional JSON
+//encoded Pause in the request body, and returns the paused habits.
+func (server *server) HandleAPIPauseAll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pause, ok := decodeAPIPause(w, r)
+		if !ok {
+			return
+		}
+		paused, err := server.controller.PauseAll(server.requestUser(r), pause.From, pause.Until)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, nonNilHabits(paused))
+	}
+}
+
+//HandleAPIResumeAll handler that serves /api/resume. POST resumes all the user's paused habits and returns them.
+func (server *server) HandleAPIResumeAll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		resumed, err := server.controller.ResumeAll(server.requestUser(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, nonNilHabits(resumed))
+	}
+}
+
+//decodeAPIPause decodes the optional Pause in the body of a POST request, writing an error response if it fails
+func decodeAPIPause(w http.ResponseWriter, r *http.Request) (Pause, bool) {
+	pause := Pause{}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return pause, false
+	}
+	err := json.NewDecoder(r.Body).Decode(&pause)
+	if err != nil && err != io.EOF {
+		http.Error(w, "cannot parse pause", http.StatusBadRequest)
+		return pause, false
+	}
+	return pause, true
+}
+
+//requireHabit reports whether the user's habit exists, writing an error response suggesting close names if it does
+//not
+func (server *server) requireHabit(w http.ResponseWriter, user, name string) bool {
+	existing, err := server.controller.Store.Get(user, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if existing == nil {
+		message := "habit not found"
+		suggestions, err := server.controller.SuggestHabits(user, name)
+		if err == nil && len(suggestions) > 0 {
+			message += ", " + didYouMean(suggestions)
+		}
+		http.Error(w, message, http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+//allowNewName reports whether the habit exists or its name is not a likely typo of an existing habit, writing a not
+//found response with the close names if it is
+func (server *server) allowNewName(w http.ResponseWriter, user, name string) bool {
+	existing, err := server.controller.Store.Get(user, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if existing != nil {
+		return true
+	}
+	suggestions, err := server.controller.SuggestHabits(user, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if len(suggestions) > 0 {
+		http.Error(w, fmt.Sprintf("habit '%s' not found, %s Pass create=true to create it", name,
+			didYouMean(suggestions)), http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+//nonNilHabits makes empty lists of habits encode as [] rather than null
+func nonNilHabits(habits []*Habit) []*Habit {
+	if habits == nil {
+		return []*Habit{}
+	}
+	return habits
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -1,6 +1,7 @@
 package habit_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/crmejia/habit"
 	"github.com/phayes/freeport"
@@ -9,6 +10,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 const (
@@ -19,7 +21,7 @@ func TestNewHttpServer(t *testing.T) {
 	t.Parallel()
 
 	store := habit.OpenMemoryStore()
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -36,7 +38,7 @@ func TestNewHttpServer(t *testing.T) {
 func TestNewServerWithNonDefaultAddress(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -55,7 +57,7 @@ func TestNewServerWithNonDefaultAddress(t *testing.T) {
 func TestNewServerReturnsErrorOnEmptyAddress(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -79,10 +81,10 @@ func TestHabitHandlerReturnsHabit(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/?habit=piano", nil)
 
 	store := habit.OpenMemoryStore()
-	store.Habits["piano"] = &habit.Habit{
-		Name: "piano",
+	store.Habits[habit.DefaultUser()] = map[string]*habit.Habit{
+		"piano": {Name: "piano", User: habit.DefaultUser()},
 	}
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -113,7 +115,7 @@ func TestHandleIndexWithGibberishReturns400(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/?garbage", nil)
 
 	store := habit.OpenMemoryStore()
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -139,7 +141,7 @@ func TestHandleIndexWithGibberishReturns400(t *testing.T) {
 func TestServer_HabitHandleFrequency(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -176,11 +178,13 @@ func TestHandleAllReturnsAllHabits(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/all", nil)
 
 	store := habit.OpenMemoryStore()
-	store.Habits = map[string]*habit.Habit{
-		"piano":   {Name: "piano"},
-		"reading": {Name: "reading"},
+	store.Habits = map[string]map[string]*habit.Habit{
+		habit.DefaultUser(): {
+			"piano":   {Name: "piano", User: habit.DefaultUser()},
+			"reading": {Name: "reading", User: habit.DefaultUser()},
+		},
 	}
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -208,11 +212,13 @@ func TestHandleAllReturnsAllHabits(t *testing.T) {
 func TestRouting(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
-	store.Habits = map[string]*habit.Habit{
-		"piano":   {Name: "piano"},
-		"reading": {Name: "reading"},
+	store.Habits = map[string]map[string]*habit.Habit{
+		habit.DefaultUser(): {
+			"piano":   {Name: "piano", User: habit.DefaultUser()},
+			"reading": {Name: "reading", User: habit.DefaultUser()},
+		},
 	}
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -254,7 +260,7 @@ func TestRouting(t *testing.T) {
 func TestServer_RunReturnsBadRequest(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -290,7 +296,7 @@ func TestServer_RunReturnsBadRequest(t *testing.T) {
 func TestServer_RunReturnsHabit(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -322,3 +328,417 @@ func TestServer_RunReturnsHabit(t *testing.T) {
 		t.Errorf("want response body to be:\n %s \ngot:\n %s", want, got)
 	}
 }
+
+func TestServer_RoutesHabitPathsBySegment(t *testing.T) {
+	t.Parallel()
+	store := habit.OpenMemoryStore()
+	store.Habits["alice"] = map[string]*habit.Habit{
+		"practice/checkins": {Name: "practice/checkins", User: "alice", Frequency: habit.DailyInterval},
+		"practice":          {Name: "practice", User: "alice", Frequency: habit.DailyInterval},
+	}
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := habit.NewServer(&controller, localHostAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.DefaultUser = "alice"
+	handler := server.Routes()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/habits/practice%2Fcheckins", nil))
+	h := habit.Habit{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &h)
+	if recorder.Code != http.StatusOK || err != nil || h.Name != "practice/checkins" {
+		t.Errorf("want escaped slash to stay in the habit name, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/habits/practice%2Fcheckins/checkins",
+		strings.NewReader(`{}`)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	checkedIn, err := store.Get("alice", "practice/checkins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	practice, err := store.Get("alice", "practice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkedIn.CheckIns) != 1 || len(practice.CheckIns) != 0 {
+		t.Errorf("want only 'practice/checkins' to be checked in, got %d and %d check-ins",
+			len(checkedIn.CheckIns), len(practice.CheckIns))
+	}
+
+	for _, path := range []string{"/api/habits/practice/stats", "/api/habits/practice/checkins/extra"} {
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("%s: want status %d, got %d", path, http.StatusNotFound, recorder.Code)
+		}
+	}
+}
+
+func TestServer_LogsAmounts(t *testing.T) {
+	t.Parallel()
+	store := habit.OpenMemoryStore()
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := habit.NewServer(&controller, localHostAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.DefaultUser = "alice"
+	handler := server.Routes()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/?habit=water&target=8&unit=glasses&amount=3",
+		nil))
+	if !strings.Contains(recorder.Body.String(), "You've logged 3 of 8 glasses") {
+		t.Errorf("want amount in the querystring to be logged, got:\n%s", recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/habits/water/checkins",
+		strings.NewReader(`{"Amount":5,"Note":"with lemon","Rating":3}`)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	h := habit.Habit{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Streak != 1 || h.MessageKind != habit.StreakMessage || len(h.CheckIns) != 2 || h.CheckIns[1].Amount != 5 {
+		t.Errorf("want API check-in to reach the target, got %+v", h)
+	}
+	if len(h.CheckIns) == 2 && (h.CheckIns[1].Note != "with lemon" || h.CheckIns[1].Rating != 3) {
+		t.Errorf("want API check-in to record its note and rating, got %+v", h.CheckIns[1])
+	}
+
+	testCases := []struct {
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{http.MethodPost, "/api/habits/surfing/checkins", "", http.StatusNotFound},
+		{http.MethodGet, "/api/habits/water/checkins", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/habits/water/checkins", "{", http.StatusBadRequest},
+		{http.MethodPost, "/api/habits/water/checkins", `{"Amount":-1}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/habits/water/checkins", `{"Rating":10}`, http.StatusBadRequest},
+		{http.MethodGet, "/?habit=water&amount=lots", "", http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+		if recorder.Code != tc.wantStatus {
+			t.Errorf("%s %s: want status %d, got %d", tc.method, tc.path, tc.wantStatus, recorder.Code)
+		}
+	}
+}
+
+func TestServer_APICheckInBackfillsAndDeduplicates(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	created := time.Date(now.Year(), now.Month(), now.Day()-3, 9, 0, 0, 0, time.Local)
+	store := &habit.MemoryStore{Habits: map[string]map[string]*habit.Habit{"alice": {
+		"piano": {Name: "piano", User: "alice", Frequency: habit.DailyInterval, CreatedAt: created,
+			LastCheckIn: created, DueDate: created.Add(habit.DailyInterval)},
+	}}}
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := habit.NewServer(&controller, localHostAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.DefaultUser = "alice"
+	handler := server.Routes()
+
+	body := fmt.Sprintf(`{"Time":%q,"Key":"retry-1"}`, created.AddDate(0, 0, 1).Format(time.RFC3339))
+	for i, wantReplayed := range []string{"", "true"} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/habits/piano/checkins",
+			strings.NewReader(body)))
+		h := habit.Habit{}
+		err = json.Unmarshal(recorder.Body.Bytes(), &h)
+		if err != nil {
+			t.Fatalf("attempt %d: %v: %s", i, err, recorder.Body.String())
+		}
+		if recorder.Header().Get(habit.ReplayedHeader) != wantReplayed || len(h.CheckIns) != 1 ||
+			!h.CheckIns[0].Time.Equal(created.AddDate(0, 0, 1)) || h.CheckIns[0].Key != "retry-1" {
+			t.Errorf("attempt %d: want one backfilled check-in, replayed %q, got replayed %q and %+v", i,
+				wantReplayed, recorder.Header().Get(habit.ReplayedHeader), h.CheckIns)
+		}
+	}
+}
+
+func TestServer_FiltersHabitsByTag(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(habit.OpenMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"piano", "surfing"} {
+		_, err = controller.Handle(&habit.Habit{Name: name, User: "alice", Frequency: habit.DailyInterval})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = controller.AddTags("alice", "surfing", "health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := habit.NewServer(&controller, localHostAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.DefaultUser = "alice"
+	handler := server.Routes()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/all?tag=health", nil))
+	if !strings.Contains(recorder.Body.String(), "surfing") || strings.Contains(recorder.Body.String(), "piano") {
+		t.Errorf("want only surfing to be listed, got:\n%s", recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/habits?tag=health", nil))
+	var habits []habit.Habit
+	err = json.Unmarshal(recorder.Body.Bytes(), &habits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(habits) != 1 || habits[0].Name != "surfing" || len(habits[0].Tags) != 1 {
+		t.Errorf("want only surfing to be listed with its tags, got %+v", habits)
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/habits?tag=music", nil))
+	if strings.TrimSpace(recorder.Body.String()) != "[]" {
+		t.Errorf("want an empty list, got %s", recorder.Body.String())
+	}
+}
+
+func TestServer_SortsAndPagesHabits(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(habit.OpenMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"surfing", "piano", "reading"} {
+		_, err = controller.Handle(&habit.Habit{Name: name, User: "alice", Frequency: habit.DailyInterval})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	server, err := habit.NewServer(&controller, localHostAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.DefaultUser = "alice"
+	handler := server.Routes()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/habits?sort=name&desc=true&limit=2", nil))
+	var habits []habit.Habit
+	err = json.Unmarshal(recorder.Body.Bytes(), &habits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(habits) != 2 || habits[0].Name != "surfing" || habits[1].Name != "reading" {
+		t.Errorf("want the first page in descending order, got %+v", habits)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/all?offset=1&limit=1", nil))
+	if !strings.Contains(recorder.Body.String(), "reading") || strings.Contains(recorder.Body.String(), "piano") {
+		t.Errorf("want the second habit to be listed, got:\n%s", recorder.Body.String())
+	}
+
+	for _, path := range []string{"/api/habits?sort=size", "/api/habits?limit=ten", "/all?status=late",
+		"/all?desc=maybe", "/api/habits?offset=-1"} {
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: want status %d, got %d", path, http.StatusBadRequest, recorder.Code)
+		}
+	}
+}
+
+func TestServer_PausesAndResumesHabits(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(habit.OpenMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"piano", "surfing"} {
+		_, err = controller.Handle(&habit.Habit{Name: name, User: "alice", Frequency: habit.DailyInterval})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	server, err := habit.NewServer(&controller, localHostAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.DefaultUser = "alice"
+	handler := server.Routes()
+
+	until := time.Now().Add(3 * habit.DailyInterval).Round(time.Second)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/habits/piano/pause",
+		strings.NewReader(`{"Until":"`+until.Format(time.RFC3339)+`"}`)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	h := habit.Habit{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Pauses) != 1 || !h.Pauses[0].Until.Equal(until) {
+		t.Errorf("want piano to be paused until %s, got %+v", until, h.Pauses)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/pause", nil))
+	var paused []habit.Habit
+	err = json.Unmarshal(recorder.Body.Bytes(), &paused)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paused) != 1 || paused[0].Name != "surfing" {
+		t.Errorf("want surfing to be paused, got %+v", paused)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/habits/piano/resume", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/resume", nil))
+	var resumed []habit.Habit
+	err = json.Unmarshal(recorder.Body.Bytes(), &resumed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resumed) != 1 || resumed[0].Name != "surfing" {
+		t.Errorf("want surfing to be resumed, got %+v", resumed)
+	}
+
+	testCases := []struct {
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{http.MethodPost, "/api/habits/reading/pause", "", http.StatusNotFound},
+		{http.MethodPost, "/api/habits/reading/resume", "", http.StatusNotFound},
+		{http.MethodGet, "/api/habits/piano/pause", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/habits/piano/pause", "{", http.StatusBadRequest},
+		{http.MethodPost, "/api/habits/piano/resume", "", http.StatusBadRequest},
+		{http.MethodGet, "/api/pause", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/resume", "", http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+		if recorder.Code != tc.wantStatus {
+			t.Errorf("%s %s: want status %d, got %d", tc.method, tc.path, tc.wantStatus, recorder.Code)
+		}
+	}
+}
+
+func TestServer_ListsDueHabits(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(habit.OpenMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := habit.NewServer(&controller, localHostAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.DefaultUser = "alice"
+	handler := server.Routes()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/due", nil))
+	if recorder.Body.String() != "[]\n" {
+		t.Errorf("want an empty list, got %s", recorder.Body.String())
+	}
+
+	_, err = controller.Handle(&habit.Habit{Name: "piano", User: "alice", Frequency: habit.DailyInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/due", nil))
+	var due []habit.HabitDue
+	err = json.Unmarshal(recorder.Body.Bytes(), &due)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].Name != "piano" || due[0].Status != habit.DoneStatus {
+		t.Errorf("want piano to be done, got %+v", due)
+	}
+	if !strings.Contains(recorder.Body.String(), `"Status":"done"`) {
+		t.Errorf("want status to be encoded by name, got %s", recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/due", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("want status %d, got %d", http.StatusMethodNotAllowed, recorder.Code)
+	}
+}
+
+func TestHandleIndexRefusesLikelyTypos(t *testing.T) {
+	t.Parallel()
+	store := habit.OpenMemoryStore()
+	store.Habits[habit.DefaultUser()] = map[string]*habit.Habit{
+		"piano": {Name: "piano", User: habit.DefaultUser(), Frequency: habit.DailyInterval},
+	}
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := habit.NewServer(&controller, localHostAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		target     string
+		wantStatus int
+		want       string
+	}{
+		{"/?habit=pian", http.StatusNotFound, "habit 'pian' not found, did you mean 'piano'? Pass create=true"},
+		{"/?habit=pian&create=maybe", http.StatusBadRequest, "invalid create"},
+		{"/?habit=pian&create=true", http.StatusOK, "'pian'"},
+		{"/?habit=surfing", http.StatusOK, "'surfing'"},
+	}
+	for _, tc := range testCases {
+		recorder := httptest.NewRecorder()
+		server.HandleIndex()(recorder, httptest.NewRequest(http.MethodGet, tc.target, nil))
+		if recorder.Code != tc.wantStatus || !strings.Contains(recorder.Body.String(), tc.want) {
+			t.Errorf("%s: want %d %q, got %d %q", tc.target, tc.wantStatus, tc.want, recorder.Code,
+				recorder.Body.String())
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	server.Routes().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/habits/surfng/checkins", nil))
+	if recorder.Code != http.StatusNotFound || !strings.Contains(recorder.Body.String(), "did you mean 'surfing'?") {
+		t.Errorf("want API check-ins of unknown habits to suggest close names, got %d %q", recorder.Code,
+			recorder.Body.String())
+	}
+}
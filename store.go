@@ -4,49 +4,124 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	//SQLite driver package
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"io/ioutil"
 	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
 //Habit a type representing a habit
 type Habit struct {
 	Name      string
+	User      string
 	Streak    int
 	DueDate   time.Time
 	Frequency time.Duration
-	Message   string
+	//Kind tells whether the habit is built up by checking in or quit by not checking in
+	Kind HabitKind
+	//Unit and Target make a habit quantitative: a period only counts toward the streak once the amounts checked in
+	//reach Target. Progress is the amount checked in so far toward the period due on DueDate.
+	Unit     string
+	Target   float64
+	Progress float64
+	//GraceDays is how many days late a check-in can be, once a week, without losing the streak. GraceUsedAt is when the
+	//grace period was last used.
+	GraceDays   int
+	GraceUsedAt time.Time
+	//Freezes are earned by keeping up the streak and are used up to cover missed periods
+	Freezes int
+	Message string
+	//MessageKind and LastCheckIn record the result of the last time the habit was logged
+	MessageKind MessageKind
+	LastCheckIn time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	CheckIns    []CheckIn
+	Pauses      []Pause
+	//Tags group habits, they are kept sorted
+	Tags []string
+	//Description tells what the habit is about
+	Description string
+	//DueOnCreation tells that the habit was due on the day it started, as habits created with Controller.Create are.
+	//Habits created by Handle count their creation as done without extending the streak and are first due a period
+	//later.
+	DueOnCreation bool
 }
 
-//Store is an interface that captures the behavior of a Store
+//CheckIn records a single time a habit was logged after its creation. The check-ins of quantitative habits also
+//include their creation, as it can already log an amount.
+type CheckIn struct {
+	Time time.Time
+	//Amount is the quantity logged, it is only used by quantitative habits
+	Amount float64
+	//Key identifies a check-in sent by a client which may retry it, a habit only records a key once
+	Key string
+	//Note is free text about the check-in, such as what was practiced
+	Note string
+	//Rating is how the check-in went from 1 to 5, 0 when it was not rated
+	Rating int
+}
+
+//Pause is a period during which missed check-ins do not break the streak. A zero Until means the habit stays paused
+//until it is resumed.
+type Pause struct {
+	From  time.Time
+	Until time.Time
+}
+
+//copyHabit returns a copy of h that shares none of its slices
+func copyHabit(h *Habit) *Habit {
+	c := *h
+	c.CheckIns = append([]CheckIn(nil), h.CheckIns...)
+	c.Pauses = append([]Pause(nil), h.Pauses...)
+	c.Tags = append([]string(nil), h.Tags...)
+	return &c
+}
+
+//Store is an interface that captures the behavior of a Store. Habits are namespaced by user, so a habit is identified
+//by its User and Name.
 type Store interface {
-	Get(name string) (*Habit, error)
+	Get(user, name string) (*Habit, error)
 	Create(habit *Habit) error
 	Update(habit *Habit) error
-	GetAllHabits() []*Habit
+	GetAllHabits(user string) []*Habit
+	//ListHabits returns the user's habits selected, ordered and paged by the query
+	ListHabits(query HabitQuery) ([]*Habit, error)
+	//Delete removes the user's habit and its history. It returns ErrHabitNotFound if the habit does not exist.
+	Delete(user, name string) error
 }
 
-//MemoryStore is a type representing an in-memory store
+//MemoryStore is a type representing an in-memory store. Habits are keyed by user and then by name. It is safe for
+//concurrent use through its methods, which store and return copies of the habits.
 type MemoryStore struct {
-	Habits map[string]*Habit
+	Habits map[string]map[string]*Habit
+	Tokens map[string]*Token
+	mu     sync.RWMutex
 }
 
-//OpenMemoryStore returns a new MemoryStore. Note that other types returns the interface Store
-func OpenMemoryStore() MemoryStore {
+//OpenMemoryStore returns a pointer to a new MemoryStore. Note that other types returns the interface Store
+func OpenMemoryStore() *MemoryStore {
 	//here a file store or a db store would get the data from persistence.
 	memoryStore := MemoryStore{
-		Habits: map[string]*Habit{},
+		Habits: map[string]map[string]*Habit{},
+		Tokens: map[string]*Token{},
 	}
-	return memoryStore
+	return &memoryStore
 }
 
-//Get searches Store by name and returns the habit if it exists
-func (s *MemoryStore) Get(name string) (*Habit, error) {
-	habit, ok := s.Habits[name]
+//Get searches Store by user and name and returns the habit if it exists
+func (s *MemoryStore) Get(user, name string) (*Habit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	habit, ok := s.Habits[user][name]
 	if ok {
-		return habit, nil
+		return copyHabit(habit), nil
 	}
 	return nil, nil
 }
@@ -57,10 +132,18 @@ func (s *MemoryStore) Create(habit *Habit) error {
 		return ErrNilHabit
 	}
 
-	if _, ok := s.Habits[habit.Name]; ok {
-		return errors.New("habit already exists")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Habits[habit.User][habit.Name]; ok {
+		return ErrHabitExists
 	}
-	s.Habits[habit.Name] = habit
+	if s.Habits == nil {
+		s.Habits = map[string]map[string]*Habit{}
+	}
+	if s.Habits[habit.User] == nil {
+		s.Habits[habit.User] = map[string]*Habit{}
+	}
+	s.Habits[habit.User][habit.Name] = copyHabit(habit)
 	return nil
 }
 
@@ -70,30 +153,89 @@ func (s *MemoryStore) Update(habit *Habit) error {
 		return ErrNilHabit
 	}
 
-	if _, ok := s.Habits[habit.Name]; !ok {
-		return errors.New("cannot update habit does not exists")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Habits[habit.User][habit.Name]; !ok {
+		return ErrHabitNotFound
 	}
 
-	s.Habits[habit.Name] = habit
+	s.Habits[habit.User][habit.Name] = copyHabit(habit)
+	return nil
+}
+
+//Delete removes the user's habit. It returns an error if the habit does not exist
+func (s *MemoryStore) Delete(user, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Habits[user][name]; !ok {
+		return ErrHabitNotFound
+	}
+	delete(s.Habits[user], name)
 	return nil
 }
 
-//GetAllHabits returns a []*Habits of all the stored habits
-func (s MemoryStore) GetAllHabits() []*Habit {
-	allHabits := make([]*Habit, 0, len(s.Habits))
-	for _, h := range s.Habits {
-		allHabits = append(allHabits, h)
+//GetAllHabits returns a []*Habits of all the habits stored for user
+func (s *MemoryStore) GetAllHabits(user string) []*Habit {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	allHabits := make([]*Habit, 0, len(s.Habits[user]))
+	for _, h := range s.Habits[user] {
+		allHabits = append(allHabits, copyHabit(h))
 	}
 	return allHabits
 }
 
+//ListHabits returns the habits selected, ordered and paged by the query
+func (s *MemoryStore) ListHabits(query HabitQuery) ([]*Habit, error) {
+	err := query.validate()
+	if err != nil {
+		return nil, err
+	}
+	return query.Apply(s.GetAllHabits(query.User)), nil
+}
+
+//CreateToken inserts the given token into the store
+func (s *MemoryStore) CreateToken(token *Token) error {
+	if token == nil {
+		return errors.New("token cannot be nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Tokens == nil {
+		s.Tokens = map[string]*Token{}
+	}
+	s.Tokens[token.Hash] = token
+	return nil
+}
+
+//GetToken returns the token with the given hash if it exists
+func (s *MemoryStore) GetToken(hash string) (*Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Tokens[hash], nil
+}
+
+//ListTokens returns a []*Token of all the stored tokens
+func (s *MemoryStore) ListTokens() []*Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return listTokens(s.Tokens)
+}
+
+//RevokeToken deletes the token with the given id. It returns ErrTokenNotFound if the token does not exist
+func (s *MemoryStore) RevokeToken(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return revokeToken(s.Tokens, id)
+}
+
 //DBStore is a type that wraps a SQLite DB
 type DBStore struct {
 	db *sql.DB
 }
 
-//OpenDBStore opens a connection to the specified dbSource. It takes care of creating a habit table if it does not
-//exist.
+//OpenDBStore opens a connection to the specified dbSource. It takes care of creating the habit and token tables if
+//they do not exist and of migrating tables created by older versions.
 func OpenDBStore(dbSource string) (Store, error) {
 	if dbSource == "" {
 		return &DBStore{}, errors.New("empty dbSource string")
@@ -102,62 +244,205 @@ func OpenDBStore(dbSource string) (Store, error) {
 	if err != nil {
 		return &DBStore{}, err
 	}
+	//SQLite allows a single writer, sharing one connection serializes concurrent use instead of failing with
+	//"database is locked"
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec("PRAGMA busy_timeout = 5000")
+	if err != nil {
+		return &DBStore{}, err
+	}
+
+	err = migrateDB(db)
+	if err != nil {
+		return &DBStore{}, err
+	}
+	return &DBStore{db: db}, nil
+}
 
-	const createTable = `
+//dbMigrations are applied in order to bring a database up to date. The index of the last applied migration plus one
+//is kept in the database's user_version.
+var dbMigrations = []func(tx *sql.Tx) error{
+	func(tx *sql.Tx) error {
+		const createTables = `
 CREATE TABLE IF NOT EXISTS habit(
 id INTEGER NOT NULL PRIMARY KEY,
 name VARCHAR UNIQUE NOT NULL,
 streak INTEGER NOT NULL,
 frequency INTEGER NOT NULL,
-duedate TEXT NOT NULL );`
-	_, err = db.Exec(createTable, nil)
-
-	if err != nil {
-		return &DBStore{}, err
-	}
-	return &DBStore{db: db}, nil
+duedate TEXT NOT NULL );
+CREATE TABLE IF NOT EXISTS token(
+id VARCHAR NOT NULL PRIMARY KEY,
+name VARCHAR NOT NULL,
+hash VARCHAR UNIQUE NOT NULL,
+scope INTEGER NOT NULL,
+created TEXT NOT NULL );`
+		_, err := tx.Exec(createTables)
+		return err
+	},
+	func(tx *sql.Tx) error {
+		//habits and tokens created before users existed belong to the local user
+		const addUser = `
+ALTER TABLE habit RENAME TO habit_v1;
+CREATE TABLE habit(
+id INTEGER NOT NULL PRIMARY KEY,
+user VARCHAR NOT NULL,
+name VARCHAR NOT NULL,
+streak INTEGER NOT NULL,
+frequency INTEGER NOT NULL,
+duedate TEXT NOT NULL,
+UNIQUE(user, name) );
+ALTER TABLE token ADD COLUMN user VARCHAR NOT NULL DEFAULT '';`
+		_, err := tx.Exec(addUser)
+		if err != nil {
+			return err
+		}
+		const copyHabits = `
+INSERT INTO habit(id,user,name,streak,frequency,duedate)
+SELECT id, ?, name, streak, frequency, duedate FROM habit_v1`
+		_, err = tx.Exec(copyHabits, DefaultUser())
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE token SET user = ?", DefaultUser())
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DROP TABLE habit_v1")
+		return err
+	},
+	func(tx *sql.Tx) error {
+		const addHistory = `
+ALTER TABLE habit ADD COLUMN created_at TEXT NOT NULL DEFAULT '0001-01-01 00:00:00+00:00';
+ALTER TABLE habit ADD COLUMN updated_at TEXT NOT NULL DEFAULT '0001-01-01 00:00:00+00:00';
+CREATE TABLE checkin(
+id INTEGER NOT NULL PRIMARY KEY,
+habit_id INTEGER NOT NULL REFERENCES habit(id),
+time TEXT NOT NULL );
+CREATE INDEX checkin_habit_id ON checkin(habit_id);`
+		_, err := tx.Exec(addHistory)
+		return err
+	},
+	func(tx *sql.Tx) error {
+		const addLastResult = `
+ALTER TABLE habit ADD COLUMN message TEXT NOT NULL DEFAULT '';
+ALTER TABLE habit ADD COLUMN message_kind INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE habit ADD COLUMN last_checkin TEXT NOT NULL DEFAULT '0001-01-01 00:00:00+00:00';`
+		_, err := tx.Exec(addLastResult)
+		return err
+	},
+	func(tx *sql.Tx) error {
+		const addTargets = `
+ALTER TABLE habit ADD COLUMN unit TEXT NOT NULL DEFAULT '';
+ALTER TABLE habit ADD COLUMN target REAL NOT NULL DEFAULT 0;
+ALTER TABLE habit ADD COLUMN progress REAL NOT NULL DEFAULT 0;
+ALTER TABLE checkin ADD COLUMN amount REAL NOT NULL DEFAULT 0;`
+		_, err := tx.Exec(addTargets)
+		return err
+	},
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec("ALTER TABLE habit ADD COLUMN kind INTEGER NOT NULL DEFAULT 0")
+		return err
+	},
+	func(tx *sql.Tx) error {
+		const addFreezes = `
+ALTER TABLE habit ADD COLUMN grace_days INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE habit ADD COLUMN grace_used_at TEXT NOT NULL DEFAULT '0001-01-01 00:00:00+00:00';
+ALTER TABLE habit ADD COLUMN freezes INTEGER NOT NULL DEFAULT 0;`
+		_, err := tx.Exec(addFreezes)
+		return err
+	},
+	func(tx *sql.Tx) error {
+		const addPauses = `
+CREATE TABLE pause(
+id INTEGER NOT NULL PRIMARY KEY,
+habit_id INTEGER NOT NULL REFERENCES habit(id),
+from_time TEXT NOT NULL,
+until_time TEXT NOT NULL );
+CREATE INDEX pause_habit_id ON pause(habit_id);`
+		_, err := tx.Exec(addPauses)
+		return err
+	},
+	func(tx *sql.Tx) error {
+		const addCheckInKey = `
+ALTER TABLE checkin ADD COLUMN key TEXT NOT NULL DEFAULT '';`
+		_, err := tx.Exec(addCheckInKey)
+		return err
+	},
+	func(tx *sql.Tx) error {
+		const addCheckInNotes = `
+ALTER TABLE checkin ADD COLUMN note TEXT NOT NULL DEFAULT '';
+ALTER TABLE checkin ADD COLUMN rating INTEGER NOT NULL DEFAULT 0;`
+		_, err := tx.Exec(addCheckInNotes)
+		return err
+	},
+	func(tx *sql.Tx) error {
+		const addTags = `
+CREATE TABLE tag(
+id INTEGER NOT NULL PRIMARY KEY,
+name TEXT UNIQUE NOT NULL );
+CREATE TABLE habit_tag(
+habit_id INTEGER NOT NULL REFERENCES habit(id),
+tag_id INTEGER NOT NULL REFERENCES tag(id),
+PRIMARY KEY(habit_id, tag_id) );
+CREATE INDEX habit_tag_tag_id ON habit_tag(tag_id);`
+		_, err := tx.Exec(addTags)
+		return err
+	},
+	func(tx *sql.Tx) error {
+		const addCreationOptions = `
+ALTER TABLE habit ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE habit ADD COLUMN due_on_creation INTEGER NOT NULL DEFAULT 0;`
+		_, err := tx.Exec(addCreationOptions)
+		return err
+	},
 }
 
-//Get queries DBStore by name and returns the habit if it exists
-func (s *DBStore) Get(name string) (*Habit, error) {
-	const getHabit = `
-SELECT name, streak, frequency, duedate FROM habit WHERE name = ?
-`
-	rows, err := s.db.Query(getHabit, name)
+func migrateDB(db *sql.DB) error {
+	var version int
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	h := Habit{}
 
-	for rows.Next() {
-		var (
-			hname         string
-			streak        int
-			frequency     int64
-			duedateString string
-		)
-		err = rows.Scan(&hname, &streak, &frequency, &duedateString)
+	for ; version < len(dbMigrations); version++ {
+		tx, err := db.Begin()
 		if err != nil {
-			return nil, err
+			return err
 		}
-		h.Name = hname
-		h.Streak = streak
-		h.Frequency = time.Duration(frequency)
-		dueDate, err := time.Parse("2006-01-02 15:04:05-07:00", duedateString)
+		err = dbMigrations[version](tx)
 		if err != nil {
-			return nil, err
+			tx.Rollback()
+			return err
+		}
+		_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
 		}
-		h.DueDate = dueDate
 	}
+	return nil
+}
 
-	if err = rows.Err(); err != nil {
+//Get queries DBStore by user and name and returns the habit if it exists
+func (s *DBStore) Get(user, name string) (*Habit, error) {
+	const getHabit = `
+SELECT id, user, name, streak, frequency, duedate, kind, unit, target, progress, grace_days, grace_used_at, freezes,
+message, message_kind, last_checkin, created_at, updated_at, description, due_on_creation FROM habit
+WHERE user = ? AND name = ?
+`
+	habits, err := s.queryHabits(getHabit, user, name)
+	if err != nil {
 		return nil, err
 	}
 
-	if h.Name == "" {
+	if len(habits) == 0 {
 		return nil, nil
 	}
-	return &h, nil
+	return habits[0], nil
 }
 
 //Create inserts the given habit into the store. It returns an error if the habit already exists
@@ -166,88 +451,563 @@ func (s *DBStore) Create(h *Habit) error {
 		return ErrNilHabit
 	}
 	const insertHabit = `
-INSERT INTO habit(name,streak,frequency,duedate) VALUES(?,?,?,?)
+INSERT INTO habit(user,name,streak,frequency,duedate,kind,unit,target,progress,grace_days,grace_used_at,freezes,message,
+message_kind,last_checkin,created_at,updated_at,description,due_on_creation)
+VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
 `
-	stmt, err := s.db.Prepare(insertHabit)
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(h.Name, h.Streak, int64(h.Frequency), h.DueDate)
+	result, err := tx.Exec(insertHabit, h.User, h.Name, h.Streak, int64(h.Frequency), h.DueDate, int(h.Kind), h.Unit,
+		h.Target, h.Progress, h.GraceDays, h.GraceUsedAt, h.Freezes, h.Message, int(h.MessageKind), h.LastCheckIn,
+		h.CreatedAt, h.UpdatedAt, h.Description, h.DueOnCreation)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		tx.Rollback()
+		return ErrHabitExists
+	}
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
-	return nil
+	id, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = insertCheckIns(tx, id, h.CheckIns)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = insertPauses(tx, id, h.Pauses)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = insertTags(tx, id, h.Tags)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
-//Update updates the given habit. It returns an error if the habit does not exist
+//Update updates the given habit and replaces its check-in history. It returns an error if the habit does not exist
 func (s *DBStore) Update(h *Habit) error {
 	if h == nil {
 		return ErrNilHabit
 	}
 	const updateHabit = `
-UPDATE habit SET streak = ?, frequency = ?, duedate = ? WHERE NAME = ?
+UPDATE habit SET streak = ?, frequency = ?, duedate = ?, kind = ?, unit = ?, target = ?, progress = ?, grace_days = ?,
+grace_used_at = ?, freezes = ?, message = ?, message_kind = ?, last_checkin = ?, created_at = ?, updated_at = ?,
+description = ?, due_on_creation = ? WHERE user = ? AND name = ?
 `
-	stmt, err := s.db.Prepare(updateHabit)
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(h.Streak, int64(h.Frequency), h.DueDate, h.Name)
+	_, err = tx.Exec(updateHabit, h.Streak, int64(h.Frequency), h.DueDate, int(h.Kind), h.Unit, h.Target, h.Progress,
+		h.GraceDays, h.GraceUsedAt, h.Freezes, h.Message, int(h.MessageKind), h.LastCheckIn, h.CreatedAt, h.UpdatedAt,
+		h.Description, h.DueOnCreation, h.User, h.Name)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
-	return nil
+	var id int64
+	err = tx.QueryRow("SELECT id FROM habit WHERE user = ? AND name = ?", h.User, h.Name).Scan(&id)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return ErrHabitNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM checkin WHERE habit_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM pause WHERE habit_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM habit_tag WHERE habit_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = insertCheckIns(tx, id, h.CheckIns)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = insertPauses(tx, id, h.Pauses)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = insertTags(tx, id, h.Tags)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
-//GetAllHabits returns a []*Habits of all the stored habits
-func (s *DBStore) GetAllHabits() []*Habit {
+//Delete removes the user's habit with its check-ins, pauses and tags. It returns an error if the habit does not exist.
+func (s *DBStore) Delete(user, name string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	var id int64
+	err = tx.QueryRow("SELECT id FROM habit WHERE user = ? AND name = ?", user, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return ErrHabitNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, deleteRows := range []string{
+		"DELETE FROM checkin WHERE habit_id = ?",
+		"DELETE FROM pause WHERE habit_id = ?",
+		"DELETE FROM habit_tag WHERE habit_id = ?",
+		"DELETE FROM habit WHERE id = ?",
+	} {
+		_, err = tx.Exec(deleteRows, id)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
 
+//GetAllHabits returns a []*Habits of all the habits stored for user
+func (s *DBStore) GetAllHabits(user string) []*Habit {
 	const getAllHabits = `
-SELECT name, streak, frequency, duedate FROM habit
+SELECT id, user, name, streak, frequency, duedate, kind, unit, target, progress, grace_days, grace_used_at, freezes,
+message, message_kind, last_checkin, created_at, updated_at, description, due_on_creation FROM habit WHERE user = ?
 `
-	rows, err := s.db.Query(getAllHabits)
+	habits, err := s.queryHabits(getAllHabits, user)
 	if err != nil {
 		return nil
 	}
+	return habits
+}
+
+//ListHabits returns the habits selected, ordered and paged by the query. Tags and frequencies are filtered, sorted and
+//paged in SQL. Due statuses depend on the current time, when the query has one the habits are filtered and paged after
+//they are read.
+func (s *DBStore) ListHabits(query HabitQuery) ([]*Habit, error) {
+	err := query.validate()
+	if err != nil {
+		return nil, err
+	}
+	listHabits := `
+SELECT id, user, name, streak, frequency, duedate, kind, unit, target, progress, grace_days, grace_used_at, freezes,
+message, message_kind, last_checkin, created_at, updated_at, description, due_on_creation FROM habit WHERE user = ?`
+	args := []interface{}{query.User}
+	if query.Frequency != 0 {
+		listHabits += " AND frequency = ?"
+		args = append(args, int64(query.Frequency))
+	}
+	if query.Tag != "" {
+		listHabits += `
+AND id IN (SELECT habit_tag.habit_id FROM habit_tag JOIN tag ON tag.id = habit_tag.tag_id WHERE tag.name = ?)`
+		args = append(args, strings.ToLower(strings.TrimSpace(query.Tag)))
+	}
+	order := " ASC"
+	if query.Descending {
+		order = " DESC"
+	}
+	switch query.SortBy {
+	case SortByStreak:
+		listHabits += "\nORDER BY streak" + order + ", name"
+	case SortByDueDate:
+		//times keep their UTC offset, julianday compares them as instants
+		listHabits += "\nORDER BY julianday(duedate)" + order + ", name"
+	default:
+		listHabits += "\nORDER BY name" + order
+	}
+	if query.Status == 0 && (query.Limit > 0 || query.Offset > 0) {
+		limit := query.Limit
+		if limit == 0 {
+			limit = -1
+		}
+		listHabits += " LIMIT ? OFFSET ?"
+		args = append(args, limit, query.Offset)
+	}
+
+	habits, err := s.queryHabits(listHabits, args...)
+	if err != nil {
+		return nil, err
+	}
+	if query.Status == 0 {
+		return habits, nil
+	}
+	now := time.Now()
+	matching := habits[:0]
+	for _, h := range habits {
+		if query.hasStatus(h, now) {
+			matching = append(matching, h)
+		}
+	}
+	return query.page(matching), nil
+}
+
+func (s *DBStore) queryHabits(query string, args ...interface{}) ([]*Habit, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 	habits := make([]*Habit, 0)
+	ids := make([]int64, 0)
 
 	for rows.Next() {
 		var (
-			hname         string
-			streak        int
-			frequency     int64
-			duedateString string
+			h                 Habit
+			id                int64
+			frequency         int64
+			messageKind       int
+			kind              int
+			duedateString     string
+			graceUsedString   string
+			lastCheckInString string
+			createdString     string
+			updatedString     string
 		)
-		err = rows.Scan(&hname, &streak, &frequency, &duedateString)
+		err = rows.Scan(&id, &h.User, &h.Name, &h.Streak, &frequency, &duedateString, &kind, &h.Unit, &h.Target,
+			&h.Progress, &h.GraceDays, &graceUsedString, &h.Freezes, &h.Message, &messageKind, &lastCheckInString,
+			&createdString, &updatedString, &h.Description, &h.DueOnCreation)
 		if err != nil {
-			return nil
+			return nil, err
 		}
-		dueDate, err := time.Parse("2006-01-02 15:04:05-07:00", duedateString)
+		h.Frequency = time.Duration(frequency)
+		h.MessageKind = MessageKind(messageKind)
+		h.Kind = HabitKind(kind)
+		h.DueDate, err = time.Parse(dbTimeLayout, duedateString)
 		if err != nil {
-			return nil
+			return nil, err
+		}
+		h.GraceUsedAt, err = time.Parse(dbTimeLayout, graceUsedString)
+		if err != nil {
+			return nil, err
 		}
-		h := Habit{
-			Name:      hname,
-			Streak:    streak,
-			Frequency: time.Duration(frequency),
-			DueDate:   dueDate,
+		h.LastCheckIn, err = time.Parse(dbTimeLayout, lastCheckInString)
+		if err != nil {
+			return nil, err
+		}
+		h.CreatedAt, err = time.Parse(dbTimeLayout, createdString)
+		if err != nil {
+			return nil, err
+		}
+		h.UpdatedAt, err = time.Parse(dbTimeLayout, updatedString)
+		if err != nil {
+			return nil, err
 		}
 		habits = append(habits, &h)
+		ids = append(ids, id)
 	}
 
 	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	//the history of the habits is read with one query per table rather than per habit
+	checkIns, err := s.queryCheckIns(ids)
+	if err != nil {
+		return nil, err
+	}
+	pauses, err := s.queryPauses(ids)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := s.queryTags(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i, h := range habits {
+		h.CheckIns, h.Pauses, h.Tags = checkIns[ids[i]], pauses[ids[i]], tags[ids[i]]
+	}
+	return habits, nil
+}
+
+//maxBatchIDs is the number of habit ids queried at once, below SQLite's limit on the variables of a statement
+const maxBatchIDs = 500
+
+//queryBatches runs query for the habit ids in batches, replacing %s with the placeholders of a batch, and calls scan
+//for every row
+func (s *DBStore) queryBatches(query string, ids []int64, scan func(rows *sql.Rows) error) error {
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > maxBatchIDs {
+			n = maxBatchIDs
+		}
+		args := make([]interface{}, n)
+		for i, id := range ids[:n] {
+			args[i] = id
+		}
+		err := s.queryBatch(fmt.Sprintf(query, strings.TrimSuffix(strings.Repeat("?,", n), ",")), args, scan)
+		if err != nil {
+			return err
+		}
+		ids = ids[n:]
+	}
+	return nil
+}
+
+func (s *DBStore) queryBatch(query string, args []interface{}, scan func(rows *sql.Rows) error) error {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		err = scan(rows)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+//queryCheckIns returns the check-ins of the habits by habit id
+func (s *DBStore) queryCheckIns(habitIDs []int64) (map[int64][]CheckIn, error) {
+	const getCheckIns = `
+SELECT habit_id, time, amount, key, note, rating FROM checkin WHERE habit_id IN (%s) ORDER BY habit_id, id
+`
+	checkIns := make(map[int64][]CheckIn, len(habitIDs))
+	err := s.queryBatches(getCheckIns, habitIDs, func(rows *sql.Rows) error {
+		var (
+			habitID    int64
+			timeString string
+			c          CheckIn
+		)
+		err := rows.Scan(&habitID, &timeString, &c.Amount, &c.Key, &c.Note, &c.Rating)
+		if err != nil {
+			return err
+		}
+		c.Time, err = time.Parse(dbTimeLayout, timeString)
+		if err != nil {
+			return err
+		}
+		checkIns[habitID] = append(checkIns[habitID], c)
 		return nil
+	})
+	return checkIns, err
+}
+
+func insertCheckIns(tx *sql.Tx, habitID int64, checkIns []CheckIn) error {
+	for _, c := range checkIns {
+		_, err := tx.Exec("INSERT INTO checkin(habit_id,time,amount,key,note,rating) VALUES(?,?,?,?,?,?)", habitID,
+			c.Time, c.Amount, c.Key, c.Note, c.Rating)
+		if err != nil {
+			return err
+		}
 	}
-	return habits
+	return nil
+}
+
+//queryPauses returns the pauses of the habits by habit id
+func (s *DBStore) queryPauses(habitIDs []int64) (map[int64][]Pause, error) {
+	const getPauses = "SELECT habit_id, from_time, until_time FROM pause WHERE habit_id IN (%s) ORDER BY habit_id, id"
+	pauses := make(map[int64][]Pause, len(habitIDs))
+	err := s.queryBatches(getPauses, habitIDs, func(rows *sql.Rows) error {
+		var (
+			habitID     int64
+			fromString  string
+			untilString string
+			p           Pause
+		)
+		err := rows.Scan(&habitID, &fromString, &untilString)
+		if err != nil {
+			return err
+		}
+		p.From, err = time.Parse(dbTimeLayout, fromString)
+		if err != nil {
+			return err
+		}
+		p.Until, err = time.Parse(dbTimeLayout, untilString)
+		if err != nil {
+			return err
+		}
+		pauses[habitID] = append(pauses[habitID], p)
+		return nil
+	})
+	return pauses, err
+}
+
+func insertPauses(tx *sql.Tx, habitID int64, pauses []Pause) error {
+	for _, p := range pauses {
+		_, err := tx.Exec("INSERT INTO pause(habit_id,from_time,until_time) VALUES(?,?,?)", habitID, p.From, p.Until)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//queryTags returns the tags of the habits by habit id
+func (s *DBStore) queryTags(habitIDs []int64) (map[int64][]string, error) {
+	const getTags = `
+SELECT habit_tag.habit_id, tag.name FROM habit_tag JOIN tag ON tag.id = habit_tag.tag_id
+WHERE habit_tag.habit_id IN (%s) ORDER BY habit_tag.habit_id, tag.name
+`
+	tags := make(map[int64][]string, len(habitIDs))
+	err := s.queryBatches(getTags, habitIDs, func(rows *sql.Rows) error {
+		var (
+			habitID int64
+			tag     string
+		)
+		err := rows.Scan(&habitID, &tag)
+		if err != nil {
+			return err
+		}
+		tags[habitID] = append(tags[habitID], tag)
+		return nil
+	})
+	return tags, err
+}
+
+//insertTags links the habit to its tags, creating the tags that do not exist yet
+func insertTags(tx *sql.Tx, habitID int64, tags []string) error {
+	for _, tag := range tags {
+		_, err := tx.Exec("INSERT OR IGNORE INTO tag(name) VALUES(?)", tag)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT OR IGNORE INTO habit_tag(habit_id,tag_id) SELECT ?, id FROM tag WHERE name = ?",
+			habitID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//CreateToken inserts the given token into the store
+func (s *DBStore) CreateToken(token *Token) error {
+	if token == nil {
+		return errors.New("token cannot be nil")
+	}
+	const insertToken = `
+INSERT INTO token(id,user,name,hash,scope,created) VALUES(?,?,?,?,?,?)
+`
+	_, err := s.db.Exec(insertToken, token.ID, token.User, token.Name, token.Hash, int(token.Scope), token.Created)
+	return err
+}
+
+//GetToken queries DBStore by hash and returns the token if it exists
+func (s *DBStore) GetToken(hash string) (*Token, error) {
+	const getToken = `
+SELECT id, user, name, hash, scope, created FROM token WHERE hash = ?
+`
+	tokens, err := s.queryTokens(getToken, hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	return tokens[0], nil
 }
 
-//FileStore is a type that wraps a JSON encoded file store
+//ListTokens returns a []*Token of all the stored tokens
+func (s *DBStore) ListTokens() []*Token {
+	const listTokens = `
+SELECT id, user, name, hash, scope, created FROM token ORDER BY created
+`
+	tokens, err := s.queryTokens(listTokens)
+	if err != nil {
+		return nil
+	}
+	return tokens
+}
+
+//RevokeToken deletes the token with the given id. It returns ErrTokenNotFound if the token does not exist
+func (s *DBStore) RevokeToken(id string) error {
+	const deleteToken = `
+DELETE FROM token WHERE id = ?
+`
+	result, err := s.db.Exec(deleteToken, id)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+func (s *DBStore) queryTokens(query string, args ...interface{}) ([]*Token, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]*Token, 0)
+	for rows.Next() {
+		var (
+			token         Token
+			scope         int
+			createdString string
+		)
+		err = rows.Scan(&token.ID, &token.User, &token.Name, &token.Hash, &scope, &createdString)
+		if err != nil {
+			return nil, err
+		}
+		token.Scope = Scope(scope)
+		token.Created, err = time.Parse(dbTimeLayout, createdString)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &token)
+	}
+	return tokens, rows.Err()
+}
+
+//FileStore is a type that wraps a JSON encoded file store. It is safe for concurrent use, its methods store and
+//return copies of the habits.
 type FileStore struct {
 	filename string
-	habits   map[string]*Habit
+	habits   map[string]map[string]*Habit
+	tokens   map[string]*Token
+	mu       sync.RWMutex
+}
+
+//fileStoreData is the JSON document persisted by FileStore. Habits are keyed by user and then by name.
+type fileStoreData struct {
+	Version int
+	Habits  map[string]map[string]*Habit
+	Tokens  map[string]*Token
+}
+
+//fileStoreDataV1 is the document written before habits had users. Files written before tokens existed hold the
+//habits map at the top level and have no Version.
+type fileStoreDataV1 struct {
+	Version int
+	Habits  map[string]*Habit
+	Tokens  map[string]*Token
 }
 
-//OpenFileStore reads the specified file and decodes its content into an unexported map[string]*Habit. It takes care of
-//creating a new file if it does not exist.
+const fileStoreVersion = 2
+
+//OpenFileStore reads the specified file and decodes its content into an unexported map of habits by user. It takes
+//care of creating a new file if it does not exist and of upgrading files written by older versions.
 func OpenFileStore(filename string) (Store, error) {
 	file, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0600)
 	if err != nil {
@@ -259,26 +1019,67 @@ func OpenFileStore(filename string) (Store, error) {
 	if err != nil {
 		return &FileStore{}, err
 	}
-	habits := make(map[string]*Habit)
+	data := fileStoreData{}
 
 	if len(fileBytes) > 0 {
-		err = json.Unmarshal(fileBytes, &habits)
+		data, err = decodeFileStoreData(fileBytes)
 		if err != nil {
 			return &FileStore{}, err
 		}
 	}
+	if data.Habits == nil {
+		data.Habits = make(map[string]map[string]*Habit)
+	}
+	if data.Tokens == nil {
+		data.Tokens = make(map[string]*Token)
+	}
 	fileStore := FileStore{
 		filename: filename,
-		habits:   habits,
+		habits:   data.Habits,
+		tokens:   data.Tokens,
 	}
 	return &fileStore, nil
 }
 
-//Get searches FileStore by name and returns the habit if it exists
-func (s *FileStore) Get(name string) (*Habit, error) {
-	habit, ok := s.habits[name]
+func decodeFileStoreData(fileBytes []byte) (fileStoreData, error) {
+	data := fileStoreData{}
+	err := json.Unmarshal(fileBytes, &data)
+	if err == nil && data.Version == fileStoreVersion {
+		return data, nil
+	}
+
+	//habits and tokens written before users existed belong to the local user
+	legacy := fileStoreDataV1{}
+	err = json.Unmarshal(fileBytes, &legacy)
+	if err != nil || legacy.Version == 0 {
+		legacy = fileStoreDataV1{}
+		err = json.Unmarshal(fileBytes, &legacy.Habits)
+	}
+	if err != nil {
+		return data, err
+	}
+	user := DefaultUser()
+	data = fileStoreData{
+		Version: fileStoreVersion,
+		Habits:  map[string]map[string]*Habit{user: legacy.Habits},
+		Tokens:  legacy.Tokens,
+	}
+	for _, h := range legacy.Habits {
+		h.User = user
+	}
+	for _, t := range legacy.Tokens {
+		t.User = user
+	}
+	return data, nil
+}
+
+//Get searches FileStore by user and name and returns the habit if it exists
+func (s *FileStore) Get(user, name string) (*Habit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	habit, ok := s.habits[user][name]
 	if ok {
-		return habit, nil
+		return copyHabit(habit), nil
 	}
 	return nil, nil
 }
@@ -290,11 +1091,16 @@ func (s *FileStore) Create(habit *Habit) error {
 		return ErrNilHabit
 	}
 
-	if _, ok := s.habits[habit.Name]; ok {
-		return errors.New("habit already exists")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.habits[habit.User][habit.Name]; ok {
+		return ErrHabitExists
+	}
+	if s.habits[habit.User] == nil {
+		s.habits[habit.User] = map[string]*Habit{}
 	}
-	s.habits[habit.Name] = habit
-	err := writeHabitsToFile(s.filename, s.habits)
+	s.habits[habit.User][habit.Name] = copyHabit(habit)
+	err := s.save()
 	if err != nil {
 		return err
 	}
@@ -309,32 +1115,102 @@ func (s *FileStore) Update(habit *Habit) error {
 		return ErrNilHabit
 	}
 
-	if _, ok := s.habits[habit.Name]; !ok {
-		return errors.New("cannot update habit does not exists")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.habits[habit.User][habit.Name]; !ok {
+		return ErrHabitNotFound
 	}
 
-	s.habits[habit.Name] = habit
-	err := writeHabitsToFile(s.filename, s.habits)
+	s.habits[habit.User][habit.Name] = copyHabit(habit)
+	err := s.save()
 	return err
 }
 
-//GetAllHabits returns a []*Habits of all the stored habit
-func (s *FileStore) GetAllHabits() []*Habit {
-	allHabits := make([]*Habit, 0, len(s.habits))
-	for _, h := range s.habits {
-		allHabits = append(allHabits, h)
+//Delete removes the user's habit. It returns an error if the habit does not exist. It triggers file io operations.
+func (s *FileStore) Delete(user, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.habits[user][name]; !ok {
+		return ErrHabitNotFound
+	}
+	delete(s.habits[user], name)
+	return s.save()
+}
+
+//GetAllHabits returns a []*Habits of all the habits stored for user
+func (s *FileStore) GetAllHabits(user string) []*Habit {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	allHabits := make([]*Habit, 0, len(s.habits[user]))
+	for _, h := range s.habits[user] {
+		allHabits = append(allHabits, copyHabit(h))
 	}
 	return allHabits
 }
 
-func writeHabitsToFile(filename string, habits map[string]*Habit) error {
+//ListHabits returns the habits selected, ordered and paged by the query
+func (s *FileStore) ListHabits(query HabitQuery) ([]*Habit, error) {
+	err := query.validate()
+	if err != nil {
+		return nil, err
+	}
+	return query.Apply(s.GetAllHabits(query.User)), nil
+}
+
+//CreateToken inserts the given token into the store. It triggers file io operations.
+func (s *FileStore) CreateToken(token *Token) error {
+	if token == nil {
+		return errors.New("token cannot be nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token.Hash] = token
+	return s.save()
+}
+
+//GetToken returns the token with the given hash if it exists
+func (s *FileStore) GetToken(hash string) (*Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tokens[hash], nil
+}
+
+//ListTokens returns a []*Token of all the stored tokens
+func (s *FileStore) ListTokens() []*Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return listTokens(s.tokens)
+}
+
+//RevokeToken deletes the token with the given id. It returns ErrTokenNotFound if the token does not exist. It
+//triggers file io operations.
+func (s *FileStore) RevokeToken(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := revokeToken(s.tokens, id)
+	if err != nil {
+		return err
+	}
+	return s.save()
+}
+
+//save writes the store to its file, callers must hold the write lock
+func (s *FileStore) save() error {
+	return writeFileStoreData(s.filename, fileStoreData{
+		Version: fileStoreVersion,
+		Habits:  s.habits,
+		Tokens:  s.tokens,
+	})
+}
+
+func writeFileStoreData(filename string, data fileStoreData) error {
 	file, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0600)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	fileBytes, err := json.Marshal(habits)
+	fileBytes, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
@@ -350,5 +1226,50 @@ func writeHabitsToFile(filename string, habits map[string]*Habit) error {
 	return err
 }
 
+func listTokens(tokens map[string]*Token) []*Token {
+	allTokens := make([]*Token, 0, len(tokens))
+	for _, t := range tokens {
+		allTokens = append(allTokens, t)
+	}
+	sort.Slice(allTokens, func(i, j int) bool {
+		return allTokens[i].Created.Before(allTokens[j].Created)
+	})
+	return allTokens
+}
+
+func revokeToken(tokens map[string]*Token, id string) error {
+	for hash, t := range tokens {
+		if t.ID == id {
+			delete(tokens, hash)
+			return nil
+		}
+	}
+	return ErrTokenNotFound
+}
+
+//DefaultUser returns the name of the local OS user. It owns the habits created by the CLI and those written by
+//versions of habit that had no users.
+func DefaultUser() string {
+	current, err := user.Current()
+	if err == nil && current.Username != "" {
+		return current.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "default"
+}
+
+const dbTimeLayout = "2006-01-02 15:04:05-07:00"
+
 //ErrNilHabit is returned when a habit is nil
 var ErrNilHabit = errors.New("habit cannot be nil")
+
+//ErrHabitExists is returned when creating a habit that already exists
+var ErrHabitExists = errors.New("habit already exists")
+
+//ErrDuplicateCheckIn is returned when checking in a habit with a check-in key it already recorded
+var ErrDuplicateCheckIn = errors.New("check-in was already recorded")
+
+//ErrHabitNotFound is returned when updating or deleting a habit that does not exist
+var ErrHabitNotFound = errors.New("cannot update habit does not exists")
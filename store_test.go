@@ -1,7 +1,10 @@
 package habit_test
 
 import (
+	"database/sql"
+	"fmt"
 	"github.com/crmejia/habit"
+	"github.com/crmejia/habit/storetest"
 	"os"
 	"testing"
 	"time"
@@ -10,7 +13,7 @@ import (
 func TestMemoryStore_GetReturnsNilOnNoHabit(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
-	got, err := store.Get("piano")
+	got, err := store.Get("", "piano")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -23,9 +26,9 @@ func TestMemoryStore_GetReturnsNilOnNoHabit(t *testing.T) {
 func TestMemoryStore_GetReturnsExistingHabit(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
-	store.Habits["piano"] = &habit.Habit{Name: "piano"}
+	store.Habits[""] = map[string]*habit.Habit{"piano": {Name: "piano"}}
 
-	h, err := store.Get("piano")
+	h, err := store.Get("", "piano")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -50,7 +53,7 @@ func TestMemoryStore_CreateNewHabit(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if _, ok := store.Habits["piano"]; !ok {
+	if _, ok := store.Habits[""]["piano"]; !ok {
 		t.Error("want h to be inserted into store")
 	}
 }
@@ -74,7 +77,7 @@ func TestMemoryStore_CreateExistingHabitFails(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
 	h := habit.Habit{Name: "piano"}
-	store.Habits["piano"] = &h
+	store.Habits[""] = map[string]*habit.Habit{"piano": &h}
 	err := store.Create(&h)
 
 	if err == nil {
@@ -86,7 +89,7 @@ func TestMemoryStore_UpdateHabit(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
 	oldHabit := &habit.Habit{Name: "piano"}
-	store.Habits["piano"] = oldHabit
+	store.Habits[""] = map[string]*habit.Habit{"piano": oldHabit}
 
 	updateHabit := &habit.Habit{Name: "piano"}
 	err := store.Update(updateHabit)
@@ -94,7 +97,7 @@ func TestMemoryStore_UpdateHabit(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if oldHabit == store.Habits["piano"] {
+	if oldHabit == store.Habits[""]["piano"] {
 		t.Error("want update to replace habit")
 	}
 }
@@ -122,13 +125,15 @@ func TestMemoryStore_UpdateFailsOnNonExistingHabit(t *testing.T) {
 func TestMemoryStore_AllHabitsReturnsSliceOfHabits(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
-	store.Habits = map[string]*habit.Habit{
-		"piano":   {Name: "piano"},
-		"surfing": {Name: "surfing"},
+	store.Habits = map[string]map[string]*habit.Habit{
+		"": {
+			"piano":   {Name: "piano"},
+			"surfing": {Name: "surfing"},
+		},
 	}
 
-	allHabits := store.GetAllHabits()
-	if len(allHabits) != len(store.Habits) {
+	allHabits := store.GetAllHabits("")
+	if len(allHabits) != len(store.Habits[""]) {
 		t.Error("want GetAllHabits to return a slice of habits")
 	}
 }
@@ -161,7 +166,7 @@ func TestMessageGenerator(t *testing.T) {
 func TestController_HandleSetsMessageCorrectlyForNewHabit(t *testing.T) {
 	t.Parallel()
 	store := habit.OpenMemoryStore()
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -189,19 +194,19 @@ func TestTracker_FetchHabitSetsMessageCorrectlyForStreakBrokenStreak(t *testing.
 		{want: "You last did the habit 'running' 10 days ago, so you're starting a new streak today. Good luck!", habit: &habit.Habit{Name: "running", Streak: 10, DueDate: time.Now().Add(-10 * 24 * time.Hour)}},
 	}
 	store := habit.OpenMemoryStore()
-	controller, err := habit.NewController(&store)
+	controller, err := habit.NewController(store)
 	if err != nil {
 		t.Fatal(err)
 	}
 	for _, tc := range testCases {
 
-		store.Habits[tc.habit.Name] = tc.habit
-		_, err := controller.Handle(tc.habit)
+		store.Habits[""] = map[string]*habit.Habit{tc.habit.Name: tc.habit}
+		h, err := controller.Handle(tc.habit)
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		got := tc.habit.String()
+		got := h.String()
 		if tc.want != got {
 			t.Errorf("For %d day streak: want the Message to be:\n%s,\n got\n%s", tc.habit.Streak, tc.want, got)
 		}
@@ -236,6 +241,40 @@ func TestDBStore_CreateUpdateNilHabitFails(t *testing.T) {
 	}
 }
 
+func TestDBStore_ListHabitsReadsHistoryOfManyHabits(t *testing.T) {
+	t.Parallel()
+	store, err := habit.OpenDBStore(t.TempDir() + "test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//more habits than are read in one batch
+	const count = 501
+	now := time.Now()
+	for i := 0; i < count; i++ {
+		h := &habit.Habit{Name: fmt.Sprintf("habit-%03d", i), User: "alice", Frequency: habit.DailyInterval,
+			DueDate: now, CreatedAt: now, CheckIns: []habit.CheckIn{{Time: now, Note: fmt.Sprint(i)}},
+			Pauses: []habit.Pause{{From: now.Add(time.Duration(i) * time.Minute)}}, Tags: []string{fmt.Sprint(i)}}
+		err = store.Create(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	habits, err := store.ListHabits(habit.HabitQuery{User: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(habits) != count {
+		t.Fatalf("want %d habits, got %d", count, len(habits))
+	}
+	for i, h := range habits {
+		if len(h.CheckIns) != 1 || h.CheckIns[0].Note != fmt.Sprint(i) || len(h.Pauses) != 1 ||
+			!h.Pauses[0].From.Equal(now.Add(time.Duration(i)*time.Minute)) || len(h.Tags) != 1 ||
+			h.Tags[0] != fmt.Sprint(i) {
+			t.Fatalf("want %s to keep its own history, got %+v %+v %v", h.Name, h.CheckIns, h.Pauses, h.Tags)
+		}
+	}
+}
+
 func TestDBStore_GetCreateRoundTrip(t *testing.T) {
 	t.Parallel()
 	dbSource := t.TempDir() + "test.db"
@@ -244,7 +283,7 @@ func TestDBStore_GetCreateRoundTrip(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	h, err := dbStore.Get("piano")
+	h, err := dbStore.Get("", "piano")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -260,7 +299,7 @@ func TestDBStore_GetCreateRoundTrip(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	got, err := dbStore.Get("piano")
+	got, err := dbStore.Get("", "piano")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -285,7 +324,7 @@ func TestDBStore_CreateUpdateRoundTrip(t *testing.T) {
 		t.Fatal()
 	}
 
-	intermediateHabit, err := dbStore.Get("piano")
+	intermediateHabit, err := dbStore.Get("", "piano")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -302,7 +341,7 @@ func TestDBStore_CreateUpdateRoundTrip(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	got, err := dbStore.Get("piano")
+	got, err := dbStore.Get("", "piano")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -330,7 +369,7 @@ func TestDBStore_AllHabits(t *testing.T) {
 		}
 	}
 
-	got := dbStore.GetAllHabits()
+	got := dbStore.GetAllHabits("")
 	if len(got) != len(habits) {
 		t.Errorf("want GetAllHabits to return %d habits, got %d", len(habits), len(got))
 	}
@@ -365,7 +404,7 @@ func TestOpenFileStoreUnmarshallsExistingFile(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	habits := store.GetAllHabits()
+	habits := store.GetAllHabits(habit.DefaultUser())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -398,7 +437,7 @@ func TestFileStore_GetReturnsNilOnNoHabit(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	h, err := fileStore.Get("piano")
+	h, err := fileStore.Get("", "piano")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -415,7 +454,7 @@ func TestFileStore_GetCreateRoundTrip(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	h, err := fileStore.Get("piano")
+	h, err := fileStore.Get("", "piano")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -431,7 +470,7 @@ func TestFileStore_GetCreateRoundTrip(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	got, err := fileStore.Get("piano")
+	got, err := fileStore.Get("", "piano")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -456,7 +495,7 @@ func TestFileStore_CreateUpdateRoundTrip(t *testing.T) {
 		t.Fatal()
 	}
 
-	intermediateHabit, err := fileStore.Get("piano")
+	intermediateHabit, err := fileStore.Get("", "piano")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -473,7 +512,7 @@ func TestFileStore_CreateUpdateRoundTrip(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	got, err := fileStore.Get("piano")
+	got, err := fileStore.Get("", "piano")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -502,8 +541,201 @@ func TestFileStore_AllHabitsReturnsSliceOfHabits(t *testing.T) {
 		}
 	}
 
-	got := fileStore.GetAllHabits()
+	got := fileStore.GetAllHabits("")
 	if len(got) != len(habits) {
 		t.Errorf("want GetAllHabits to return %d habits, got %d", len(habits), len(got))
 	}
 }
+
+func TestStores_NamespaceHabitsByUser(t *testing.T) {
+	t.Parallel()
+	memoryStore := habit.OpenMemoryStore()
+	dbStore, err := habit.OpenDBStore(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileStore, err := habit.OpenFileStore(t.TempDir() + "/.habitTracker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name  string
+		store habit.Store
+	}{
+		{"MemoryStore", memoryStore},
+		{"DBStore", dbStore},
+		{"FileStore", fileStore},
+	}
+
+	for _, tc := range testCases {
+		for _, user := range []string{"alice", "bob"} {
+			err = tc.store.Create(&habit.Habit{Name: "piano", User: user, Streak: len(user)})
+			if err != nil {
+				t.Fatalf("%s: want users to have habits with the same name, got %v", tc.name, err)
+			}
+		}
+		err = tc.store.Create(&habit.Habit{Name: "surfing", User: "bob"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h, err := tc.store.Get("alice", "piano")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h == nil || h.User != "alice" || h.Streak != len("alice") {
+			t.Errorf("%s: want alice's piano habit, got %+v", tc.name, h)
+		}
+		h, err = tc.store.Get("alice", "surfing")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h != nil {
+			t.Errorf("%s: want alice not to see bob's habits", tc.name)
+		}
+		if len(tc.store.GetAllHabits("alice")) != 1 || len(tc.store.GetAllHabits("bob")) != 2 {
+			t.Errorf("%s: want GetAllHabits to only return the user's habits", tc.name)
+		}
+
+		err = tc.store.Update(&habit.Habit{Name: "piano", User: "alice", Streak: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err = tc.store.Get("bob", "piano")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Streak != len("bob") {
+			t.Errorf("%s: want updating alice's habit to leave bob's untouched, got streak %d", tc.name, h.Streak)
+		}
+	}
+}
+
+func TestOpenDBStoreMigratesHabitsWithoutUser(t *testing.T) {
+	t.Parallel()
+	dbSource := t.TempDir() + "/test.db"
+	db, err := sql.Open("sqlite3", dbSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const oldSchema = `
+CREATE TABLE habit(
+id INTEGER NOT NULL PRIMARY KEY,
+name VARCHAR UNIQUE NOT NULL,
+streak INTEGER NOT NULL,
+frequency INTEGER NOT NULL,
+duedate TEXT NOT NULL );
+INSERT INTO habit(name,streak,frequency,duedate) VALUES('piano',3,86400000000000,'2022-06-14 19:46:39-05:00');`
+	_, err = db.Exec(oldSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := habit.OpenDBStore(dbSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := store.Get(habit.DefaultUser(), "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h == nil || h.Streak != 3 {
+		t.Errorf("want existing habits to belong to the local user, got %+v", h)
+	}
+}
+
+func TestStores_PersistLastResult(t *testing.T) {
+	t.Parallel()
+	memoryStore := habit.OpenMemoryStore()
+	dbStore, err := habit.OpenDBStore(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileStore, err := habit.OpenFileStore(t.TempDir() + "/.habitTracker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, testServer, secret := newTestHabitServer(t, habit.StoreScope)
+	httpStore, err := habit.OpenHTTPStore(testServer.URL, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name  string
+		store habit.Store
+	}{
+		{"MemoryStore", memoryStore},
+		{"DBStore", dbStore},
+		{"FileStore", fileStore},
+		{"HTTPStore", httpStore},
+	}
+
+	for _, tc := range testCases {
+		created := time.Now().Add(-habit.DailyInterval)
+		h := &habit.Habit{Name: "piano", User: "alice", Frequency: habit.DailyInterval, DueDate: time.Now(),
+			LastCheckIn: created, CreatedAt: created}
+		h.GenerateMessage(habit.NewMessage)
+		err = tc.store.Create(h)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		got, err := tc.store.Get("alice", "piano")
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got.Message != h.Message || got.MessageKind != habit.NewMessage || !got.LastCheckIn.Equal(created) {
+			t.Errorf("%s: want last result to round trip on create, got %+v", tc.name, got)
+		}
+
+		controller, err := habit.NewController(tc.store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = controller.Handle(&habit.Habit{Name: "piano", User: "alice"})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		all := tc.store.GetAllHabits("alice")
+		if len(all) != 1 {
+			t.Fatalf("%s: want 1 habit, got %d", tc.name, len(all))
+		}
+		got = all[0]
+		want := "Nice work: you've done the habit 'piano' for 1 days in a row now. Keep it up!"
+		if got.Message != want || got.MessageKind != habit.StreakMessage || !habit.SameDay(got.LastCheckIn, time.Now()) {
+			t.Errorf("%s: want last result to round trip on update, got %+v", tc.name, got)
+		}
+	}
+}
+
+func TestMemoryStoreConformance(t *testing.T) {
+	t.Parallel()
+	storetest.RunConformance(t, func() habit.Store {
+		return habit.OpenMemoryStore()
+	})
+}
+
+func TestDBStoreConformance(t *testing.T) {
+	t.Parallel()
+	storetest.RunConformance(t, func() habit.Store {
+		store, err := habit.OpenDBStore(t.TempDir() + "/test.db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+func TestFileStoreConformance(t *testing.T) {
+	t.Parallel()
+	storetest.RunConformance(t, func() habit.Store {
+		store, err := habit.OpenFileStore(t.TempDir() + "/.habitTracker")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
@@ -0,0 +1,517 @@
+//Package storetest provides a conformance test suite for implementations of habit.Store.
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crmejia/habit"
+)
+
+//RunConformance runs the conformance suite against the stores returned by newStore. newStore is called once per test
+//and must return an empty store.
+func RunConformance(t *testing.T, newStore func() habit.Store) {
+	t.Helper()
+	tests := []struct {
+		name string
+		test func(t *testing.T, store habit.Store)
+	}{
+		{"GetReturnsNilOnUnknownHabit", testGetReturnsNilOnUnknownHabit},
+		{"CreateGetRoundTripsEveryField", testCreateGetRoundTripsEveryField},
+		{"UpdateRoundTripsEveryField", testUpdateRoundTripsEveryField},
+		{"CreateExistingHabitFails", testCreateExistingHabitFails},
+		{"UpdateUnknownHabitFails", testUpdateUnknownHabitFails},
+		{"DeleteRemovesHabitAndHistory", testDeleteRemovesHabitAndHistory},
+		{"NilHabitFails", testNilHabitFails},
+		{"ReturnedHabitsAreCopies", testReturnedHabitsAreCopies},
+		{"GetAllHabitsReturnsUserHabits", testGetAllHabitsReturnsUserHabits},
+		{"HabitsAreNamespacedByUser", testHabitsAreNamespacedByUser},
+		{"ListHabitsFiltersSortsAndPages", testListHabitsFiltersSortsAndPages},
+		{"ConcurrentUse", testConcurrentUse},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			store := newStore()
+			if store == nil {
+				t.Fatal("newStore returned nil")
+			}
+			tc.test(t, store)
+		})
+	}
+}
+
+//fullHabit returns a valid habit with every field but Kind set, using a time zone other than UTC and the local one
+func fullHabit(user, name string) *habit.Habit {
+	zone := time.FixedZone("test", -(5*60*60 + 30*60))
+	created := time.Date(2022, 6, 10, 8, 15, 30, 123456789, zone)
+	return &habit.Habit{
+		Name:        name,
+		User:        user,
+		Streak:      3,
+		DueDate:     created.Add(4 * habit.DailyInterval),
+		Frequency:   habit.WeeklyInterval,
+		Unit:        "km",
+		Target:      5,
+		Progress:    2.75,
+		GraceDays:   2,
+		GraceUsedAt: created.Add(2 * habit.DailyInterval),
+		Freezes:     1,
+		Message:     "Nice work: you've done the habit '" + name + "' for 3 days in a row now. Keep it up!",
+		MessageKind: habit.StreakMessage,
+		LastCheckIn: created.Add(3 * habit.DailyInterval),
+		CreatedAt:   created,
+		UpdatedAt:   created.Add(time.Minute),
+		CheckIns: []habit.CheckIn{
+			{Time: created.Add(habit.DailyInterval), Amount: 5},
+			{Time: created.Add(2 * habit.DailyInterval), Amount: 0.25, Key: "retry-1"},
+			{Time: created.Add(3 * habit.DailyInterval), Amount: 2.5, Note: "scales, then 'Für Elise'", Rating: 4},
+		},
+		Pauses: []habit.Pause{
+			{From: created.Add(habit.DailyInterval), Until: created.Add(2 * habit.DailyInterval)},
+			{From: created.Add(5 * habit.DailyInterval)},
+		},
+		Tags:          []string{"health", "outdoors"},
+		Description:   "30 minutes of scales and sight-reading",
+		DueOnCreation: true,
+	}
+}
+
+//quitHabit returns fullHabit turned into a quit habit, which has no target or grace period
+func quitHabit(user, name string) *habit.Habit {
+	h := fullHabit(user, name)
+	h.Kind = habit.QuitHabit
+	h.Unit, h.Target, h.Progress, h.GraceDays = "", 0, 0, 0
+	for i := range h.CheckIns {
+		h.CheckIns[i].Amount = 0
+	}
+	return h
+}
+
+func compareHabits(want, got *habit.Habit) error {
+	if got == nil {
+		return errors.New("got nil habit")
+	}
+	if want.Name != got.Name || want.User != got.User || want.Streak != got.Streak ||
+		want.Frequency != got.Frequency || want.Kind != got.Kind || want.Unit != got.Unit || want.Target != got.Target ||
+		want.Progress != got.Progress || want.GraceDays != got.GraceDays || want.Freezes != got.Freezes ||
+		want.Message != got.Message || want.MessageKind != got.MessageKind || want.Description != got.Description ||
+		want.DueOnCreation != got.DueOnCreation {
+		return fmt.Errorf("want %+v, got %+v", want, got)
+	}
+	times := []struct {
+		field     string
+		want, got time.Time
+	}{
+		{"DueDate", want.DueDate, got.DueDate},
+		{"GraceUsedAt", want.GraceUsedAt, got.GraceUsedAt},
+		{"LastCheckIn", want.LastCheckIn, got.LastCheckIn},
+		{"CreatedAt", want.CreatedAt, got.CreatedAt},
+		{"UpdatedAt", want.UpdatedAt, got.UpdatedAt},
+	}
+	if strings.Join(want.Tags, ",") != strings.Join(got.Tags, ",") {
+		return fmt.Errorf("want tags %v, got %v", want.Tags, got.Tags)
+	}
+	if len(want.CheckIns) != len(got.CheckIns) {
+		return fmt.Errorf("want %d check-ins, got %d", len(want.CheckIns), len(got.CheckIns))
+	}
+	for i := range want.CheckIns {
+		if want.CheckIns[i].Amount != got.CheckIns[i].Amount {
+			return fmt.Errorf("want CheckIns[%d].Amount to be %g, got %g", i, want.CheckIns[i].Amount,
+				got.CheckIns[i].Amount)
+		}
+		if want.CheckIns[i].Key != got.CheckIns[i].Key {
+			return fmt.Errorf("want CheckIns[%d].Key to be %q, got %q", i, want.CheckIns[i].Key, got.CheckIns[i].Key)
+		}
+		if want.CheckIns[i].Note != got.CheckIns[i].Note || want.CheckIns[i].Rating != got.CheckIns[i].Rating {
+			return fmt.Errorf("want CheckIns[%d] to be noted %q and rated %d, got %q and %d", i,
+				want.CheckIns[i].Note, want.CheckIns[i].Rating, got.CheckIns[i].Note, got.CheckIns[i].Rating)
+		}
+		times = append(times, struct {
+			field     string
+			want, got time.Time
+		}{fmt.Sprintf("CheckIns[%d].Time", i), want.CheckIns[i].Time, got.CheckIns[i].Time})
+	}
+	if len(want.Pauses) != len(got.Pauses) {
+		return fmt.Errorf("want %d pauses, got %d", len(want.Pauses), len(got.Pauses))
+	}
+	for i := range want.Pauses {
+		times = append(times, []struct {
+			field     string
+			want, got time.Time
+		}{
+			{fmt.Sprintf("Pauses[%d].From", i), want.Pauses[i].From, got.Pauses[i].From},
+			{fmt.Sprintf("Pauses[%d].Until", i), want.Pauses[i].Until, got.Pauses[i].Until},
+		}...)
+	}
+	for _, tc := range times {
+		if !tc.want.Equal(tc.got) {
+			return fmt.Errorf("want %s to be %s, got %s", tc.field, tc.want, tc.got)
+		}
+		_, wantOffset := tc.want.Zone()
+		_, gotOffset := tc.got.Zone()
+		if wantOffset != gotOffset {
+			return fmt.Errorf("want %s to keep its UTC offset %d, got %d", tc.field, wantOffset, gotOffset)
+		}
+	}
+	return nil
+}
+
+func testGetReturnsNilOnUnknownHabit(t *testing.T, store habit.Store) {
+	h, err := store.Get("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h != nil {
+		t.Errorf("want Get to return nil on unknown habit, got %+v", h)
+	}
+}
+
+func testCreateGetRoundTripsEveryField(t *testing.T, store habit.Store) {
+	for _, want := range []*habit.Habit{fullHabit("alice", "piano"), quitHabit("alice", "smoking")} {
+		err := store.Create(copyHabit(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Get("alice", want.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = compareHabits(want, got)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func copyHabit(h *habit.Habit) *habit.Habit {
+	c := *h
+	c.CheckIns = append([]habit.CheckIn(nil), h.CheckIns...)
+	c.Pauses = append([]habit.Pause(nil), h.Pauses...)
+	c.Tags = append([]string(nil), h.Tags...)
+	return &c
+}
+
+func testUpdateRoundTripsEveryField(t *testing.T, store habit.Store) {
+	err := store.Create(&habit.Habit{Name: "piano", User: "alice", Frequency: habit.DailyInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fullHabit("alice", "piano")
+	err = store.Update(fullHabit("alice", "piano"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = compareHabits(want, got)
+	if err != nil {
+		t.Error(err)
+	}
+
+	want.CheckIns = want.CheckIns[:1]
+	want.Streak = 1
+	want.Tags = want.Tags[1:]
+	update := fullHabit("alice", "piano")
+	update.CheckIns = update.CheckIns[:1]
+	update.Streak = 1
+	update.Tags = update.Tags[1:]
+	err = store.Update(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = store.Get("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = compareHabits(want, got)
+	if err != nil {
+		t.Errorf("want Update to replace the check-in history and tags: %v", err)
+	}
+}
+
+func testCreateExistingHabitFails(t *testing.T, store habit.Store) {
+	err := store.Create(&habit.Habit{Name: "piano", User: "alice", Frequency: habit.DailyInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Create(&habit.Habit{Name: "piano", User: "alice", Frequency: habit.DailyInterval})
+	if !errors.Is(err, habit.ErrHabitExists) {
+		t.Errorf("want ErrHabitExists, got %v", err)
+	}
+}
+
+func testReturnedHabitsAreCopies(t *testing.T, store habit.Store) {
+	created := fullHabit("alice", "piano")
+	err := store.Create(created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//changing a habit only changes the store through Update
+	created.Streak = 100
+	got, err := store.Get("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Streak = 100
+	got.CheckIns[0].Amount = 100
+	got.Tags[0] = "changed"
+	all := store.GetAllHabits("alice")
+	if len(all) != 1 {
+		t.Fatalf("want one habit, got %d", len(all))
+	}
+	all[0].CheckIns = nil
+
+	got, err = store.Get("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = compareHabits(fullHabit("alice", "piano"), got)
+	if err != nil {
+		t.Errorf("want the store unchanged by changes to the habits it was given or returned: %v", err)
+	}
+}
+
+func testUpdateUnknownHabitFails(t *testing.T, store habit.Store) {
+	err := store.Update(&habit.Habit{Name: "piano", User: "alice"})
+	if !errors.Is(err, habit.ErrHabitNotFound) {
+		t.Errorf("want ErrHabitNotFound, got %v", err)
+	}
+}
+
+func testDeleteRemovesHabitAndHistory(t *testing.T, store habit.Store) {
+	for _, user := range []string{"alice", "bob"} {
+		err := store.Create(fullHabit(user, "piano"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := store.Delete("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := store.Get("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h != nil || len(store.GetAllHabits("alice")) != 0 {
+		t.Error("want deleted habit to be gone")
+	}
+	if h, _ := store.Get("bob", "piano"); h == nil {
+		t.Error("want other users' habits with the same name to be kept")
+	}
+	err = store.Delete("alice", "piano")
+	if !errors.Is(err, habit.ErrHabitNotFound) {
+		t.Errorf("want deleting a missing habit to return ErrHabitNotFound, got %v", err)
+	}
+
+	//a habit created again with the same name starts without the deleted history
+	err = store.Create(&habit.Habit{Name: "piano", User: "alice", Frequency: habit.DailyInterval})
+	if err != nil {
+		t.Fatalf("want deleted habit to be created again, got %v", err)
+	}
+	h, err = store.Get("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h == nil || len(h.CheckIns) != 0 || len(h.Pauses) != 0 || len(h.Tags) != 0 {
+		t.Errorf("want recreated habit without history, got %+v", h)
+	}
+}
+
+func testNilHabitFails(t *testing.T, store habit.Store) {
+	err := store.Create(nil)
+	if !errors.Is(err, habit.ErrNilHabit) {
+		t.Errorf("want Create to return ErrNilHabit, got %v", err)
+	}
+	err = store.Update(nil)
+	if !errors.Is(err, habit.ErrNilHabit) {
+		t.Errorf("want Update to return ErrNilHabit, got %v", err)
+	}
+}
+
+func testGetAllHabitsReturnsUserHabits(t *testing.T, store habit.Store) {
+	if got := store.GetAllHabits("alice"); len(got) != 0 {
+		t.Errorf("want no habits in an empty store, got %d", len(got))
+	}
+	for _, name := range []string{"piano", "surfing", "reading"} {
+		err := store.Create(fullHabit("alice", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := store.GetAllHabits("alice")
+	if len(got) != 3 {
+		t.Fatalf("want 3 habits, got %d", len(got))
+	}
+	for _, h := range got {
+		err := compareHabits(fullHabit("alice", h.Name), h)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func testListHabitsFiltersSortsAndPages(t *testing.T, store habit.Store) {
+	now := time.Now()
+	base := now.Add(2 * habit.DailyInterval).UTC()
+	habits := []*habit.Habit{
+		//piano is due after reading even though its due date reads earlier in its time zone
+		{Name: "piano", Frequency: habit.DailyInterval, Streak: 5, Tags: []string{"music"},
+			DueDate: base.Add(time.Hour).In(time.FixedZone("west", -10*60*60))},
+		{Name: "reading", Frequency: habit.WeeklyInterval, Streak: 1,
+			DueDate: base.In(time.FixedZone("east", 5*60*60))},
+		{Name: "surfing", Frequency: habit.DailyInterval, Streak: 3, Tags: []string{"health"},
+			DueDate: base.Add(3 * time.Hour), Pauses: []habit.Pause{{From: now.Add(-time.Hour)}}},
+		{Name: "water", Frequency: habit.DailyInterval, Streak: 3, Tags: []string{"health"},
+			DueDate: base.Add(30 * time.Minute)},
+	}
+	for _, h := range habits {
+		h.User = "alice"
+		err := store.Create(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := store.Create(&habit.Habit{Name: "bass", User: "bob", Frequency: habit.DailyInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name  string
+		query habit.HabitQuery
+		want  string
+	}{
+		{"all by name", habit.HabitQuery{}, "piano,reading,surfing,water"},
+		{"by name descending", habit.HabitQuery{Descending: true}, "water,surfing,reading,piano"},
+		{"by streak", habit.HabitQuery{SortBy: habit.SortByStreak}, "reading,surfing,water,piano"},
+		{"by streak descending", habit.HabitQuery{SortBy: habit.SortByStreak, Descending: true},
+			"piano,surfing,water,reading"},
+		{"by due date", habit.HabitQuery{SortBy: habit.SortByDueDate}, "reading,water,piano,surfing"},
+		{"tagged", habit.HabitQuery{Tag: "health"}, "surfing,water"},
+		{"weekly", habit.HabitQuery{Frequency: habit.WeeklyInterval}, "reading"},
+		{"paused", habit.HabitQuery{Status: habit.PausedStatus}, "surfing"},
+		{"done", habit.HabitQuery{Status: habit.DoneStatus}, "piano,reading,water"},
+		{"page", habit.HabitQuery{Limit: 2, Offset: 1}, "reading,surfing"},
+		{"offset only", habit.HabitQuery{Offset: 3}, "water"},
+		{"past the last page", habit.HabitQuery{Offset: 10}, ""},
+		{"page of a status", habit.HabitQuery{Status: habit.DoneStatus, Limit: 1, Offset: 1}, "reading"},
+		{"page of a tag by due date", habit.HabitQuery{Tag: "health", SortBy: habit.SortByDueDate, Limit: 1},
+			"water"},
+	}
+	for _, tc := range testCases {
+		tc.query.User = "alice"
+		got, err := store.ListHabits(tc.query)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		names := make([]string, 0, len(got))
+		for _, h := range got {
+			names = append(names, h.Name)
+		}
+		if strings.Join(names, ",") != tc.want {
+			t.Errorf("%s: want %s, got %s", tc.name, tc.want, strings.Join(names, ","))
+		}
+	}
+
+	_, err = store.ListHabits(habit.HabitQuery{User: "alice", Limit: -1})
+	if err == nil {
+		t.Error("want ListHabits to fail on a negative limit")
+	}
+}
+
+func testHabitsAreNamespacedByUser(t *testing.T, store habit.Store) {
+	for _, user := range []string{"alice", "bob"} {
+		h := fullHabit(user, "piano")
+		h.Streak = len(user)
+		err := store.Create(h)
+		if err != nil {
+			t.Fatalf("want users to have habits with the same name, got %v", err)
+		}
+	}
+	err := store.Create(fullHabit("bob", "surfing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := store.Get("alice", "surfing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h != nil {
+		t.Error("want alice not to see bob's habits")
+	}
+	if len(store.GetAllHabits("alice")) != 1 || len(store.GetAllHabits("bob")) != 2 {
+		t.Error("want GetAllHabits to only return the user's habits")
+	}
+
+	update := fullHabit("alice", "piano")
+	update.Streak = 10
+	err = store.Update(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err = store.Get("bob", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h == nil || h.Streak != len("bob") {
+		t.Errorf("want updating alice's habit to leave bob's untouched, got %+v", h)
+	}
+}
+
+func testConcurrentUse(t *testing.T, store habit.Store) {
+	const workers = 8
+	const updates = 5
+	errs := make(chan error, workers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("habit-%d", i)
+			err := store.Create(&habit.Habit{Name: name, User: "alice", Frequency: habit.DailyInterval})
+			if err != nil {
+				errs <- err
+				return
+			}
+			for streak := 1; streak <= updates; streak++ {
+				err = store.Update(&habit.Habit{Name: name, User: "alice", Frequency: habit.DailyInterval,
+					Streak: streak})
+				if err != nil {
+					errs <- err
+					return
+				}
+				_, err = store.Get("alice", name)
+				if err != nil {
+					errs <- err
+					return
+				}
+				store.GetAllHabits("alice")
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	got := store.GetAllHabits("alice")
+	if len(got) != workers {
+		t.Fatalf("want %d habits after concurrent creates, got %d", workers, len(got))
+	}
+	for _, h := range got {
+		if h.Streak != updates {
+			t.Errorf("want '%s' to keep its last update, got streak %d", h.Name, h.Streak)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package habit
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//SyncReport summarizes the changes made by Sync
+type SyncReport struct {
+	//CopiedToA and CopiedToB hold the names of the habits that only existed in the other store
+	CopiedToA []string
+	CopiedToB []string
+	//Merged holds the names of the habits that existed in both stores
+	Merged    []string
+	Conflicts []SyncConflict
+	//SyncedAt is when the sync finished, to pass as the last sync of the stores to the next one
+	SyncedAt time.Time
+}
+
+//SyncConflict describes a setting of a habit that differed between the stores, of which the most recently updated
+//one is kept, or a habit deleted from one of the stores since their last sync, which is kept in the other one.
+type SyncConflict struct {
+	Name   string
+	Reason string
+}
+
+//String returns a human readable summary of the report
+func (r SyncReport) String() string {
+	if len(r.CopiedToA)+len(r.CopiedToB)+len(r.Merged) == 0 {
+		return "no habits to sync"
+	}
+	message := fmt.Sprintf("Synced %d habits: %d copied to the first store, %d copied to the second store, %d merged.",
+		len(r.CopiedToA)+len(r.CopiedToB)+len(r.Merged), len(r.CopiedToA), len(r.CopiedToB), len(r.Merged))
+	for _, c := range r.Conflicts {
+		message += fmt.Sprintf("\nConflict on '%s': %s", c.Name, c.Reason)
+	}
+	return message
+}
+
+//Sync merges the habits of user in stores a and b so both end up holding the same habits. Habits missing from one
+//store are copied over. Habits present in both keep the settings and tags of the most recently updated copy, combine
+//the check-ins and pauses of both copies and have their streak recomputed from the combined history, counting local
+//days from midnight.
+func Sync(a, b Store, user string) (SyncReport, error) {
+	return syncStores(a, b, user, Calendar{}, time.Time{})
+}
+
+//Sync works like the Sync function, syncing the controller's store with other and recomputing streaks with the
+//controller's Calendar. LastSync is the SyncedAt of the last sync of both stores: a habit missing from one store that
+//has not changed since then was deleted from that store, it is reported as a conflict instead of being copied back. A
+//zero lastSync copies every missing habit.
+func (c Controller) Sync(other Store, user string, lastSync time.Time) (SyncReport, error) {
+	return syncStores(c.Store, other, user, c.Calendar, lastSync)
+}
+
+func syncStores(a, b Store, user string, cal Calendar, lastSync time.Time) (SyncReport, error) {
+	report := SyncReport{}
+	habitsA := habitsByName(a.GetAllHabits(user))
+	habitsB := habitsByName(b.GetAllHabits(user))
+
+	names := make([]string, 0, len(habitsA)+len(habitsB))
+	for name := range habitsA {
+		names = append(names, name)
+	}
+	for name := range habitsB {
+		if _, ok := habitsA[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		ha, hb := habitsA[name], habitsB[name]
+		switch {
+		case hb == nil && deletedSince(ha, lastSync):
+			report.Conflicts = append(report.Conflicts, SyncConflict{Name: name,
+				Reason: "deleted from the second store since the last sync, kept in the first store"})
+		case ha == nil && deletedSince(hb, lastSync):
+			report.Conflicts = append(report.Conflicts, SyncConflict{Name: name,
+				Reason: "deleted from the first store since the last sync, kept in the second store"})
+		case hb == nil:
+			err := b.Create(userHabit(ha, user))
+			if err != nil {
+				return report, fmt.Errorf("copying '%s': %w", name, err)
+			}
+			report.CopiedToB = append(report.CopiedToB, name)
+		case ha == nil:
+			err := a.Create(userHabit(hb, user))
+			if err != nil {
+				return report, fmt.Errorf("copying '%s': %w", name, err)
+			}
+			report.CopiedToA = append(report.CopiedToA, name)
+		default:
+			merged, conflicts := mergeHabits(ha, hb, cal)
+			report.Conflicts = append(report.Conflicts, conflicts...)
+			merged.User = user
+			err := a.Update(merged)
+			if err != nil {
+				return report, fmt.Errorf("merging '%s': %w", name, err)
+			}
+			err = b.Update(copyHabit(merged))
+			if err != nil {
+				return report, fmt.Errorf("merging '%s': %w", name, err)
+			}
+			report.Merged = append(report.Merged, name)
+		}
+	}
+	report.SyncedAt = time.Now()
+	return report, nil
+}
+
+//deletedSince returns whether the copy of a habit missing from the other store was there at the last sync, which
+//left both stores with the same habits, and so was deleted from it since
+func deletedSince(h *Habit, lastSync time.Time) bool {
+	return !lastSync.IsZero() && !h.UpdatedAt.After(lastSync) && !h.LastCheckIn.After(lastSync)
+}
+
+//userHabit returns a copy of h belonging to user. Stores such as HTTPStore return the habits of the user their token
+//belongs to, which are written as the user's when syncing.
+func userHabit(h *Habit, user string) *Habit {
+	c := copyHabit(h)
+	c.User = user
+	return c
+}
+
+//mergeHabits combines two copies of the same habit. Settings and tags are taken from the most recently updated copy,
+//or from a on a tie, and every setting that differed is reported as a conflict.
+func mergeHabits(a, b *Habit, cal Calendar) (*Habit, []SyncConflict) {
+	newer, older := a, b
+	if b.UpdatedAt.After(a.UpdatedAt) {
+		newer, older = b, a
+	}
+	var conflicts []SyncConflict
+	conflict := func(setting, kept, dropped string) {
+		if kept != dropped {
+			conflicts = append(conflicts, SyncConflict{
+				Name:   a.Name,
+				Reason: fmt.Sprintf("%s changed on both sides, kept %s over %s", setting, kept, dropped),
+			})
+		}
+	}
+	conflict("frequency", frequencyName(newer.Frequency), frequencyName(older.Frequency))
+	conflict("kind", newer.Kind.String(), older.Kind.String())
+	conflict("target", formatAmount(newer.Target, ""), formatAmount(older.Target, ""))
+	conflict("unit", strconv.Quote(newer.Unit), strconv.Quote(older.Unit))
+	conflict("grace days", strconv.Itoa(newer.GraceDays), strconv.Itoa(older.GraceDays))
+	conflict("description", strconv.Quote(newer.Description), strconv.Quote(older.Description))
+
+	merged := copyHabit(newer)
+	merged.CreatedAt = earliest(a.CreatedAt, b.CreatedAt)
+	merged.CheckIns = unionCheckIns(a.CheckIns, b.CheckIns)
+	merged.Pauses = unionPauses(newer.Pauses, older.Pauses)
+	if merged.CreatedAt.IsZero() && older.Streak > merged.Streak {
+		//without a creation time there is no history to replay, keep the longest known streak
+		merged.Streak = older.Streak
+		merged.DueDate = older.DueDate
+	}
+	merged.recomputeStreak(cal)
+	return merged, conflicts
+}
+
+func habitsByName(habits []*Habit) map[string]*Habit {
+	byName := make(map[string]*Habit, len(habits))
+	for _, h := range habits {
+		byName[h.Name] = h
+	}
+	return byName
+}
+
+//unionCheckIns returns the check-ins of both copies by time, keeping check-ins made at the same time unless they are
+//the same check-in
+func unionCheckIns(a, b []CheckIn) []CheckIn {
+	all := append(append([]CheckIn(nil), a...), b...)
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Time.Before(all[j].Time)
+	})
+	union := make([]CheckIn, 0, len(all))
+	for _, c := range all {
+		duplicate := false
+		for i := len(union) - 1; i >= 0 && union[i].Time.Equal(c.Time); i-- {
+			if union[i].sameAs(c) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			union = append(union, c)
+		}
+	}
+	return union
+}
+
+//sameAs returns whether c and other record the same check-in, by their keys when both have one
+func (c CheckIn) sameAs(other CheckIn) bool {
+	if c.Key != "" && other.Key != "" {
+		return c.Key == other.Key
+	}
+	return c.Time.Equal(other.Time) && c.Key == other.Key && c.Amount == other.Amount && c.Note == other.Note &&
+		c.Rating == other.Rating
+}
+
+//unionPauses returns the pauses of both copies by start. Pauses starting at the same time are the same pause, which
+//is taken from newer, so that a pause resumed in one copy ends.
+func unionPauses(newer, older []Pause) []Pause {
+	union := append([]Pause(nil), newer...)
+	for _, p := range older {
+		found := false
+		for _, q := range newer {
+			if p.From.Equal(q.From) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			union = append(union, p)
+		}
+	}
+	sort.SliceStable(union, func(i, j int) bool {
+		return union[i].From.Before(union[j].From)
+	})
+	return union
+}
+
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+func frequencyName(frequency time.Duration) string {
+	for _, f := range frequencies {
+		if f.interval == frequency {
+			return f.name
+		}
+	}
+	return frequency.String()
+}
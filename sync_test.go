@@ -0,0 +1,441 @@
+package habit_test
+
+import (
+	"bytes"
+	"github.com/crmejia/habit"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncCopiesMissingHabits(t *testing.T) {
+	t.Parallel()
+	a := habit.OpenMemoryStore()
+	b, err := habit.OpenFileStore(t.TempDir() + "/.habitTracker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Create(&habit.Habit{Name: "piano", User: "alice", Frequency: habit.DailyInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Create(&habit.Habit{Name: "surfing", User: "alice", Frequency: habit.WeeklyInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := habit.Sync(a, b, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.CopiedToA) != 1 || len(report.CopiedToB) != 1 || len(report.Merged) != 0 {
+		t.Errorf("want one habit copied each way, got %+v", report)
+	}
+	for _, store := range []habit.Store{a, b} {
+		if len(store.GetAllHabits("alice")) != 2 {
+			t.Errorf("want both stores to hold both habits, got %d", len(store.GetAllHabits("alice")))
+		}
+	}
+}
+
+func TestSyncMergesCheckInsAndRecomputesStreak(t *testing.T) {
+	t.Parallel()
+	created := time.Now().Add(-3 * habit.DailyInterval)
+	newHabit := func(checkIns ...time.Time) *habit.Habit {
+		h := &habit.Habit{
+			Name:      "piano",
+			User:      "alice",
+			Frequency: habit.DailyInterval,
+			CreatedAt: created,
+			UpdatedAt: created,
+		}
+		for _, c := range checkIns {
+			h.CheckIns = append(h.CheckIns, habit.CheckIn{Time: c})
+		}
+		return h
+	}
+	twoDaysAgo := time.Now().Add(-2 * habit.DailyInterval)
+	yesterday := time.Now().Add(-1 * habit.DailyInterval)
+
+	a := habit.OpenMemoryStore()
+	b, err := habit.OpenDBStore(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Create(newHabit(twoDaysAgo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Create(newHabit(twoDaysAgo, yesterday))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := habit.Sync(a, b, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Merged) != 1 || len(report.Conflicts) != 0 {
+		t.Errorf("want one merged habit without conflicts, got %+v", report)
+	}
+	for _, store := range []habit.Store{a, b} {
+		h, err := store.Get("alice", "piano")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(h.CheckIns) != 2 {
+			t.Errorf("want the union of both check-in histories, got %d check-ins", len(h.CheckIns))
+		}
+		if h.Streak != 2 {
+			t.Errorf("want streak to be recomputed from the merged history, got %d", h.Streak)
+		}
+		if !habit.SameDay(h.DueDate, time.Now()) {
+			t.Errorf("want due date to be today, got %s", h.DueDate)
+		}
+	}
+}
+
+func TestSyncKeepsNewestSettingsAndReportsConflicts(t *testing.T) {
+	t.Parallel()
+	created := time.Now().Add(-10 * habit.DailyInterval)
+	a := habit.OpenMemoryStore()
+	b := habit.OpenMemoryStore()
+	err := a.Create(&habit.Habit{Name: "piano", User: "alice", Frequency: habit.DailyInterval, CreatedAt: created,
+		UpdatedAt: created})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Create(&habit.Habit{Name: "piano", User: "alice", Frequency: habit.WeeklyInterval, CreatedAt: created,
+		UpdatedAt: created.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := habit.Sync(a, b, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Conflicts) != 1 || !strings.Contains(report.Conflicts[0].Reason, "kept weekly over daily") {
+		t.Errorf("want frequency conflict to be reported, got %+v", report.Conflicts)
+	}
+	h, err := a.Get("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Frequency != habit.WeeklyInterval {
+		t.Errorf("want the most recently updated frequency to win, got %s", h.Frequency)
+	}
+}
+
+func TestSyncReportsEveryConflictingSetting(t *testing.T) {
+	t.Parallel()
+	created := time.Now().Add(-10 * habit.DailyInterval)
+	a := habit.OpenMemoryStore()
+	b := habit.OpenMemoryStore()
+	err := a.Create(&habit.Habit{Name: "water", User: "alice", Frequency: habit.DailyInterval, Target: 8,
+		Unit: "glasses", GraceDays: 1, Description: "stay hydrated", CreatedAt: created, UpdatedAt: created})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Create(&habit.Habit{Name: "water", User: "alice", Frequency: habit.DailyInterval, Kind: habit.QuitHabit,
+		Target: 2, Unit: "liters", GraceDays: 2, Description: "drink more", CreatedAt: created,
+		UpdatedAt: created.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := habit.Sync(a, b, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"kind changed on both sides, kept quit over build",
+		"target changed on both sides, kept 2 over 8",
+		`unit changed on both sides, kept "liters" over "glasses"`,
+		"grace days changed on both sides, kept 2 over 1",
+		`description changed on both sides, kept "drink more" over "stay hydrated"`,
+	}
+	if len(report.Conflicts) != len(want) {
+		t.Fatalf("want %d conflicts, got %+v", len(want), report.Conflicts)
+	}
+	for i, reason := range want {
+		if report.Conflicts[i].Name != "water" || report.Conflicts[i].Reason != reason {
+			t.Errorf("want conflict %q, got %+v", reason, report.Conflicts[i])
+		}
+	}
+}
+
+func TestSyncCombinesPausesAndCheckIns(t *testing.T) {
+	t.Parallel()
+	created := time.Now().Add(-10 * habit.DailyInterval)
+	twoDaysAgo := time.Now().Add(-2 * habit.DailyInterval)
+	pausedFrom := time.Now().Add(-8 * habit.DailyInterval)
+	a := habit.OpenMemoryStore()
+	b, err := habit.OpenDBStore(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.Create(&habit.Habit{Name: "piano", User: "alice", Frequency: habit.DailyInterval, CreatedAt: created,
+		UpdatedAt: created, Tags: []string{"music"},
+		Pauses: []habit.Pause{{From: pausedFrom}, {From: twoDaysAgo, Until: twoDaysAgo.Add(time.Hour)}},
+		CheckIns: []habit.CheckIn{{Time: twoDaysAgo, Note: "scales"}, {Time: twoDaysAgo, Note: "arpeggios"},
+			{Time: twoDaysAgo.Add(time.Minute), Key: "phone-1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Create(&habit.Habit{Name: "piano", User: "alice", Frequency: habit.DailyInterval, CreatedAt: created,
+		UpdatedAt: created.Add(time.Hour), Tags: []string{"evening"},
+		Pauses: []habit.Pause{{From: pausedFrom, Until: pausedFrom.Add(habit.DailyInterval)}},
+		CheckIns: []habit.CheckIn{{Time: twoDaysAgo, Note: "scales"},
+			{Time: twoDaysAgo.Add(time.Minute), Key: "phone-1", Note: "retried"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = habit.Sync(a, b, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, store := range []habit.Store{a, b} {
+		h, err := store.Get("alice", "piano")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(h.Tags, ",") != "evening" {
+			t.Errorf("want the tags of the newer copy, got %v", h.Tags)
+		}
+		if len(h.Pauses) != 2 || h.Pauses[0].Until.IsZero() {
+			t.Errorf("want the pauses of both copies, resumed as in the newer copy, got %+v", h.Pauses)
+		}
+		if len(h.CheckIns) != 3 || h.CheckIns[0].Note != "scales" || h.CheckIns[1].Note != "arpeggios" {
+			t.Errorf("want distinct check-ins at the same time kept once each, got %+v", h.CheckIns)
+		}
+	}
+
+	_, err = habit.Sync(a, b, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := a.Get("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.CheckIns) != 3 || len(h.Pauses) != 2 {
+		t.Errorf("want syncing again to add nothing, got %d check-ins and %d pauses", len(h.CheckIns), len(h.Pauses))
+	}
+}
+
+func TestSyncWritesHabitsOfRemoteStoreForUser(t *testing.T) {
+	t.Parallel()
+	serverStore, testServer, secret := newTestHabitServer(t, habit.StoreScope)
+	created := time.Now().Add(-3 * habit.DailyInterval)
+	serverStore.Habits["alice"] = map[string]*habit.Habit{
+		"piano": {Name: "piano", User: "alice", Frequency: habit.DailyInterval, CreatedAt: created,
+			UpdatedAt: created},
+		"surfing": {Name: "surfing", User: "alice", Frequency: habit.DailyInterval, CreatedAt: created,
+			UpdatedAt: created},
+	}
+	remote, err := habit.OpenHTTPStore(testServer.URL, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := habit.OpenMemoryStore()
+	err = local.Create(&habit.Habit{Name: "piano", User: "bob", Frequency: habit.DailyInterval, CreatedAt: created,
+		UpdatedAt: created})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the token belongs to alice, whose habits are synced into bob's
+	_, err = habit.Sync(local, remote, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(local.GetAllHabits("alice")) != 0 || len(local.GetAllHabits("bob")) != 2 {
+		t.Errorf("want the remote habits written as the syncing user's, got %d of alice's and %d of bob's",
+			len(local.GetAllHabits("alice")), len(local.GetAllHabits("bob")))
+	}
+	for _, h := range local.GetAllHabits("bob") {
+		if h.User != "bob" {
+			t.Errorf("want '%s' to belong to bob, got %s", h.Name, h.User)
+		}
+	}
+}
+
+func TestController_SyncKeepsHabitsDeletedSinceLastSync(t *testing.T) {
+	t.Parallel()
+	created := time.Now().Add(-3 * habit.DailyInterval)
+	a := habit.OpenMemoryStore()
+	b := habit.OpenMemoryStore()
+	for _, name := range []string{"piano", "surfing"} {
+		err := a.Create(&habit.Habit{Name: name, User: "alice", Frequency: habit.DailyInterval, CreatedAt: created,
+			UpdatedAt: created})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	controller, err := habit.NewController(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := controller.Sync(b, "alice", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.CopiedToB) != 2 {
+		t.Fatalf("want both habits copied without a last sync, got %+v", report)
+	}
+
+	err = b.Delete("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = controller.Sync(b, "alice", report.SyncedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.CopiedToB) != 0 || len(report.Conflicts) != 1 || report.Conflicts[0].Name != "piano" ||
+		!strings.Contains(report.Conflicts[0].Reason, "deleted from the second store since the last sync") {
+		t.Errorf("want the deleted habit reported instead of copied back, got %+v", report)
+	}
+	h, err := b.Get("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h != nil {
+		t.Error("want the deleted habit to stay deleted")
+	}
+}
+
+func TestRunCLISyncsStores(t *testing.T) {
+	t.Parallel()
+	dirA := t.TempDir()
+	dirB := t.TempDir()
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", dirA, "-u", "alice", "piano"}, &buffer)
+	habit.RunCLI([]string{"-s", "file", "-d", dirB, "-u", "alice", "surfing"}, &buffer)
+
+	sync := []string{"-d", dirA, "-u", "alice", "sync", "-state", filepath.Join(dirA, "sync.json"), "file", dirB}
+	buffer.Reset()
+	habit.RunCLI(sync, &buffer)
+	if !strings.Contains(buffer.String(), "Synced 2 habits") {
+		t.Errorf("want sync report, got:\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-s", "file", "-d", dirB, "-u", "alice", "all"}, &buffer)
+	if !strings.Contains(buffer.String(), "piano") {
+		t.Errorf("want synced habit in the file store, got:\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-s", "file", "-d", dirB, "-u", "alice", "delete", "piano"}, &buffer)
+	buffer.Reset()
+	habit.RunCLI(sync, &buffer)
+	if !strings.Contains(buffer.String(), "Conflict on 'piano': deleted from the second store since the last sync") {
+		t.Errorf("want the habit deleted from the file store reported, got:\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", dirA, "sync"}, &buffer)
+	if !strings.Contains(buffer.String(), "sync takes a store DSN, or a store type and a store directory") {
+		t.Errorf("want sync to require another store, got:\n%s", buffer.String())
+	}
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", dirA, "sync", "file"}, &buffer)
+	if !strings.Contains(buffer.String(), "invalid store DSN") {
+		t.Errorf("want sync to reject a store type without a directory, got:\n%s", buffer.String())
+	}
+}
+
+func TestRunCLISyncsStoreDSN(t *testing.T) {
+	t.Parallel()
+	dirA := t.TempDir()
+	fileName := t.TempDir() + "/habits.json"
+	buffer := bytes.Buffer{}
+	habit.RunCLI([]string{"-d", dirA, "-u", "alice", "piano"}, &buffer)
+
+	buffer.Reset()
+	habit.RunCLI([]string{"-d", dirA, "-u", "alice", "sync", "-state", filepath.Join(dirA, "sync.json"),
+		"file://" + fileName}, &buffer)
+	if !strings.Contains(buffer.String(), "Synced 1 habits") {
+		t.Errorf("want sync report, got:\n%s", buffer.String())
+	}
+	store, err := habit.OpenFileStore(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := store.Get("alice", "piano")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h == nil {
+		t.Error("want habit to be synced to the store DSN")
+	}
+}
+
+func TestSyncRecomputesQuantitativeHabitFromAmounts(t *testing.T) {
+	t.Parallel()
+	yesterday := time.Now().Add(-1 * habit.DailyInterval)
+	newHabit := func(checkIns ...habit.CheckIn) *habit.Habit {
+		return &habit.Habit{Name: "water", User: "alice", Frequency: habit.DailyInterval, Target: 8,
+			Unit: "glasses", CreatedAt: yesterday, UpdatedAt: yesterday, CheckIns: checkIns}
+	}
+	a := habit.OpenMemoryStore()
+	b := habit.OpenMemoryStore()
+	err := a.Create(newHabit(habit.CheckIn{Time: yesterday, Amount: 8}, habit.CheckIn{Time: time.Now(), Amount: 3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Create(newHabit(habit.CheckIn{Time: yesterday, Amount: 8},
+		habit.CheckIn{Time: time.Now().Add(time.Second), Amount: 4}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = habit.Sync(a, b, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := a.Get("alice", "water")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Streak != 1 || h.Progress != 7 || !habit.SameDay(h.DueDate, time.Now()) {
+		t.Errorf("want merged amounts to be replayed toward today's target, got %+v", h)
+	}
+}
+
+func TestSyncKeepsLatestSlipOfQuitHabit(t *testing.T) {
+	t.Parallel()
+	created := time.Now().Add(-10 * habit.DailyInterval)
+	slip := time.Now().Add(-3 * habit.DailyInterval)
+	a := habit.OpenMemoryStore()
+	b := habit.OpenMemoryStore()
+	err := a.Create(&habit.Habit{Name: "smoking", User: "alice", Frequency: habit.DailyInterval,
+		Kind: habit.QuitHabit, CreatedAt: created, UpdatedAt: created, LastCheckIn: created})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Create(&habit.Habit{Name: "smoking", User: "alice", Frequency: habit.DailyInterval,
+		Kind: habit.QuitHabit, CreatedAt: created, UpdatedAt: created, LastCheckIn: slip,
+		CheckIns: []habit.CheckIn{{Time: slip}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = habit.Sync(a, b, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller, err := habit.NewController(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := controller.GetAllHabits("alice")
+	if !strings.Contains(got, "You've gone 3 days without 'smoking'") {
+		t.Errorf("want the slip from the other store to reset the streak, got:\n%s", got)
+	}
+}
@@ -0,0 +1,103 @@
+package habit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+//AddTags tags the user's habit. Tags are lower case words, tagging a habit twice with the same tag does nothing.
+func (c Controller) AddTags(user, name string, tags ...string) (*Habit, error) {
+	h, err := c.getHabit(user, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, errors.New("no tags given")
+	}
+	for _, tag := range tags {
+		tag, err = normalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if !h.hasTag(tag) {
+			h.Tags = append(h.Tags, tag)
+		}
+	}
+	sort.Strings(h.Tags)
+	h.UpdatedAt = time.Now()
+	err = c.Store.Update(h)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+//RemoveTags removes tags from the user's habit. It returns an error if the habit does not have one of them.
+func (c Controller) RemoveTags(user, name string, tags ...string) (*Habit, error) {
+	h, err := c.getHabit(user, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, errors.New("no tags given")
+	}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !h.hasTag(tag) {
+			return nil, fmt.Errorf("habit '%s' is not tagged %s", h.Name, tag)
+		}
+		kept := h.Tags[:0]
+		for _, t := range h.Tags {
+			if t != tag {
+				kept = append(kept, t)
+			}
+		}
+		h.Tags = kept
+	}
+	h.UpdatedAt = time.Now()
+	err = c.Store.Update(h)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+//normalizeTag lower cases a tag and checks that it is a single word
+func normalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", errors.New("tag cannot be empty")
+	}
+	if strings.IndexFunc(tag, func(r rune) bool { return unicode.IsSpace(r) || r == ',' }) != -1 {
+		return "", fmt.Errorf("invalid tag '%s', tags cannot contain spaces or commas", tag)
+	}
+	return tag, nil
+}
+
+func (h *Habit) hasTag(tag string) bool {
+	for _, t := range h.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+//filterTagged returns the habits with the given tag, or all of them if tag is empty
+func filterTagged(habits []*Habit, tag string) []*Habit {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return habits
+	}
+	tagged := make([]*Habit, 0, len(habits))
+	for _, h := range habits {
+		if h.hasTag(tag) {
+			tagged = append(tagged, h)
+		}
+	}
+	return tagged
+}
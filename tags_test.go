@@ -0,0 +1,88 @@
+package habit_test
+
+import (
+	"github.com/crmejia/habit"
+	"strings"
+	"testing"
+)
+
+func TestController_AddAndRemoveTags(t *testing.T) {
+	t.Parallel()
+	store := habit.OpenMemoryStore()
+	controller, err := habit.NewController(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.Handle(&habit.Habit{Name: "piano", User: "alice", Frequency: habit.DailyInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := controller.AddTags("alice", "piano", "Music", "practice", "music")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(h.Tags, ",") != "music,practice" {
+		t.Errorf("want tags to be lower cased, sorted and unique, got %v", h.Tags)
+	}
+	h, err = controller.RemoveTags("alice", "piano", "practice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(h.Tags, ",") != "music" {
+		t.Errorf("want practice to be removed, got %v", h.Tags)
+	}
+
+	testCases := []struct {
+		name string
+		call func() (*habit.Habit, error)
+	}{
+		{"no tags", func() (*habit.Habit, error) { return controller.AddTags("alice", "piano") }},
+		{"empty tag", func() (*habit.Habit, error) { return controller.AddTags("alice", "piano", " ") }},
+		{"tag with spaces", func() (*habit.Habit, error) { return controller.AddTags("alice", "piano", "two words") }},
+		{"tag with commas", func() (*habit.Habit, error) { return controller.AddTags("alice", "piano", "a,b") }},
+		{"missing habit", func() (*habit.Habit, error) { return controller.AddTags("alice", "surfing", "sport") }},
+		{"missing tag", func() (*habit.Habit, error) { return controller.RemoveTags("alice", "piano", "sport") }},
+	}
+	for _, tc := range testCases {
+		_, err := tc.call()
+		if err == nil {
+			t.Errorf("%s: want error", tc.name)
+		}
+	}
+}
+
+func TestController_GetHabitsFiltersByTag(t *testing.T) {
+	t.Parallel()
+	controller, err := habit.NewController(habit.OpenMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"piano", "surfing", "water"} {
+		_, err = controller.Handle(&habit.Habit{Name: name, User: "alice", Frequency: habit.DailyInterval})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = controller.AddTags("alice", "surfing", "health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = controller.AddTags("alice", "water", "health")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := controller.GetHabits(habit.HabitQuery{User: "alice", Tag: "Health"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Habits:\n" + "You're currently on a 0-day streak for 'surfing'. Stick to it!\n" +
+		"You're currently on a 0-day streak for 'water'. Stick to it!\n"; got != want {
+		t.Errorf("want only health habits to be listed, got:\n%s", got)
+	}
+	got, err = controller.GetHabits(habit.HabitQuery{User: "alice", Tag: "music"})
+	if err != nil || got != "no habits match" {
+		t.Errorf("want no habits to be listed, got %q, %v", got, err)
+	}
+}
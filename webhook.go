@@ -0,0 +1,341 @@
+package habit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	//SignatureHeader carries the HMAC-SHA256 signature of webhook payloads, as sha256=HEX
+	SignatureHeader = "X-Habit-Signature"
+	//EventHeader carries the type of the event in a webhook payload
+	EventHeader = "X-Habit-Event"
+	//DeliveryHeader carries the ID of a webhook delivery, which stays the same across retries
+	DeliveryHeader = "X-Habit-Delivery"
+
+	defaultMaxAttempts = 5
+	defaultBackoff     = 30 * time.Second
+	maxBackoff         = time.Hour
+)
+
+//Webhook is a URL events are posted to
+type Webhook struct {
+	URL string
+	//Secret signs the payloads when set
+	Secret string
+	//Events limits the webhook to the given event types, all events are posted if empty
+	Events []EventType
+}
+
+//Delivery is an event waiting to be posted to a webhook
+type Delivery struct {
+	ID          string
+	URL         string
+	Event       Event
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+}
+
+//DeliveryQueue persists the deliveries that have not been posted yet
+type DeliveryQueue interface {
+	Load() ([]Delivery, error)
+	Save(deliveries []Delivery) error
+}
+
+//WebhookDispatcher is an EventHandler posting events as signed JSON to webhooks. Deliveries are queued, and failed
+//ones retried with an exponential backoff until MaxAttempts.
+type WebhookDispatcher struct {
+	//Client defaults to a client with a timeout of 30 seconds, so that a webhook that never responds doesn't hold up
+	//the deliveries to the others
+	Client *http.Client
+	//MaxAttempts defaults to 5
+	MaxAttempts int
+	//Backoff is the wait before the first retry, doubled for every further one. It defaults to 30 seconds.
+	Backoff time.Duration
+
+	webhooks []Webhook
+	queue    DeliveryQueue
+	mu       sync.Mutex
+	pending  []Delivery
+	sending  map[string]bool
+	wake     chan struct{}
+}
+
+//NewWebhookDispatcher returns a WebhookDispatcher posting to webhooks, resuming the deliveries to them left in queue
+func NewWebhookDispatcher(queue DeliveryQueue, webhooks ...Webhook) (*WebhookDispatcher, error) {
+	if queue == nil {
+		return nil, errors.New("delivery queue cannot be nil")
+	}
+	queued, err := queue.Load()
+	if err != nil {
+		return nil, err
+	}
+	//deliveries to webhooks that were removed are dropped
+	var pending []Delivery
+	for _, delivery := range queued {
+		for _, w := range webhooks {
+			if w.URL == delivery.URL {
+				pending = append(pending, delivery)
+				break
+			}
+		}
+	}
+	return &WebhookDispatcher{
+		webhooks: webhooks,
+		queue:    queue,
+		pending:  pending,
+		sending:  map[string]bool{},
+		wake:     make(chan struct{}, 1),
+	}, nil
+}
+
+//HandleEvent queues the event for every webhook subscribed to its type
+func (d *WebhookDispatcher) HandleEvent(e Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, w := range d.webhooks {
+		if !w.subscribed(e.Type) {
+			continue
+		}
+		id, err := randomHex(16)
+		if err != nil {
+			log.Println("cannot queue webhook delivery:", err)
+			return
+		}
+		d.pending = append(d.pending, Delivery{ID: id, URL: w.URL, Event: e, NextAttempt: e.Time})
+	}
+	err := d.queue.Save(d.pending)
+	if err != nil {
+		log.Println("cannot save webhook deliveries:", err)
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+//Pending returns the deliveries waiting to be posted
+func (d *WebhookDispatcher) Pending() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Delivery(nil), d.pending...)
+}
+
+//Deliver posts the deliveries due now. Failed deliveries are retried later, and dropped once they reach MaxAttempts.
+//The returned error reports the last failure.
+func (d *WebhookDispatcher) Deliver(ctx context.Context) error {
+	now := time.Now()
+	d.mu.Lock()
+	var due []Delivery
+	for _, delivery := range d.pending {
+		if !delivery.NextAttempt.After(now) && !d.sending[delivery.ID] {
+			due = append(due, delivery)
+			d.sending[delivery.ID] = true
+		}
+	}
+	d.mu.Unlock()
+
+	var lastErr error
+	for _, delivery := range due {
+		err := d.post(ctx, delivery)
+		d.mu.Lock()
+		delete(d.sending, delivery.ID)
+		dropped := d.finish(delivery, err)
+		saveErr := d.queue.Save(d.pending)
+		d.mu.Unlock()
+		if err != nil {
+			lastErr = fmt.Errorf("webhook delivery %s to %s failed: %w", delivery.ID, delivery.URL, err)
+		}
+		if err != nil && dropped {
+			lastErr = fmt.Errorf("%v, giving up after %d attempts", lastErr, delivery.Attempts+1)
+		}
+		if saveErr != nil {
+			lastErr = fmt.Errorf("cannot save webhook deliveries: %w", saveErr)
+		}
+	}
+	return lastErr
+}
+
+//finish removes a posted delivery from the queue, or schedules its retry. It returns whether the delivery was
+//removed. Callers must hold the lock.
+func (d *WebhookDispatcher) finish(delivery Delivery, err error) bool {
+	for i := range d.pending {
+		if d.pending[i].ID != delivery.ID {
+			continue
+		}
+		maxAttempts := d.MaxAttempts
+		if maxAttempts <= 0 {
+			maxAttempts = defaultMaxAttempts
+		}
+		p := &d.pending[i]
+		p.Attempts++
+		if err == nil || p.Attempts >= maxAttempts {
+			d.pending = append(d.pending[:i], d.pending[i+1:]...)
+			return true
+		}
+		p.LastError = err.Error()
+		p.NextAttempt = time.Now().Add(d.backoff(p.Attempts))
+		return false
+	}
+	return true
+}
+
+func (d *WebhookDispatcher) backoff(attempts int) time.Duration {
+	backoff := d.Backoff
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+func (d *WebhookDispatcher) post(ctx context.Context, delivery Delivery) error {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(delivery.Event.Type))
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	for _, w := range d.webhooks {
+		if w.URL == delivery.URL && w.Secret != "" {
+			req.Header.Set(SignatureHeader, SignPayload(w.Secret, body))
+			break
+		}
+	}
+	client := d.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+//Run delivers events as they are queued, and retries failed deliveries every interval, until ctx is done. Errors are
+//logged.
+func (d *WebhookDispatcher) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		err := d.Deliver(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Println(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (w Webhook) subscribed(t EventType) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, event := range w.Events {
+		if event == t {
+			return true
+		}
+	}
+	return false
+}
+
+//SignPayload returns the signature of a webhook payload, as sent in the SignatureHeader
+func SignPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//VerifySignature reports whether signature is the signature of payload with secret
+func VerifySignature(secret string, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(SignPayload(secret, payload)), []byte(signature))
+}
+
+//MemoryDeliveryQueue keeps deliveries in memory, they are lost when the program exits
+type MemoryDeliveryQueue struct {
+	mu         sync.Mutex
+	deliveries []Delivery
+}
+
+//Load returns the saved deliveries
+func (q *MemoryDeliveryQueue) Load() ([]Delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]Delivery(nil), q.deliveries...), nil
+}
+
+//Save replaces the saved deliveries
+func (q *MemoryDeliveryQueue) Save(deliveries []Delivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.deliveries = append([]Delivery(nil), deliveries...)
+	return nil
+}
+
+//FileDeliveryQueue keeps deliveries in a JSON file
+type FileDeliveryQueue struct {
+	filename string
+}
+
+//OpenFileDeliveryQueue returns a FileDeliveryQueue using filename, which is created on the first save
+func OpenFileDeliveryQueue(filename string) *FileDeliveryQueue {
+	return &FileDeliveryQueue{filename: filename}
+}
+
+//Load reads the saved deliveries. It triggers file io operations.
+func (q *FileDeliveryQueue) Load() ([]Delivery, error) {
+	data, err := ioutil.ReadFile(q.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var deliveries []Delivery
+	err = json.Unmarshal(data, &deliveries)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read webhook deliveries from %s: %w", q.filename, err)
+	}
+	return deliveries, nil
+}
+
+//Save writes the deliveries, replacing the saved ones. It triggers file io operations.
+func (q *FileDeliveryQueue) Save(deliveries []Delivery) error {
+	data, err := json.Marshal(deliveries)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(q.filename, data, 0600)
+}
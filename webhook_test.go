@@ -0,0 +1,225 @@
+package habit_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/crmejia/habit"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//webhookReceiver is an httptest receiver recording the events posted to it and failing the first failures requests
+type webhookReceiver struct {
+	*httptest.Server
+	secret string
+
+	mu       sync.Mutex
+	failures int
+	events   []habit.Event
+	ids      []string
+}
+
+func newWebhookReceiver(t *testing.T, secret string, failures int) *webhookReceiver {
+	t.Helper()
+	receiver := &webhookReceiver{secret: secret, failures: failures}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !habit.VerifySignature(receiver.secret, body, r.Header.Get(habit.SignatureHeader)) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		receiver.ids = append(receiver.ids, r.Header.Get(habit.DeliveryHeader))
+		if receiver.failures > 0 {
+			receiver.failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		e := habit.Event{}
+		err = json.Unmarshal(body, &e)
+		if err != nil || r.Header.Get(habit.EventHeader) != string(e.Type) {
+			http.Error(w, "bad event", http.StatusBadRequest)
+			return
+		}
+		receiver.events = append(receiver.events, e)
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+func (r *webhookReceiver) received() ([]habit.Event, []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]habit.Event(nil), r.events...), append([]string(nil), r.ids...)
+}
+
+func TestWebhookDispatcher_PostsSignedEvents(t *testing.T) {
+	t.Parallel()
+	receiver := newWebhookReceiver(t, "s3cret", 0)
+	dispatcher, err := habit.NewWebhookDispatcher(&habit.MemoryDeliveryQueue{},
+		habit.Webhook{URL: receiver.URL, Secret: "s3cret"},
+		habit.Webhook{URL: receiver.URL + "/streaks", Secret: "s3cret", Events: []habit.EventType{
+			habit.StreakExtendedEvent}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller, err := habit.NewController(habit.OpenMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller.EventHandlers = []habit.EventHandler{dispatcher}
+
+	_, err = controller.Handle(&habit.Habit{Name: "piano", User: "alice", Frequency: habit.DailyInterval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dispatcher.Pending()) != 1 {
+		t.Fatalf("want the event to be queued for the unfiltered webhook only, got %+v", dispatcher.Pending())
+	}
+	err = dispatcher.Deliver(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, _ := receiver.received()
+	if len(events) != 1 || events[0].Type != habit.HabitCreatedEvent || events[0].Habit.Name != "piano" {
+		t.Errorf("want habit created event to be received, got %+v", events)
+	}
+	if len(dispatcher.Pending()) != 0 {
+		t.Errorf("want delivered events to leave the queue, got %+v", dispatcher.Pending())
+	}
+}
+
+func TestWebhookDispatcher_RetriesFailedDeliveries(t *testing.T) {
+	t.Parallel()
+	receiver := newWebhookReceiver(t, "s3cret", 2)
+	dispatcher, err := habit.NewWebhookDispatcher(&habit.MemoryDeliveryQueue{},
+		habit.Webhook{URL: receiver.URL, Secret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.Backoff = 50 * time.Millisecond
+	dispatcher.HandleEvent(habit.Event{ID: "1", Type: habit.StreakExtendedEvent, Time: time.Now()})
+
+	err = dispatcher.Deliver(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("want failed delivery error, got %v", err)
+	}
+	pending := dispatcher.Pending()
+	if len(pending) != 1 || pending[0].Attempts != 1 || !strings.Contains(pending[0].LastError, "503") {
+		t.Fatalf("want failed delivery to be kept for a retry, got %+v", pending)
+	}
+	err = dispatcher.Deliver(context.Background())
+	if err != nil {
+		t.Error("want delivery not to be retried before its backoff")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx, time.Millisecond)
+		close(done)
+	}()
+	for start := time.Now(); len(dispatcher.Pending()) > 0 && time.Since(start) < 5*time.Second; {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	events, ids := receiver.received()
+	if len(events) != 1 || len(ids) != 3 {
+		t.Fatalf("want the event to be received on the third attempt, got %d events after %d attempts",
+			len(events), len(ids))
+	}
+	if ids[0] != ids[1] || ids[1] != ids[2] {
+		t.Errorf("want retries to keep the delivery id, got %v", ids)
+	}
+}
+
+func TestWebhookDispatcher_GivesUpAfterMaxAttempts(t *testing.T) {
+	t.Parallel()
+	receiver := newWebhookReceiver(t, "s3cret", 10)
+	dispatcher, err := habit.NewWebhookDispatcher(&habit.MemoryDeliveryQueue{},
+		habit.Webhook{URL: receiver.URL, Secret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.MaxAttempts = 2
+	dispatcher.Backoff = time.Nanosecond
+	dispatcher.HandleEvent(habit.Event{ID: "1", Type: habit.StreakExtendedEvent, Time: time.Now()})
+	_ = dispatcher.Deliver(context.Background())
+	time.Sleep(time.Millisecond)
+	err = dispatcher.Deliver(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "giving up after 2 attempts") {
+		t.Errorf("want delivery to be dropped, got %v", err)
+	}
+	if len(dispatcher.Pending()) != 0 {
+		t.Errorf("want dropped delivery to leave the queue, got %+v", dispatcher.Pending())
+	}
+}
+
+func TestWebhookDispatcher_RejectsWrongSignature(t *testing.T) {
+	t.Parallel()
+	receiver := newWebhookReceiver(t, "s3cret", 0)
+	dispatcher, err := habit.NewWebhookDispatcher(&habit.MemoryDeliveryQueue{},
+		habit.Webhook{URL: receiver.URL, Secret: "guess"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.HandleEvent(habit.Event{ID: "1", Type: habit.StreakExtendedEvent, Time: time.Now()})
+	err = dispatcher.Deliver(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("want receiver to reject the signature, got %v", err)
+	}
+}
+
+func TestFileDeliveryQueuePersistsDeliveries(t *testing.T) {
+	t.Parallel()
+	receiver := newWebhookReceiver(t, "s3cret", 1)
+	filename := filepath.Join(t.TempDir(), "queue.json")
+	webhook := habit.Webhook{URL: receiver.URL, Secret: "s3cret"}
+	dispatcher, err := habit.NewWebhookDispatcher(habit.OpenFileDeliveryQueue(filename), webhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.Backoff = time.Nanosecond
+	dispatcher.HandleEvent(habit.Event{ID: "1", Type: habit.StreakExtendedEvent, Time: time.Now(),
+		Habit: habit.HabitSummary{Name: "piano"}})
+	_ = dispatcher.Deliver(context.Background())
+
+	reopened, err := habit.NewWebhookDispatcher(habit.OpenFileDeliveryQueue(filename), webhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := reopened.Pending()
+	if len(pending) != 1 || pending[0].Attempts != 1 || pending[0].Event.Habit.Name != "piano" {
+		t.Fatalf("want failed delivery to be persisted, got %+v", pending)
+	}
+	time.Sleep(time.Millisecond)
+	err = reopened.Deliver(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := receiver.received(); len(events) != 1 {
+		t.Errorf("want persisted delivery to be received, got %+v", events)
+	}
+
+	other, err := habit.NewWebhookDispatcher(habit.OpenFileDeliveryQueue(filename),
+		habit.Webhook{URL: receiver.URL + "/other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other.Pending()) != 0 {
+		t.Errorf("want deliveries to removed webhooks to be dropped, got %+v", other.Pending())
+	}
+}